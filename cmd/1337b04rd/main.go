@@ -5,19 +5,35 @@ import (
 	"1337b04rd/internal/adapters/handler"
 	"1337b04rd/internal/adapters/middleware"
 	"1337b04rd/internal/adapters/repo/postgresql"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
 	"1337b04rd/internal/service"
+	"1337b04rd/internal/service/avatar"
 	imageuploader "1337b04rd/internal/service/image_uploader"
 	"1337b04rd/pkg/logger"
+	"1337b04rd/pkg/ratelimit"
+	"1337b04rd/pkg/securecookie"
 	"1337b04rd/pkg/utils"
 	"context"
+	"crypto/rand"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 func main() {
+	// Subcommands go before flags: 1337b04rd gc [--dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runImageGC(os.Args[2:])
+		return
+	}
+
 	port := flag.String("port", "", "Port number")
 	help := flag.Bool("help", false, "Show this screen.")
 
@@ -41,34 +57,69 @@ func main() {
 
 	// Repositories
 	sessionRepo := postgresql.NewPostgresSessionRepo(db, MyLogger)
-	postRepo := postgresql.NewPostgresPostRepo(db, MyLogger)
-	commentRepo := postgresql.NewPostgresCommentRepo(db, MyLogger)
-	uploader := imageuploader.NewLocalUploader(cfg.UploadDir, MyLogger)
+	if cfg.AvatarPoolSize > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := sessionRepo.SeedAvatarPool(ctx, cfg.AvatarPoolSize); err != nil {
+			log.Fatalf("failed to seed avatar pool: %v", err)
+		}
+		cancel()
+	}
+	boardRepo := postgresql.NewPostgresBoardRepo(db, MyLogger)
+	postRepo := postgresql.NewPostgresPostRepo(db, model.NameMode(cfg.NameMode), MyLogger)
+	commentRepo := postgresql.NewPostgresCommentRepo(db, model.NameMode(cfg.NameMode), MyLogger)
+	notificationRepo := postgresql.NewPostgresNotificationRepo(db, model.NameMode(cfg.NameMode), MyLogger)
+	imageRepo := postgresql.NewPostgresImageRepo(db, MyLogger)
+	uow := postgresql.NewPostgresUnitOfWork(db, postRepo, commentRepo, notificationRepo, imageRepo, MyLogger)
+	uploader := newImageUploader(cfg, MyLogger)
+	thumbnailer := imageuploader.NewThumbnailer(cfg.ThumbnailMaxWidth, cfg.ThumbnailMaxHeight)
+	identicon := avatar.NewIdenticon()
+	tripcoder := service.NewTripcoder(tripcodePepper(cfg, MyLogger))
+	editWindow := time.Duration(cfg.EditWindowMinutes) * time.Minute
 
 	// Services
-	sessionService := service.NewSessionServiceImpl(sessionRepo, postRepo, commentRepo, MyLogger)
-	postService := service.NewPostServiceImpl(postRepo, commentRepo, db, uploader, MyLogger)
-	commentService := service.NewCommentServiceImpl(postRepo, commentRepo, uploader, MyLogger)
+	sessionService := service.NewSessionServiceImpl(sessionRepo, newAvatarProvider(cfg, identicon, MyLogger), cfg.AvatarPoolSize, time.Duration(cfg.SessionDurationDays)*24*time.Hour, cfg.SessionSliding, ratelimit.NewLimiter(cfg.RecoveryRateLimit, time.Minute), MyLogger)
+	boardService := service.NewBoardServiceImpl(boardRepo, MyLogger)
+	postService := service.NewPostServiceImpl(postRepo, commentRepo, boardRepo, uow, uploader, thumbnailer, editWindow, MyLogger)
+	commentService := service.NewCommentServiceImpl(postRepo, commentRepo, boardRepo, notificationRepo, uow, uploader, thumbnailer, editWindow, MyLogger)
+	imageGCService := service.NewImageGCServiceImpl(imageRepo, uploader, time.Duration(cfg.ImageGCGraceMinutes)*time.Minute, MyLogger)
 
 	// Handlers
-	h := handler.NewHandler(postService, commentService, sessionService, MyLogger)
+	h := handler.NewHandler(postService, commentService, boardService, sessionService, uploader, identicon, tripcoder, editWindow, MyLogger)
 
 	// Middleware
-	sessionMiddleware := middleware.SessionMiddleware(sessionService)
+	sessionMiddleware := middleware.SessionMiddleware(sessionService, newSessionCookies(cfg, MyLogger), MyLogger)
 
-	// Match requests to corresponding handlers
-	mux := http.NewServeMux()
+	// Routes that never touch sessions, no cookie lookup and no db query
+	public := http.NewServeMux()
 
 	// Static assets and templates, serves them to client
 	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	public.Handle("/static/", http.StripPrefix("/static/", fs))
+
+	// Uploaded images, stored URLs look like /media/<key>
+	public.Handle("/media/", http.HandlerFunc(h.Media)) // GET /media/{key}
+
+	// Avatars generated when the avatar API is unavailable
+	public.Handle("/avatars/", http.HandlerFunc(h.Avatar)) // GET /avatars/{seed}.png
 
-	// Converts h.Catalog(w, r) --> http.Handler
-	mux.Handle("/", http.HandlerFunc(h.Catalog))
-	mux.Handle("/archive", http.HandlerFunc(h.Archive)) // GET /archive
+	// Liveness probe for load balancers and docker
+	public.Handle("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	// Match requests to corresponding handlers
+	mux := http.NewServeMux()
+
+	// Converts h.Boards(w, r) --> http.Handler
+	mux.Handle("/", http.HandlerFunc(h.Boards)) // GET /, /{board}/, /{board}/archive, /{board}/posts/{id}
 	mux.Handle("/posts/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.Post(w, r)
+		if strings.HasSuffix(r.URL.Path, "/edit") {
+			h.Edit(w, r) // GET, POST /posts/{id}[/comments/{cid}]/edit
+		} else if r.Method == http.MethodGet {
+			h.Post(w, r) // redirects to /{board}/posts/{id}
+		} else if r.Method == http.MethodDelete || (r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/delete")) {
+			h.Delete(w, r) // DELETE /posts/{id}[/comments/{cid}], POST .../delete
 		} else if r.Method == http.MethodPost {
 			h.SubmitComment(w, r)
 		} else {
@@ -76,9 +127,25 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))
-	mux.Handle("/create", http.HandlerFunc(h.CreatePostForm))  // GET /create
-	mux.Handle("/submit-post", http.HandlerFunc(h.SubmitPost)) // POST /posts
-	mux.Handle("/error", http.HandlerFunc(h.ErrorPage))        // GET /error
+	mux.Handle("/create", http.HandlerFunc(h.CreatePostForm))              // GET /create
+	mux.Handle("/submit-post", http.HandlerFunc(h.SubmitPost))             // POST /posts
+	mux.Handle("/error", http.HandlerFunc(h.ErrorPage))                    // GET /error
+	mux.Handle("/session", http.HandlerFunc(h.CreateIdentity))             // POST /session
+	mux.Handle("/recovery", http.HandlerFunc(h.Recovery))                  // GET, POST /recovery
+	mux.Handle("/me", http.HandlerFunc(h.Me))                              // GET /me
+	mux.Handle("/api/me", http.HandlerFunc(h.MeAPI))                       // GET /api/me
+	mux.Handle("/notifications", http.HandlerFunc(h.Notifications))        // GET, POST /notifications
+	mux.Handle("/api/notifications", http.HandlerFunc(h.NotificationsAPI)) // GET, POST /api/notifications
+	mux.Handle("/api/boards/", http.HandlerFunc(h.BoardsAPI))              // GET /api/boards/{board}/catalog, /api/boards/{board}/archive
+	mux.Handle("/api/recovery", http.HandlerFunc(h.RecoveryAPI))
+	mux.Handle("/api/recovery/", http.HandlerFunc(h.RecoveryAPI)) // POST /api/recovery/redeem
+
+	// Moderation, behind HTTP Basic auth with MOD_PASSWORD
+	moderatorOnly := middleware.ModeratorMiddleware(cfg.ModPassword, MyLogger)
+	mux.Handle("/mod/posts/", moderatorOnly(http.HandlerFunc(h.Moderation))) // GET /mod/posts/{id}/revisions, POST /mod/posts/{id}/{sticky|unsticky|lock|unlock}
+
+	// Everything else runs with the session middleware
+	public.Handle("/", sessionMiddleware(mux))
 
 	// If flag is not from CLI, then use environment
 	finalPort := *port
@@ -89,9 +156,8 @@ func main() {
 		}
 	}
 
-	// Apply middlewares: CORS → Session → mux
-	handler := middleware.CORSMiddleware()(mux)
-	handler = sessionMiddleware(handler)
+	// Apply middlewares: client IP → CORS → public routes or Session → mux
+	handler := middleware.ClientIPMiddleware(cfg.TrustedProxyHeader)(middleware.CORSMiddleware()(public))
 
 	server := &http.Server{
 		Addr:         ":" + finalPort,
@@ -108,7 +174,7 @@ func main() {
 
 		for range ticker.C {
 			ctx := context.Background()
-			posts, err := postService.GetAllPosts(ctx, false)
+			posts, err := postService.GetAllPosts(ctx, 0, false) // every board
 			if err == nil {
 				for _, p := range posts {
 					_ = postService.ArchivePost(ctx, p.PostID)
@@ -118,8 +184,135 @@ func main() {
 		}
 	}()
 
+	// Orphaned uploads are rare, walking the whole storage every minute is not worth it
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.ImageGCEveryMinutes) * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			_, _ = imageGCService.CollectOrphans(context.Background(), false)
+		}
+	}()
+
 	log.Printf("Server running on port %s", cfg.Port)
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("server failed: %v", err)
 	}
 }
+
+// Picks avatars according to AVATAR_PROVIDER, generated ones are always the last resort
+func newAvatarProvider(cfg *config.Config, identicon *avatar.Identicon, logger *slog.Logger) port.AvatarProvider {
+	if cfg.AvatarProvider == "local" {
+		return avatar.NewChain(logger, identicon)
+	}
+	remote := avatar.NewRemoteProvider(cfg.AvatarAPIBaseURL, cfg.AvatarPoolSize)
+	return avatar.NewChain(logger, remote, identicon)
+}
+
+// Secure tripcodes need a stable pepper, without one they change on every restart
+func tripcodePepper(cfg *config.Config, logger *slog.Logger) []byte {
+	if cfg.TripcodePepper != "" {
+		return []byte(cfg.TripcodePepper)
+	}
+	logger.Warn("TRIPCODE_PEPPER not set, secure tripcodes will change on restart")
+	pepper := make([]byte, 32)
+	if _, err := rand.Read(pepper); err != nil {
+		log.Fatalf("generating tripcode pepper: %v", err)
+	}
+	return pepper
+}
+
+// Session cookies are signed with SESSION_KEYS, without keys sessions end on restart
+func newSessionCookies(cfg *config.Config, logger *slog.Logger) *middleware.SessionCookies {
+	keys := cfg.SessionKeys
+	if len(keys) == 0 {
+		logger.Warn("SESSION_KEYS not set, sessions will not survive a restart")
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("generating session key: %v", err)
+		}
+		keys = []string{string(key)}
+	}
+
+	codec, err := securecookie.NewCodec(keys, cfg.SessionEncrypt)
+	if err != nil {
+		log.Fatalf("session cookie keys: %v", err)
+	}
+
+	sameSite := http.SameSiteStrictMode
+	switch cfg.CookieSameSite {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return middleware.NewSessionCookies(codec, middleware.CookieOptions{
+		Name:     cfg.SessionCookieName,
+		Domain:   cfg.CookieDomain,
+		Secure:   cfg.CookieSecure,
+		SameSite: sameSite,
+	})
+}
+
+// Picks image storage according to STORAGE_BACKEND
+func newImageUploader(cfg *config.Config, logger *slog.Logger) port.ImageUploader {
+	if cfg.StorageBackend != "s3" {
+		return imageuploader.NewLocalUploader(cfg.UploadDir, logger)
+	}
+
+	s3 := imageuploader.NewS3Uploader(imageuploader.S3Config{
+		Endpoint:  cfg.S3Endpoint,
+		Bucket:    cfg.S3Bucket,
+		Region:    cfg.S3Region,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+	}, logger)
+
+	// Every replica tries to create the bucket on start, only the first one succeeds
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s3.CreateBucket(ctx); err != nil && !errors.Is(err, model.ErrBucketAlreadyExists) {
+		log.Fatalf("failed to create bucket: %v", err)
+	}
+	return s3
+}
+
+// One-off orphaned upload collection, prints what was (or would be) deleted
+func runImageGC(args []string) {
+	fset := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fset.Bool("dry-run", false, "Only report orphaned images.")
+	fset.Usage = utils.PrintUsage
+	fset.Parse(args)
+
+	cfg := config.LoadConfig()
+	MyLogger := logger.GetLoggerObject(cfg.LogFilePath)
+	db := utils.InitPostgres()
+	defer db.Close()
+
+	gc := service.NewImageGCServiceImpl(
+		postgresql.NewPostgresImageRepo(db, MyLogger),
+		newImageUploader(cfg, MyLogger),
+		time.Duration(cfg.ImageGCGraceMinutes)*time.Minute,
+		MyLogger,
+	)
+
+	report, err := gc.CollectOrphans(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("image gc failed: %v", err)
+	}
+
+	for _, obj := range report.Orphans {
+		fmt.Printf("%s\t%d\t%s\n", obj.Key, obj.Size, obj.ModTime.Format(time.RFC3339))
+	}
+	if report.DryRun {
+		fmt.Printf("dry run: %d objects scanned, %d orphaned, %d within grace period\n",
+			report.Scanned, len(report.Orphans), report.Recent)
+		return
+	}
+	fmt.Printf("%d objects scanned, %d deleted, %d failed, %d within grace period\n",
+		report.Scanned, report.Deleted, report.Failed, report.Recent)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -15,8 +18,32 @@ type Config struct {
 	LogFilePath         string
 	UploadDir           string
 	SessionCookieName   string
-	SessionDurationDays string
+	SessionDurationDays int
+	SessionSliding      bool     // extend sessions that are used in the second half of their lifetime
+	RecoveryRateLimit   int      // recovery code redemptions allowed per client IP and minute
+	TrustedProxyHeader  string   // header with the client IP set by the reverse proxy, empty uses the peer address
+	SessionKeys         []string // first key signs new cookies, all of them verify
+	SessionEncrypt      bool     // encrypt the session ID inside the cookie too
+	CookieSecure        bool
+	CookieDomain        string
+	CookieSameSite      string // "strict", "lax" or "none"
 	AvatarAPIBaseURL    string
+	AvatarProvider      string // "remote" (falls back to generated) or "local"
+	AvatarPoolSize      int
+	NameMode            string // "retroactive" renames old posts too, "frozen" keeps the name they were written with
+	TripcodePepper      string // keys secure "##" tripcodes, must stay the same across restarts
+	EditWindowMinutes   int    // authors may edit posts and comments this long after writing them
+	ModPassword         string // HTTP Basic password of the /mod/ pages, they are off without one
+	StorageBackend      string // "local" or "s3"
+	S3Endpoint          string
+	S3Bucket            string
+	S3Region            string
+	S3AccessKey         string
+	S3SecretKey         string
+	ThumbnailMaxWidth   int
+	ThumbnailMaxHeight  int
+	ImageGCGraceMinutes int // orphans younger than this are kept
+	ImageGCEveryMinutes int
 }
 
 func LoadConfig() *Config {
@@ -30,8 +57,32 @@ func LoadConfig() *Config {
 		LogFilePath:         getEnv("LOG_FILE_PATH", "logging/logging.log"),
 		UploadDir:           getEnv("UPLOAD_DIR", "/data"),
 		SessionCookieName:   getEnv("SESSION_COOKIE_NAME", "session_id"),
-		SessionDurationDays: getEnv("SESSION_DURATION_DAYS", "7"),
+		SessionDurationDays: getEnvInt("SESSION_DURATION_DAYS", 7),
+		SessionSliding:      getEnvBool("SESSION_SLIDING", true),
+		RecoveryRateLimit:   getEnvInt("RECOVERY_RATE_LIMIT", 5),
+		TrustedProxyHeader:  os.Getenv("TRUSTED_PROXY_HEADER"),
+		SessionKeys:         getEnvList("SESSION_KEYS"), // no default, a made up one is picked in main
+		SessionEncrypt:      getEnvBool("SESSION_ENCRYPT", false),
+		CookieSecure:        getEnvBool("COOKIE_SECURE", true),
+		CookieDomain:        os.Getenv("COOKIE_DOMAIN"),
+		CookieSameSite:      getEnv("COOKIE_SAMESITE", "strict"),
 		AvatarAPIBaseURL:    getEnv("AVATAR_API_BASE_URL", "https://rickandmortyapi.com/api/character"),
+		AvatarProvider:      getEnvChoice("AVATAR_PROVIDER", "remote", "local"),
+		AvatarPoolSize:      getEnvInt("AVATAR_POOL_SIZE", 826), // characters in the Rick and Morty API
+		NameMode:            getEnvChoice("NAME_MODE", "retroactive", "frozen"),
+		TripcodePepper:      os.Getenv("TRIPCODE_PEPPER"), // no default, a made up one is picked in main
+		EditWindowMinutes:   getEnvInt("EDIT_WINDOW_MINUTES", 5),
+		ModPassword:         os.Getenv("MOD_PASSWORD"),
+		StorageBackend:      getEnvChoice("STORAGE_BACKEND", "local", "s3"),
+		S3Endpoint:          getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Bucket:            getEnv("S3_BUCKET", "leetboard"),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:         getEnv("S3_ACCESS_KEY", "minioadmin"),
+		S3SecretKey:         getEnv("S3_SECRET_KEY", "minioadmin"),
+		ThumbnailMaxWidth:   getEnvInt("THUMBNAIL_MAX_WIDTH", 250),
+		ThumbnailMaxHeight:  getEnvInt("THUMBNAIL_MAX_HEIGHT", 250),
+		ImageGCGraceMinutes: getEnvInt("IMAGE_GC_GRACE_MINUTES", 60),
+		ImageGCEveryMinutes: getEnvInt("IMAGE_GC_EVERY_MINUTES", 60),
 	}
 
 	return cfg
@@ -45,3 +96,52 @@ func getEnv(key, fallback string) string {
 	}
 	return val
 }
+
+func getEnvInt(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		log.Printf("Warning: %s not set, using default: %d", key, fallback)
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: %s=%q is not a positive number, using default: %d", key, val, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		log.Printf("Warning: %s not set, using default: %t", key, fallback)
+		return fallback
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Warning: %s=%q is not a boolean, using default: %t", key, val, fallback)
+		return fallback
+	}
+	return b
+}
+
+// One of a fixed set of values, the first one is the default
+// Anything else stops the start, a typo must not quietly pick another backend or mode
+func getEnvChoice(key string, fallback string, others ...string) string {
+	val := getEnv(key, fallback)
+	if val != fallback && !slices.Contains(others, val) {
+		log.Fatalf("%s=%q is not one of %s", key, val, strings.Join(append([]string{fallback}, others...), ", "))
+	}
+	return val
+}
+
+// Comma separated values, empty entries are dropped
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -1,38 +1,157 @@
 -- Sessions table
 CREATE TABLE sessions (
   session_id UUID PRIMARY KEY, -- Cookie/session ID
+  avatar_id INT, -- character from the avatar pool, unique among active sessions until the pool runs out
   avatar_url TEXT NOT NULL,
+  display_name TEXT NOT NULL DEFAULT '', -- current name, empty means Anonymous
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   expires_at TIMESTAMP NOT NULL
 );
 
+-- Avatar pool, rows 1..AVATAR_POOL_SIZE are added on start
+-- active_sessions is bumped on allocation and recounted from unexpired sessions on every cleanup
+CREATE TABLE avatars (
+  avatar_id INT PRIMARY KEY,
+  active_sessions INT NOT NULL DEFAULT 0,
+  last_assigned_at TIMESTAMP -- ties go to the avatar handed out longest ago
+);
+
+-- Every name a session has used, posts show the one in effect when they were written if NAME_MODE=frozen
+CREATE TABLE session_names (
+  session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE ON UPDATE CASCADE,
+  display_name TEXT NOT NULL,
+  effective_from TIMESTAMP NOT NULL,
+  PRIMARY KEY (session_id, effective_from)
+);
+
+-- One-time codes that bring a session to another browser, only the SHA-256 of the code is stored
+CREATE TABLE recovery_codes (
+  code_hash CHAR(64) PRIMARY KEY,
+  session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE ON UPDATE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Boards, every thread lives on one of them
+CREATE TABLE boards (
+  board_id SERIAL PRIMARY KEY,
+  slug TEXT NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9]{1,10}$'), -- URL part, /b/
+  title TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  is_nsfw BOOLEAN NOT NULL DEFAULT FALSE,
+  max_threads INT NOT NULL DEFAULT 0, -- active threads kept, 0 means no limit
+  bump_limit INT NOT NULL DEFAULT 300, -- replies past this one no longer bump the thread, 0 means no limit
+  lifetime_minutes INT NOT NULL DEFAULT 10 CHECK (lifetime_minutes > 0), -- threads without comments are archived after this
+  lifetime_reply_minutes INT NOT NULL DEFAULT 15 CHECK (lifetime_reply_minutes > 0), -- and the others this long after the latest comment
+  allowed_types TEXT[] NOT NULL DEFAULT '{}' -- MIME types accepted for uploads, empty accepts every supported image
+);
+
+INSERT INTO boards (slug, title, description, is_nsfw, max_threads, bump_limit, lifetime_minutes, lifetime_reply_minutes, allowed_types) VALUES
+  ('b', 'Random', 'Anything goes', TRUE, 100, 300, 10, 15, '{}'),
+  ('g', 'Technology', 'Code, hardware and hacking', FALSE, 150, 500, 30, 60, '{image/png,image/jpeg}');
+
 -- Posts table
 CREATE TABLE posts (
   post_id UUID PRIMARY KEY, -- UUID generated by Go app
-  session_id UUID NOT NULL REFERENCES sessions(session_id), -- changed TEXT -> UUID to match FK type
-  user_name TEXT NOT NULL DEFAULT 'Anonymous',
+  board_id INT NOT NULL REFERENCES boards(board_id),
+  session_id UUID NOT NULL REFERENCES sessions(session_id) ON UPDATE CASCADE, -- follows session ID rotation
+  tripcode TEXT NOT NULL DEFAULT '', -- hash of the poster's secret, the secret itself is never stored
   post_title TEXT NOT NULL,
   post_content TEXT, -- Removed "NULLABLE" (not valid SQL)
-  image_urls TEXT[] DEFAULT '{}',
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  is_archived BOOLEAN DEFAULT FALSE
+  bumped_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- created_at, then the latest reply without sage below the bump limit
+  edited_at TIMESTAMP, -- NULL until the author edits the post
+  is_archived BOOLEAN DEFAULT FALSE,
+  is_sticky BOOLEAN NOT NULL DEFAULT FALSE, -- pinned by an operator, sorted first and not archived by time
+  is_locked BOOLEAN NOT NULL DEFAULT FALSE -- frozen by an operator, no new replies
 );
 
 -- Comments table
 CREATE TABLE comments (
   comment_id UUID PRIMARY KEY,
   post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
-  session_id UUID NOT NULL REFERENCES sessions(session_id), -- changed TEXT -> UUID to match FK
-  user_name TEXT NOT NULL DEFAULT 'Anonymous',
+  session_id UUID NOT NULL REFERENCES sessions(session_id) ON UPDATE CASCADE,
+  tripcode TEXT NOT NULL DEFAULT '',
   comment_content TEXT,
   parent_comment_id UUID REFERENCES comments(comment_id),
-  image_urls TEXT[] DEFAULT '{}',
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  is_archived BOOLEAN DEFAULT FALSE
+  edited_at TIMESTAMP,
+  is_archived BOOLEAN DEFAULT FALSE,
+  is_deleted BOOLEAN NOT NULL DEFAULT FALSE, -- removed by its author, kept as a tombstone for the replies
+  sage BOOLEAN NOT NULL DEFAULT FALSE -- the reply didn't bump the thread
+);
+
+-- Earlier versions of edited posts and comments, one row per edit, shown to moderators only
+CREATE TABLE post_revisions (
+  post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+  revision INT NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  image_hashes TEXT[] NOT NULL DEFAULT '{}', -- images of that version, their files may be gone
+  written_at TIMESTAMP NOT NULL, -- when the version was posted or saved by an earlier edit
+  replaced_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (post_id, revision)
+);
+
+CREATE TABLE comment_revisions (
+  comment_id UUID NOT NULL REFERENCES comments(comment_id) ON DELETE CASCADE,
+  revision INT NOT NULL,
+  title TEXT NOT NULL DEFAULT '', -- unused, keeps both tables the same shape
+  content TEXT NOT NULL,
+  image_hashes TEXT[] NOT NULL DEFAULT '{}',
+  written_at TIMESTAMP NOT NULL,
+  replaced_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (comment_id, revision)
+);
+
+-- Replies to a session's comments, the reply itself is found through comments.parent_comment_id
+CREATE TABLE notifications (
+  reply_id UUID PRIMARY KEY REFERENCES comments(comment_id) ON DELETE CASCADE,
+  session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE ON UPDATE CASCADE, -- author of the parent comment
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  read_at TIMESTAMP -- NULL while unread
+);
+
+-- Images table, one row per unique content
+CREATE TABLE images (
+  image_hash CHAR(64) PRIMARY KEY, -- SHA-256 of the stored file
+  storage_key TEXT NOT NULL,
+  thumbnail_key TEXT NOT NULL DEFAULT '',
+  mime_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  ref_count INT NOT NULL DEFAULT 0, -- number of posts and comments using the image
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Images attached to posts and comments, original_name is display metadata only
+CREATE TABLE post_images (
+  post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  image_hash CHAR(64) NOT NULL REFERENCES images(image_hash),
+  original_name TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (post_id, position)
+);
+
+CREATE TABLE comment_images (
+  comment_id UUID NOT NULL REFERENCES comments(comment_id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  image_hash CHAR(64) NOT NULL REFERENCES images(image_hash),
+  original_name TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (comment_id, position)
 );
 
 -- Indexes
+CREATE INDEX idx_sessions_avatar_id ON sessions(avatar_id, expires_at);
+CREATE INDEX idx_avatars_least_used ON avatars(active_sessions, last_assigned_at NULLS FIRST, avatar_id);
+CREATE INDEX idx_recovery_codes_session_id ON recovery_codes(session_id);
 CREATE INDEX idx_posts_session_id ON posts(session_id);
-CREATE INDEX idx_posts_created_at ON posts(created_at);
+-- Match the keyset orderings of the catalog and the archive
+CREATE INDEX idx_posts_catalog ON posts(board_id, is_sticky DESC, bumped_at DESC, post_id DESC) WHERE is_archived = false;
+CREATE INDEX idx_posts_archive ON posts(board_id, created_at DESC, post_id DESC) WHERE is_archived = true;
 CREATE INDEX idx_comments_post_id ON comments(post_id);
+CREATE INDEX idx_comments_session_id ON comments(session_id);
 CREATE INDEX idx_comments_parent ON comments(parent_comment_id);
+CREATE INDEX idx_notifications_unread ON notifications(session_id, created_at) WHERE read_at IS NULL;
+CREATE INDEX idx_post_images_hash ON post_images(image_hash);
+CREATE INDEX idx_comment_images_hash ON comment_images(image_hash);
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// GET /avatars/{seed}.png
+// Generated avatars depend only on the seed, so they are cached like uploads
+func (h *Handler) Avatar(w http.ResponseWriter, r *http.Request) {
+	const fn = "Avatar"
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seed, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/avatars/"), ".png")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := h.avatars.RenderAvatar(seed)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidInput) {
+			http.NotFound(w, r)
+			return
+		}
+		utils.LogError(h.logger, fn, "failed to render avatar", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", mediaCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GET /, /{board}/, /{board}/archive, /{board}/posts/{id}
+// Everything no other route claims lands here
+func (h *Handler) Boards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.LogWarn(h.logger, "Boards", "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		h.boardIndex(w, r)
+		return
+	}
+
+	slug, rest, found := strings.Cut(path, "/")
+	if !model.ValidBoardSlug(slug) {
+		http.NotFound(w, r)
+		return
+	}
+	if !found {
+		http.Redirect(w, r, "/"+slug+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	board, err := h.boardService.GetBoard(r.Context(), slug)
+	if errors.Is(err, model.ErrBoardNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		utils.LogError(h.logger, "Boards", "failed to get board", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	switch {
+	case rest == "":
+		h.catalog(w, r, board, false)
+	case rest == "archive":
+		h.catalog(w, r, board, true)
+	case strings.HasPrefix(rest, "posts/"):
+		h.thread(w, r, board, strings.TrimPrefix(rest, "posts/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GET /
+func (h *Handler) boardIndex(w http.ResponseWriter, r *http.Request) {
+	session := CheckAndReturnSession(w, r, h.logger, "Boards")
+	if session == nil {
+		return
+	}
+
+	boards, err := h.boardService.GetBoards(r.Context())
+	if err != nil {
+		utils.LogError(h.logger, "Boards", "failed to get boards", err)
+		http.Redirect(w, r, "/error", http.StatusSeeOther)
+		return
+	}
+
+	tpl, err := template.ParseFiles(templates["boards"])
+	if err != nil {
+		utils.LogError(h.logger, "Boards", "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session *middleware.SessionData
+		Boards  []model.Board
+	}{
+		Session: session,
+		Boards:  boards,
+	}
+
+	if err := tpl.Execute(w, data); err != nil {
+		utils.LogError(h.logger, "Boards", "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
+
+// One thread of a catalog or archive page in the API
+type catalogEntry struct {
+	PostID    string    `json:"post_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	URL       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	BumpedAt  time.Time `json:"bumped_at"`
+	Replies   int       `json:"replies"`
+	Images    int       `json:"images"`
+	Sticky    bool      `json:"sticky"`
+	Locked    bool      `json:"locked"`
+}
+
+type catalogPage struct {
+	Posts []catalogEntry `json:"posts"`
+	Next  string         `json:"next,omitempty"` // pass as ?after= for the next page
+	Prev  string         `json:"prev,omitempty"` // pass as ?before= for the previous page
+}
+
+// GET /api/boards/{board}/catalog and /api/boards/{board}/archive
+// Takes ?after=, ?before= and ?limit=
+func (h *Handler) BoardsAPI(w http.ResponseWriter, r *http.Request) {
+	const fn = "BoardsAPI"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slug, listing, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/boards/"), "/")
+	if !model.ValidBoardSlug(slug) || (listing != "catalog" && listing != "archive") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found."})
+		return
+	}
+
+	board, err := h.boardService.GetBoard(r.Context(), slug)
+	if err != nil {
+		h.writeJSONError(w, fn, err)
+		return
+	}
+
+	page, err := h.postService.ListPosts(r.Context(), board.BoardID, listing == "archive", pageRequest(r))
+	if err != nil {
+		h.writeJSONError(w, fn, err)
+		return
+	}
+
+	result := catalogPage{Posts: []catalogEntry{}, Next: page.Next, Prev: page.Prev}
+	for _, p := range page.Posts {
+		result.Posts = append(result.Posts, catalogEntry{
+			PostID:    string(p.PostID),
+			Title:     p.Title,
+			Content:   p.Content,
+			URL:       p.URL(),
+			Thumbnail: p.Thumbnail(),
+			CreatedAt: p.CreatedAt,
+			BumpedAt:  p.BumpedAt,
+			Replies:   p.ReplyCount,
+			Images:    p.ImageCount,
+			Sticky:    p.IsSticky,
+			Locked:    p.IsLocked,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
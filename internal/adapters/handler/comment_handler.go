@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"1337b04rd/internal/adapters/middleware"
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"io"
@@ -19,11 +18,9 @@ func (h *Handler) SubmitComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Session check
-	session := middleware.GetSessionFromContext(r.Context())
+	// First write of a visitor creates the session
+	session := requireSession(w, r, h.logger, fn)
 	if session == nil {
-		utils.LogError(h.logger, fn, "session not found", nil)
-		http.Error(w, "Session not found", http.StatusUnauthorized)
 		return
 	}
 
@@ -45,12 +42,15 @@ func (h *Handler) SubmitComment(w http.ResponseWriter, r *http.Request) {
 	// Read form values from html
 	content := r.FormValue("comment")
 	replyTo := r.FormValue("reply_to")
-	newName := r.FormValue("name")
+	// "Name#secret" carries a tripcode secret, it stays in this function
+	newName, secret, secure := model.SplitNameField(r.FormValue("name"))
 
-	// Optional: update username
-	if newName != "" {
-		if err := h.sessionService.OverrideUserName(r.Context(), session.SessionID, newName); err != nil {
-			utils.LogError(h.logger, fn, "failed to override username", err)
+	// Optional: update display name of the session
+	if newName != "" && newName != session.DisplayName {
+		if err := h.sessionService.SetDisplayName(r.Context(), session.SessionID, newName); err != nil {
+			utils.LogError(h.logger, fn, "failed to set display name", err)
+			redirectToError(w, r, err)
+			return
 		}
 	}
 
@@ -71,15 +71,16 @@ func (h *Handler) SubmitComment(w http.ResponseWriter, r *http.Request) {
 	comment := &model.Comment{
 		SessionID:       session.SessionID,
 		PostID:          utils.UUID(postID),
-		UserName:        newName,
+		Tripcode:        h.tripcodes.Tripcode(secret, secure),
 		ParentCommentID: utils.UUID(replyTo),
 		Content:         content,
+		Sage:            r.FormValue("sage") != "",
 	}
 
 	// Submit comment via service
 	if err := h.commentService.CreateComment(r.Context(), comment, imageData); err != nil {
 		utils.LogError(h.logger, fn, "failed to create comment", err)
-		http.Redirect(w, r, "/error", http.StatusSeeOther)
+		redirectToError(w, r, err)
 		return
 	}
 
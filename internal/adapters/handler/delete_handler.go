@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"net/http"
+	"strings"
+)
+
+// DELETE /posts/{id}, DELETE /posts/{id}/comments/{cid}
+// Forms POST to the same paths with a /delete suffix
+// scope=images removes only the pictures and keeps the text
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	const fn = "Delete"
+
+	form := r.Method == http.MethodPost
+	if r.Method != http.MethodDelete && !form {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	suffix := ""
+	if form {
+		suffix = "/delete"
+	}
+	postID, commentID, err := threadTarget(r, suffix)
+	if err == nil {
+		err = h.deleteOwned(r, postID, commentID, r.FormValue("scope") == "images")
+	}
+	if err != nil {
+		if form {
+			utils.LogError(h.logger, fn, "delete failed", err)
+			redirectToError(w, r, err)
+		} else {
+			h.writeJSONError(w, fn, err)
+		}
+		return
+	}
+
+	utils.LogInfo(h.logger, fn, "deleted by author", "post_id", postID, "comment_id", commentID)
+	if !form {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// The thread is still there unless the whole post went
+	if commentID == "" && r.FormValue("scope") != "images" {
+		// The post can't tell its board anymore, the form does
+		target := "/"
+		if slug := r.FormValue("board"); model.ValidBoardSlug(slug) {
+			target = "/" + slug + "/"
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/posts/"+postID, http.StatusSeeOther)
+}
+
+// threadTarget reads the post and optional comment ID from /posts/{id}[/comments/{cid}]{suffix}
+func threadTarget(r *http.Request, suffix string) (postID, commentID string, err error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/posts/"), suffix)
+
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return parts[0], "", nil
+	case len(parts) == 3 && parts[0] != "" && parts[1] == "comments" && parts[2] != "":
+		return parts[0], parts[2], nil
+	}
+	return "", "", model.ErrInvalidInput
+}
+
+// Only the session that wrote a post may delete it, visitors without one own nothing
+func (h *Handler) deleteOwned(r *http.Request, postID, commentID string, imagesOnly bool) error {
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return model.ErrSessionNotFound
+	}
+	if commentID == "" {
+		return h.postService.DeletePost(r.Context(), utils.UUID(postID), session.SessionID, imagesOnly)
+	}
+	return h.commentService.DeleteComment(r.Context(), utils.UUID(postID), utils.UUID(commentID), session.SessionID, imagesOnly)
+}
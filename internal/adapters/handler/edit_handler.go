@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+)
+
+// GET, POST /posts/{id}/edit and /posts/{id}/comments/{cid}/edit
+// GET shows the form, POST saves the edit, the services check author and edit window
+func (h *Handler) Edit(w http.ResponseWriter, r *http.Request) {
+	const fn = "Edit"
+
+	postID, commentID, err := threadTarget(r, "/edit")
+	if err != nil {
+		utils.LogWarn(h.logger, fn, "invalid edit path", "path", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		redirectToError(w, r, model.ErrSessionNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.editForm(w, r, session, postID, commentID)
+	case http.MethodPost:
+		h.submitEdit(w, r, session, postID, commentID)
+	default:
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Checks here only spare the author a form they can't submit
+func (h *Handler) editForm(w http.ResponseWriter, r *http.Request, session *model.Session, postID, commentID string) {
+	const fn = "EditForm"
+
+	post, err := h.postService.GetPostByID(r.Context(), utils.UUID(postID))
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to get post", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	data := struct {
+		Action     string
+		IsComment  bool
+		Title      string
+		Content    string
+		Images     []model.ImageLink
+		Session    *middleware.SessionData
+		WindowLeft string
+	}{
+		Action:  "/posts/" + postID + "/edit",
+		Title:   post.Title,
+		Content: post.Content,
+		Images:  post.Images(),
+		Session: CheckAndReturnSession(w, r, h.logger, fn),
+	}
+	owner, createdAt := post.SessionID, post.CreatedAt
+
+	if commentID != "" {
+		comment, err := h.findComment(r, post, commentID)
+		if err != nil {
+			utils.LogError(h.logger, fn, "failed to get comment", err)
+			redirectToError(w, r, err)
+			return
+		}
+		data.Action = "/posts/" + postID + "/comments/" + commentID + "/edit"
+		data.IsComment = true
+		data.Content = comment.Content
+		data.Images = comment.Images()
+		owner, createdAt = comment.SessionID, comment.CreatedAt
+	}
+
+	if owner != session.SessionID {
+		redirectToError(w, r, model.ErrNotOwner)
+		return
+	}
+	if post.IsArchived || !model.CanEdit(createdAt, h.editWindow) {
+		redirectToError(w, r, model.ErrEditWindowClosed)
+		return
+	}
+	data.WindowLeft = createdAt.Add(h.editWindow).Sub(time.Now()).Round(time.Second).String()
+
+	tpl, err := template.ParseFiles(templates["edit"])
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+	if err := tpl.Execute(w, data); err != nil {
+		utils.LogError(h.logger, fn, "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) submitEdit(w http.ResponseWriter, r *http.Request, session *model.Session, postID, commentID string) {
+	const fn = "SubmitEdit"
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.LogError(h.logger, fn, "failed to parse multipart form", err)
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	edit := model.Edit{
+		Title:         r.FormValue("subject"),
+		Content:       r.FormValue("comment"),
+		ReplaceImages: r.FormValue("replace_images") != "",
+	}
+
+	// New uploads replace the current images
+	imageData := make(map[string]io.Reader)
+	for _, fh := range r.MultipartForm.File["file"] {
+		file, err := fh.Open()
+		if err != nil {
+			utils.LogWarn(h.logger, fn, "skipped broken uploaded file", "file", fh.Filename, "error", err.Error())
+			continue
+		}
+		defer file.Close()
+		imageData[fh.Filename] = file
+	}
+
+	var err error
+	target := "/posts/" + postID
+	if commentID == "" {
+		err = h.postService.EditPost(r.Context(), utils.UUID(postID), session.SessionID, edit, imageData)
+	} else {
+		err = h.commentService.EditComment(r.Context(), utils.UUID(postID), utils.UUID(commentID), session.SessionID, edit, imageData)
+		target += "#" + commentID
+	}
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to save edit", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	utils.LogInfo(h.logger, fn, "edit saved", "post_id", postID, "comment_id", commentID)
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// Comments are looked up in their own thread only
+func (h *Handler) findComment(r *http.Request, post *model.Post, commentID string) (*model.Comment, error) {
+	comments, err := h.commentService.GetCommentsByPostID(r.Context(), post.PostID, post.IsArchived)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		if c.CommentID == utils.UUID(commentID) && !c.IsDeleted {
+			return c, nil
+		}
+	}
+	return nil, model.ErrCommentNotFound
+}
@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 )
 
@@ -12,6 +16,54 @@ type ErrorData struct {
 	Message string
 }
 
+// Domain errors that are safe to show to the user, anything else becomes a generic 500
+var userFacingErrors = []struct {
+	err     error
+	code    int
+	message string
+}{
+	{model.ErrUnsupportedImageType, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are allowed."},
+	{model.ErrImageTypeNotAllowed, http.StatusUnsupportedMediaType, "This board does not accept this image type."},
+	{model.ErrImageTypeMismatch, http.StatusUnsupportedMediaType, "The file content does not match its extension."},
+	{model.ErrInvalidImage, http.StatusBadRequest, "The uploaded file is not a valid image."},
+	{model.ErrImageTooLarge, http.StatusRequestEntityTooLarge, "The image file is too large."},
+	{model.ErrImageDimensionsTooBig, http.StatusRequestEntityTooLarge, "The image dimensions are too large."},
+	{model.ErrMissingTitle, http.StatusBadRequest, "Post title is required."},
+	{model.ErrCommentEmpty, http.StatusBadRequest, "Comment cannot be empty."},
+	{model.ErrPostNotFound, http.StatusNotFound, "Post not found."},
+	{model.ErrBoardNotFound, http.StatusNotFound, "Board not found."},
+	{model.ErrInvalidCursor, http.StatusBadRequest, "This page link is invalid."},
+	{model.ErrThreadLocked, http.StatusForbidden, "This thread is locked, it takes no new replies or edits."},
+	{model.ErrCommentNotFound, http.StatusNotFound, "Comment not found."},
+	{model.ErrInvalidDisplayName, http.StatusBadRequest, "Name must be 1 to 32 printable characters."},
+	{model.ErrSessionNotFound, http.StatusUnauthorized, "You don't have a session yet."},
+	{model.ErrNotOwner, http.StatusForbidden, "Only the author can do this."},
+	{model.ErrEditWindowClosed, http.StatusForbidden, "It is too late to edit this post."},
+	{model.ErrInvalidRecovery, http.StatusBadRequest, "The recovery code is invalid or was already used."},
+	{model.ErrTooManyAttempts, http.StatusTooManyRequests, "Too many attempts, try again in a minute."},
+	{model.ErrInvalidInput, http.StatusBadRequest, "Invalid input provided."},
+}
+
+// userFacingError maps known domain errors to a status and a readable message
+func userFacingError(err error) (int, string) {
+	for _, e := range userFacingErrors {
+		if errors.Is(err, e.err) {
+			return e.code, e.message
+		}
+	}
+	return http.StatusInternalServerError, "An unexpected error has occurred."
+}
+
+// redirectToError sends the user to /error with a readable message for known domain errors
+func redirectToError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := userFacingError(err)
+
+	query := url.Values{}
+	query.Set("code", strconv.Itoa(code))
+	query.Set("msg", message)
+	http.Redirect(w, r, "/error?"+query.Encode(), http.StatusSeeOther)
+}
+
 func (h *Handler) ErrorPage(w http.ResponseWriter, r *http.Request) {
 	const ep = "ErrorPage"
 
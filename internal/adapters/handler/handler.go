@@ -6,20 +6,31 @@ package handler
 import (
 	"1337b04rd/internal/domain/port"
 	"log/slog"
+	"time"
 )
 
 type Handler struct {
 	postService    port.PostService
 	commentService port.CommentService
+	boardService   port.BoardService
 	sessionService port.SessionService
+	uploader       port.ImageUploader
+	avatars        port.AvatarRenderer
+	tripcodes      port.Tripcoder
+	editWindow     time.Duration // only decides whether edit links are shown, the services enforce it
 	logger         *slog.Logger
 }
 
-func NewHandler(post port.PostService, comment port.CommentService, session port.SessionService, logger *slog.Logger) *Handler {
+func NewHandler(post port.PostService, comment port.CommentService, board port.BoardService, session port.SessionService, uploader port.ImageUploader, avatars port.AvatarRenderer, tripcodes port.Tripcoder, editWindow time.Duration, logger *slog.Logger) *Handler {
 	return &Handler{
 		postService:    post,
 		commentService: comment,
+		boardService:   board,
 		sessionService: session,
+		uploader:       uploader,
+		avatars:        avatars,
+		tripcodes:      tripcodes,
+		editWindow:     editWindow,
 		logger:         logger,
 	}
 }
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// One thread or comment on the /me page, also the JSON shape of /api/me
+type activityEntry struct {
+	ID                string    `json:"id"`
+	PostID            string    `json:"post_id"`
+	Title             string    `json:"title"` // thread title, for comments the thread they are in
+	Content           string    `json:"content"`
+	URL               string    `json:"url"`
+	Thumbnail         string    `json:"thumbnail,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	Archived          bool      `json:"archived"`
+	Replies           int       `json:"replies"`
+	ArchivesInSeconds int       `json:"archives_in_seconds"` // 0 once the thread is archived
+}
+
+// Left until archival, rounded for people
+func (e activityEntry) ArchivesIn() string {
+	return (time.Duration(e.ArchivesInSeconds) * time.Second).Round(time.Minute).String()
+}
+
+type activityPage struct {
+	Threads  []activityEntry `json:"threads"`
+	Comments []activityEntry `json:"comments"`
+}
+
+// GET /me
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	const fn = "Me"
+
+	if r.Method != http.MethodGet {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := h.sessionActivity(r)
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to get session activity", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	tpl, err := template.ParseFiles(templates["me"])
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session  *middleware.SessionData
+		Threads  []activityEntry
+		Comments []activityEntry
+	}{
+		Session:  CheckAndReturnSession(w, r, h.logger, fn),
+		Threads:  page.Threads,
+		Comments: page.Comments,
+	}
+
+	if err := tpl.Execute(w, data); err != nil {
+		utils.LogError(h.logger, fn, "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
+
+// GET /api/me
+func (h *Handler) MeAPI(w http.ResponseWriter, r *http.Request) {
+	const fn = "MeAPI"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := h.sessionActivity(r)
+	if err != nil {
+		h.writeJSONError(w, fn, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Visitors without a session have written nothing, they get empty lists without a db query
+func (h *Handler) sessionActivity(r *http.Request) (*activityPage, error) {
+	page := &activityPage{Threads: []activityEntry{}, Comments: []activityEntry{}}
+
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return page, nil
+	}
+
+	activity, err := h.postService.GetSessionActivity(r.Context(), session.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, t := range activity.Threads {
+		page.Threads = append(page.Threads, activityEntry{
+			ID:                string(t.Post.PostID),
+			PostID:            string(t.Post.PostID),
+			Title:             t.Post.Title,
+			Content:           t.Post.Content,
+			URL:               t.Post.URL(),
+			Thumbnail:         t.Post.Thumbnail(),
+			CreatedAt:         t.Post.CreatedAt,
+			Archived:          t.Post.IsArchived,
+			Replies:           t.ReplyCount,
+			ArchivesInSeconds: int(t.ArchivesIn(now).Seconds()),
+		})
+	}
+	for _, c := range activity.Comments {
+		page.Comments = append(page.Comments, activityEntry{
+			ID:                string(c.Comment.CommentID),
+			PostID:            string(c.Comment.PostID),
+			Title:             c.Thread.Post.Title,
+			Content:           c.Comment.Content,
+			URL:               c.Thread.Post.URL() + "#" + string(c.Comment.CommentID),
+			Thumbnail:         firstThumbnail(c.Comment),
+			CreatedAt:         c.Comment.CreatedAt,
+			Archived:          c.Comment.IsArchived,
+			Replies:           c.ReplyCount,
+			ArchivesInSeconds: int(c.Thread.ArchivesIn(now).Seconds()),
+		})
+	}
+	return page, nil
+}
+
+func firstThumbnail(c *model.Comment) string {
+	if images := c.Images(); len(images) > 0 {
+		return images[0].ThumbnailURL
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Uploads never overwrite existing objects, so browsers can cache them for a year
+const mediaCacheControl = "public, max-age=31536000, immutable"
+
+// GET /media/{key}
+func (h *Handler) Media(w http.ResponseWriter, r *http.Request) {
+	const fn = "Media"
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// ServeMux already cleans the path, uploader still rejects keys that escape the storage root
+	key := strings.TrimPrefix(r.URL.Path, "/media/")
+
+	image, err := h.uploader.OpenImage(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidInput):
+			utils.LogWarn(h.logger, fn, "rejected media path", "path", r.URL.Path)
+			http.Error(w, "invalid media path", http.StatusBadRequest)
+		case errors.Is(err, model.ErrNotFound):
+			http.NotFound(w, r)
+		default:
+			utils.LogError(h.logger, fn, "failed to open image", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Cache-Control", mediaCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", image.ETag)
+
+	// ServeContent takes care of Range, If-None-Match, If-Modified-Since and Last-Modified
+	http.ServeContent(w, r, image.Key, image.ModTime, bytes.NewReader(image.Data))
+}
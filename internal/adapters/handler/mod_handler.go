@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"1337b04rd/pkg/utils"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// /mod/posts/{id}/...
+// GET goes to the revision history, POST to a thread action
+func (h *Handler) Moderation(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.ModerateThread(w, r)
+		return
+	}
+	h.ThreadRevisions(w, r)
+}
+
+// POST /mod/posts/{id}/{sticky|unsticky|lock|unlock}
+func (h *Handler) ModerateThread(w http.ResponseWriter, r *http.Request) {
+	const fn = "ModerateThread"
+
+	if r.Method != http.MethodPost {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/mod/posts/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	postID := utils.UUID(parts[0])
+	var err error
+	switch parts[1] {
+	case "sticky", "unsticky":
+		err = h.postService.SetSticky(r.Context(), postID, parts[1] == "sticky")
+	case "lock", "unlock":
+		err = h.postService.SetLocked(r.Context(), postID, parts[1] == "lock")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to "+parts[1]+" thread", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/mod/posts/"+string(postID)+"/revisions", http.StatusSeeOther)
+}
+
+// GET /mod/posts/{id}/revisions
+// Edit history of a thread, behind the moderator middleware
+func (h *Handler) ThreadRevisions(w http.ResponseWriter, r *http.Request) {
+	const fn = "ThreadRevisions"
+
+	if r.Method != http.MethodGet {
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/mod/posts/"), "/revisions")
+	if postID == "" || strings.Contains(postID, "/") || !strings.HasSuffix(r.URL.Path, "/revisions") {
+		http.NotFound(w, r)
+		return
+	}
+
+	history, err := h.postService.GetThreadRevisions(r.Context(), utils.UUID(postID))
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to get revisions", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	tpl, err := template.ParseFiles(templates["revisions"])
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+	if err := tpl.Execute(w, history); err != nil {
+		utils.LogError(h.logger, fn, "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
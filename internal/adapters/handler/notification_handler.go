@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// One unread reply on the /notifications page, also the JSON shape of /api/notifications
+type notificationEntry struct {
+	ID            string    `json:"id"` // the reply, also what marks it read
+	PostID        string    `json:"post_id"`
+	Title         string    `json:"title"` // thread the reply is in
+	UserName      string    `json:"user_name"`
+	Tripcode      string    `json:"tripcode,omitempty"`
+	Content       string    `json:"content"`
+	ParentContent string    `json:"parent_content"` // your comment that was answered
+	URL           string    `json:"url"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// GET, POST /notifications
+// POST with action=read marks the replies in the "id" fields read, action=read-all every reply
+func (h *Handler) Notifications(w http.ResponseWriter, r *http.Request) {
+	const fn = "Notifications"
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var ids []utils.UUID
+		switch r.FormValue("action") {
+		case "read":
+			for _, id := range r.Form["id"] {
+				ids = append(ids, utils.UUID(id))
+			}
+			if len(ids) == 0 {
+				redirectToError(w, r, model.ErrInvalidInput)
+				return
+			}
+		case "read-all":
+		default:
+			redirectToError(w, r, model.ErrInvalidInput)
+			return
+		}
+		if err := h.markRepliesRead(r, ids); err != nil {
+			utils.LogError(h.logger, fn, "failed to mark replies read", err)
+			redirectToError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+		return
+	default:
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := h.unreadReplies(r)
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to get notifications", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	tpl, err := template.ParseFiles(templates["notifications"])
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session *middleware.SessionData
+		Replies []notificationEntry
+	}{
+		Session: CheckAndReturnSession(w, r, h.logger, fn),
+		Replies: entries,
+	}
+
+	if err := tpl.Execute(w, data); err != nil {
+		utils.LogError(h.logger, fn, "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
+
+// GET /api/notifications
+// POST /api/notifications with {"ids": [...]} or {"all": true}
+func (h *Handler) NotificationsAPI(w http.ResponseWriter, r *http.Request) {
+	const fn = "NotificationsAPI"
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := h.unreadReplies(r)
+		if err != nil {
+			h.writeJSONError(w, fn, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]notificationEntry{"replies": entries})
+
+	case http.MethodPost:
+		var body struct {
+			IDs []utils.UUID `json:"ids"`
+			All bool         `json:"all"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			h.writeJSONError(w, fn, model.ErrInvalidInput)
+			return
+		}
+		// An empty list must not be read as "all"
+		if body.All == (len(body.IDs) > 0) {
+			h.writeJSONError(w, fn, model.ErrInvalidInput)
+			return
+		}
+		if err := h.markRepliesRead(r, body.IDs); err != nil {
+			h.writeJSONError(w, fn, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Visitors without a session have no comments anyone could answer
+func (h *Handler) unreadReplies(r *http.Request) ([]notificationEntry, error) {
+	entries := []notificationEntry{}
+
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return entries, nil
+	}
+
+	notifications, err := h.commentService.GetUnreadReplies(r.Context(), session.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range notifications {
+		entries = append(entries, notificationEntry{
+			ID:            string(n.Reply.CommentID),
+			PostID:        string(n.Reply.PostID),
+			Title:         n.PostTitle,
+			UserName:      n.Reply.UserName,
+			Tripcode:      n.Reply.Tripcode,
+			Content:       n.Reply.Content,
+			ParentContent: n.ParentContent,
+			URL:           "/posts/" + string(n.Reply.PostID) + "#" + string(n.Reply.CommentID),
+			CreatedAt:     n.CreatedAt,
+		})
+	}
+	return entries, nil
+}
+
+// No IDs marks every reply read
+func (h *Handler) markRepliesRead(r *http.Request, ids []utils.UUID) error {
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return model.ErrSessionNotFound
+	}
+	return h.commentService.MarkRepliesRead(r.Context(), session.SessionID, ids)
+}
@@ -7,96 +7,77 @@ import (
 	"html/template"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-// GET /
-func (h *Handler) Catalog(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		utils.LogWarn(h.logger, "Catalog", "invalid method", "method", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// GET /{board}/ and /{board}/archive, ?after= and ?before= page through them
+func (h *Handler) catalog(w http.ResponseWriter, r *http.Request, board *model.Board, archived bool) {
+	fn, tplName := "Catalog", templates["catalog"]
+	if archived {
+		fn, tplName = "Archive", templates["archive"]
 	}
 
-	session := CheckAndReturnSession(w, r, h.logger, "Catalog")
+	session := CheckAndReturnSession(w, r, h.logger, fn)
 	if session == nil {
 		return
 	}
 
-	posts, err := h.postService.GetAllPosts(r.Context(), false) // false = not archived
+	page, err := h.postService.ListPosts(r.Context(), board.BoardID, archived, pageRequest(r))
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to get posts", err)
+		redirectToError(w, r, err)
+		return
+	}
+
+	// Every page links to the other boards
+	boards, err := h.boardService.GetBoards(r.Context())
 	if err != nil {
-		utils.LogError(h.logger, "Catalog", "failed to get posts", err)
+		utils.LogError(h.logger, fn, "failed to get boards", err)
 		http.Redirect(w, r, "/error", http.StatusSeeOther)
 		return
 	}
 
-	tpl, err := template.ParseFiles(templates["catalog"])
+	tpl, err := template.ParseFiles(tplName)
 	if err != nil {
-		utils.LogError(h.logger, "Catalog", "failed to load template", err)
+		utils.LogError(h.logger, fn, "failed to load template", err)
 		http.Error(w, "Template load error", http.StatusInternalServerError)
 		return
 	}
 
 	data := struct {
 		Session *middleware.SessionData // avatar
+		Board   *model.Board
+		Boards  []model.Board
 		Posts   []*model.Post
+		Next    string // cursors for the page links, empty at the ends
+		Prev    string
 	}{
-		Session: &middleware.SessionData{AvatarURL: session.AvatarURL},
-		Posts:   posts,
+		Session: session,
+		Board:   board,
+		Boards:  boards,
+		Posts:   page.Posts,
+		Next:    page.Next,
+		Prev:    page.Prev,
 	}
 
 	// Renders the catalog page with data struct
 	if err := tpl.Execute(w, data); err != nil {
-		utils.LogError(h.logger, "Catalog", "failed to render template", err)
+		utils.LogError(h.logger, fn, "failed to render template", err)
 		http.Error(w, "render error", http.StatusInternalServerError)
 	}
-	utils.LogInfo(h.logger, "Catalog", "served catalog page")
+	utils.LogInfo(h.logger, fn, "served catalog page", "board", board.Slug)
 }
 
-// GET /archive
-func (h *Handler) Archive(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		utils.LogWarn(h.logger, "Archive", "invalid method", "method", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	session := CheckAndReturnSession(w, r, h.logger, "Catalog")
-	if session == nil {
-		return
-	}
-
-	posts, err := h.postService.GetAllPosts(r.Context(), true)
-	if err != nil {
-		utils.LogError(h.logger, "Archive", "failed to get archived posts", err)
-		http.Redirect(w, r, "/error", http.StatusSeeOther)
-		return
-	}
-
-	tpl, err := template.ParseFiles(templates["archive"])
-	if err != nil {
-		utils.LogError(h.logger, "Archive", "failed to load template", err)
-		http.Error(w, "Template load error", http.StatusInternalServerError)
-		return
-	}
-
-	data := struct {
-		Session *middleware.SessionData
-		Posts   any
-	}{
-		Session: &middleware.SessionData{AvatarURL: session.AvatarURL},
-		Posts:   posts,
-	}
-
-	if err := tpl.Execute(w, data); err != nil {
-		utils.LogError(h.logger, "Archive", "failed to render template", err)
-		http.Error(w, "render error", http.StatusInternalServerError)
-	}
-	utils.LogInfo(h.logger, "Archive", "served archive page")
+// Cursors and page size from the query string, the service checks them
+func pageRequest(r *http.Request) model.PageRequest {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	return model.PageRequest{After: query.Get("after"), Before: query.Get("before"), Limit: limit}
 }
 
 // GET /posts/{id}
+// Thread pages live under their board, old links are sent there
 func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		utils.LogWarn(h.logger, "Post", "invalid method", "method", r.Method)
@@ -104,13 +85,23 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	postID := strings.TrimPrefix(r.URL.Path, "/posts/")
+	post, err := h.postService.GetPostByID(r.Context(), utils.UUID(postID))
+	if err != nil {
+		utils.LogError(h.logger, "Post", "failed to get post", err)
+		redirectToError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+}
+
+// GET /{board}/posts/{id}
+func (h *Handler) thread(w http.ResponseWriter, r *http.Request, board *model.Board, postID string) {
 	session := CheckAndReturnSession(w, r, h.logger, "Post")
 	if session == nil {
 		return
 	}
 
-	// Extract post ID from path
-	postID := r.URL.Path[len("/posts/"):]
 	if postID == "" {
 		utils.LogError(h.logger, "Post", "missing post ID", nil)
 		http.Error(w, "missing post ID", http.StatusBadRequest)
@@ -124,6 +115,11 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/error", http.StatusSeeOther)
 		return
 	}
+	// Same thread under another board's slug
+	if post.BoardID != board.BoardID {
+		http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+		return
+	}
 
 	// Fetch the comments
 	comments, err := h.commentService.GetCommentsByPostID(r.Context(), post.PostID, post.IsArchived)
@@ -145,14 +141,21 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	mine, editable := h.ownPosts(r, post, comments)
 	data := struct {
+		Board    *model.Board
 		Post     *model.Post
 		Comments []*model.Comment
 		Session  *middleware.SessionData
+		Mine     map[utils.UUID]bool // posts of the visitor, shown as "(You)"
+		Editable map[utils.UUID]bool // the visitor's posts still inside the edit window
 	}{
+		Board:    board,
 		Post:     post,
 		Comments: comments,
-		Session:  &middleware.SessionData{AvatarURL: session.AvatarURL},
+		Session:  session,
+		Mine:     mine,
+		Editable: editable,
 	}
 
 	if err := tpl.Execute(w, data); err != nil {
@@ -162,7 +165,7 @@ func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
 	utils.LogInfo(h.logger, "Post", "served post page")
 }
 
-// GET /create
+// GET /create, ?board= preselects the board
 func (h *Handler) CreatePostForm(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		utils.LogWarn(h.logger, "CreatePostForm", "invalid method", "method", r.Method)
@@ -175,6 +178,13 @@ func (h *Handler) CreatePostForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	boards, err := h.boardService.GetBoards(r.Context())
+	if err != nil {
+		utils.LogError(h.logger, "CreatePostForm", "failed to get boards", err)
+		http.Redirect(w, r, "/error", http.StatusSeeOther)
+		return
+	}
+
 	tpl, err := template.ParseFiles(templates["create-post"])
 	if err != nil {
 		utils.LogError(h.logger, "CreatePostForm", "failed to load template", err)
@@ -183,9 +193,13 @@ func (h *Handler) CreatePostForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Session *middleware.SessionData
+		Session  *middleware.SessionData
+		Boards   []model.Board
+		Selected string // slug of the board the visitor came from
 	}{
-		Session: &middleware.SessionData{AvatarURL: session.AvatarURL},
+		Session:  session,
+		Boards:   boards,
+		Selected: r.URL.Query().Get("board"),
 	}
 
 	if err := tpl.Execute(w, data); err != nil {
@@ -204,10 +218,9 @@ func (h *Handler) SubmitPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session := middleware.GetSessionFromContext(r.Context())
+	// First write of a visitor creates the session
+	session := requireSession(w, r, h.logger, "SubmitPost")
 	if session == nil {
-		utils.LogError(h.logger, "SubmitPost", "session not found", nil)
-		http.Error(w, "session not found", http.StatusUnauthorized)
 		return
 	}
 
@@ -222,7 +235,8 @@ func (h *Handler) SubmitPost(w http.ResponseWriter, r *http.Request) {
 	// Get text input from html files
 	title := r.FormValue("subject")
 	content := r.FormValue("comment")
-	name := r.FormValue("name")
+	// "Name#secret" carries a tripcode secret, it stays in this function
+	name, secret, secure := model.SplitNameField(r.FormValue("name"))
 
 	// Create imageData for service methods
 	var imageData map[string]io.Reader
@@ -235,19 +249,20 @@ func (h *Handler) SubmitPost(w http.ResponseWriter, r *http.Request) {
 		imageData = map[string]io.Reader{fileHeader.Filename: file}
 	}
 
-	// If user entered a new name → override stored name
-	if name != "" {
-		if err := h.sessionService.OverrideUserName(r.Context(), session.SessionID, name); err != nil {
-			utils.LogError(h.logger, "SubmitPost", "failed to override username", err)
-			http.Redirect(w, r, "/error", http.StatusSeeOther)
+	// Name is stored on the session, every post of the session shows it
+	if name != "" && name != session.DisplayName {
+		if err := h.sessionService.SetDisplayName(r.Context(), session.SessionID, name); err != nil {
+			utils.LogError(h.logger, "SubmitPost", "failed to set display name", err)
+			redirectToError(w, r, err)
 			return
 		}
 	}
 
 	// Create the post model
 	post := &model.Post{
+		BoardSlug: r.FormValue("board"),
 		SessionID: session.SessionID,
-		UserName:  name, // If blank, default will be preserved
+		Tripcode:  h.tripcodes.Tripcode(secret, secure),
 		Title:     title,
 		Content:   content,
 	}
@@ -255,10 +270,32 @@ func (h *Handler) SubmitPost(w http.ResponseWriter, r *http.Request) {
 	// Crete the post
 	if err := h.postService.CreatePost(r.Context(), post, imageData); err != nil {
 		utils.LogError(h.logger, "SubmitPost", "failed to create post", err)
-		http.Redirect(w, r, "/error", http.StatusSeeOther)
+		redirectToError(w, r, err)
 		return
 	}
 	utils.LogInfo(h.logger, "SubmitPost", "post created", "post_id", string(post.PostID))
 	// Redirect to the new post page
-	http.Redirect(w, r, "/posts/"+string(post.PostID), http.StatusSeeOther)
+	http.Redirect(w, r, post.URL(), http.StatusSeeOther)
+}
+
+// Session IDs stay on the server, templates only learn which post and comment IDs are the visitor's
+func (h *Handler) ownPosts(r *http.Request, post *model.Post, comments []*model.Comment) (mine, editable map[utils.UUID]bool) {
+	mine = make(map[utils.UUID]bool)
+	editable = make(map[utils.UUID]bool)
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return mine, editable
+	}
+
+	if post.SessionID == session.SessionID {
+		mine[post.PostID] = true
+		editable[post.PostID] = !post.IsArchived && model.CanEdit(post.CreatedAt, h.editWindow)
+	}
+	for _, c := range comments {
+		if c.SessionID == session.SessionID {
+			mine[c.CommentID] = true
+			editable[c.CommentID] = !c.IsArchived && !c.IsDeleted && model.CanEdit(c.CreatedAt, h.editWindow)
+		}
+	}
+	return mine, editable
 }
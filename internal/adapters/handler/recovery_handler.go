@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+)
+
+// GET, POST /recovery
+// One page to generate, redeem and revoke recovery codes, the form field "action" picks the operation
+func (h *Handler) Recovery(w http.ResponseWriter, r *http.Request) {
+	const fn = "Recovery"
+
+	var code, notice string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var err error
+		switch r.FormValue("action") {
+		case "generate":
+			code, err = h.issueRecoveryCode(w, r)
+		case "redeem":
+			err = h.redeemRecoveryCode(r, r.FormValue("code"))
+			notice = "Welcome back, your session moved to this browser. The browser that generated the code is signed out."
+		case "revoke":
+			err = h.revokeRecoveryCodes(r)
+			notice = "Unused recovery codes were revoked."
+		default:
+			err = model.ErrInvalidInput
+		}
+		if err != nil {
+			utils.LogError(h.logger, fn, "recovery action failed", err)
+			redirectToError(w, r, err)
+			return
+		}
+	default:
+		utils.LogWarn(h.logger, fn, "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tpl, err := template.ParseFiles(templates["recovery"])
+	if err != nil {
+		utils.LogError(h.logger, fn, "failed to load template", err)
+		http.Error(w, "Template load error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session *middleware.SessionData
+		Code    string // shown once, right after it was generated
+		Notice  string
+	}{
+		Session: CheckAndReturnSession(w, r, h.logger, fn),
+		Code:    code,
+		Notice:  notice,
+	}
+
+	// The page may hold a fresh code, keep it out of caches and history
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tpl.Execute(w, data); err != nil {
+		utils.LogError(h.logger, fn, "failed to render template", err)
+		http.Error(w, "render error", http.StatusInternalServerError)
+	}
+}
+
+// POST, DELETE /api/recovery
+// POST /api/recovery/redeem with {"code": "..."}
+func (h *Handler) RecoveryAPI(w http.ResponseWriter, r *http.Request) {
+	const fn = "RecoveryAPI"
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case r.URL.Path == "/api/recovery" && r.Method == http.MethodPost:
+		code, err := h.issueRecoveryCode(w, r)
+		if err != nil {
+			h.writeJSONError(w, fn, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"code": code})
+
+	case r.URL.Path == "/api/recovery" && r.Method == http.MethodDelete:
+		if err := h.revokeRecoveryCodes(r); err != nil {
+			h.writeJSONError(w, fn, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.URL.Path == "/api/recovery/redeem" && r.Method == http.MethodPost:
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil {
+			h.writeJSONError(w, fn, model.ErrInvalidInput)
+			return
+		}
+		if err := h.redeemRecoveryCode(r, body.Code); err != nil {
+			h.writeJSONError(w, fn, err)
+			return
+		}
+		session := middleware.GetSessionFromContext(r.Context())
+		writeJSON(w, http.StatusOK, map[string]string{
+			"display_name": session.DisplayName,
+			"avatar_url":   session.AvatarURL,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Asking for a code is asking for an identity, visitors without a session get one here
+func (h *Handler) issueRecoveryCode(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, err := middleware.RequireSession(r)
+	if err != nil {
+		return "", err
+	}
+	return h.sessionService.IssueRecoveryCode(r.Context(), session.SessionID)
+}
+
+// Redeeming moves the session, it is not linked: the ID is rotated, so the browser
+// that generated the code is signed out, and this browser's previous session is dropped
+// The code itself is never logged
+func (h *Handler) redeemRecoveryCode(r *http.Request, code string) error {
+	session, err := h.sessionService.RedeemRecoveryCode(r.Context(), code, clientIP(r))
+	if err != nil {
+		return err
+	}
+	return middleware.SwitchSession(r, session)
+}
+
+func (h *Handler) revokeRecoveryCodes(r *http.Request) error {
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return model.ErrSessionNotFound
+	}
+	return h.sessionService.RevokeRecoveryCodes(r.Context(), session.SessionID)
+}
+
+// Rate limits key on the peer address, or on TRUSTED_PROXY_HEADER as ClientIPMiddleware put it there
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *Handler) writeJSONError(w http.ResponseWriter, fn string, err error) {
+	utils.LogError(h.logger, fn, "request failed", err)
+	code, message := userFacingError(err)
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -2,18 +2,44 @@ package handler
 
 import (
 	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"log/slog"
 	"net/http"
 )
 
-// CheckAndReturnSession safely extracts the session and logs error if missing.
+// CheckAndReturnSession returns what templates show about the visitor
+// Visitors without a session get an ephemeral anonymous one, reading never creates a session
 func CheckAndReturnSession(w http.ResponseWriter, r *http.Request, logger *slog.Logger, functionName string) *middleware.SessionData {
 	session := middleware.GetSessionFromContext(r.Context())
 	if session == nil {
-		utils.LogError(logger, functionName, "session not found", nil)
-		http.Error(w, "session not found", http.StatusUnauthorized)
+		return &middleware.SessionData{Ephemeral: true}
+	}
+	return &middleware.SessionData{AvatarURL: session.AvatarURL, DisplayName: session.DisplayName}
+}
+
+// requireSession materializes the visitor's session for write paths, reports the failure itself
+func requireSession(w http.ResponseWriter, r *http.Request, logger *slog.Logger, functionName string) *model.Session {
+	session, err := middleware.RequireSession(r)
+	if err != nil {
+		utils.LogError(logger, functionName, "failed to create session", err)
+		http.Error(w, "Failed to initialize session", http.StatusInternalServerError)
 		return nil
 	}
-	return &middleware.SessionData{AvatarURL: session.AvatarURL}
+	return session
+}
+
+// POST /session
+// Gives the visitor an identity without posting anything
+func (h *Handler) CreateIdentity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.LogWarn(h.logger, "CreateIdentity", "invalid method", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if session := requireSession(w, r, h.logger, "CreateIdentity"); session == nil {
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -1,10 +1,16 @@
 package handler
 
 var templates = map[string]string{
-	"archive-post": "static/archive-post.html",
-	"archive":      "static/archive.html",
-	"catalog":      "static/catalog.html",
-	"create-post":  "static/create-post.html",
-	"error":        "static/error.html",
-	"post":         "static/post.html",
+	"archive-post":  "static/archive-post.html",
+	"archive":       "static/archive.html",
+	"boards":        "static/boards.html",
+	"catalog":       "static/catalog.html",
+	"create-post":   "static/create-post.html",
+	"edit":          "static/edit.html",
+	"error":         "static/error.html",
+	"me":            "static/me.html",
+	"notifications": "static/notifications.html",
+	"post":          "static/post.html",
+	"recovery":      "static/recovery.html",
+	"revisions":     "static/revisions.html",
 }
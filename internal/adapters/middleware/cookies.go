@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
+	"1337b04rd/pkg/securecookie"
+	"1337b04rd/pkg/utils"
+	"net/http"
+)
+
+// Cookie attributes, taken from config
+type CookieOptions struct {
+	Name     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// SessionCookies reads and writes the signed session cookie
+type SessionCookies struct {
+	codec *securecookie.Codec
+	opts  CookieOptions
+}
+
+func NewSessionCookies(codec *securecookie.Codec, opts CookieOptions) *SessionCookies {
+	return &SessionCookies{codec: codec, opts: opts}
+}
+
+// Read returns the session ID only if the cookie was signed by one of our keys
+func (c *SessionCookies) Read(r *http.Request) (utils.UUID, error) {
+	cookie, err := r.Cookie(c.opts.Name)
+	if err != nil {
+		return "", err
+	}
+	value, err := c.codec.Decode(c.opts.Name, cookie.Value)
+	if err != nil {
+		return "", err
+	}
+	return utils.UUID(value), nil
+}
+
+// Write signs the session ID with the current key
+func (c *SessionCookies) Write(w http.ResponseWriter, session *model.Session) error {
+	value, err := c.codec.Encode(c.opts.Name, string(session.SessionID))
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.opts.Name,
+		Value:    value,
+		Path:     "/",
+		Domain:   c.opts.Domain,
+		HttpOnly: true,
+		SameSite: c.opts.SameSite,
+		Secure:   c.opts.Secure,
+		Expires:  session.ExpiresAt,
+	})
+	return nil
+}
+
+// Rotate gives the session a new ID and cookie, called on privilege changes
+// so an ID that leaked before the change is worthless after it
+func (c *SessionCookies) Rotate(w http.ResponseWriter, r *http.Request, sessionService port.SessionService, session *model.Session) error {
+	rotated, err := sessionService.RotateSessionID(r.Context(), session.SessionID)
+	if err != nil {
+		return err
+	}
+	*session = *rotated
+	return c.Write(w, session)
+}
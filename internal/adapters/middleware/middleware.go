@@ -1,4 +1,4 @@
-// Ensures that every visitor has valid session, and that session stored in the context
+// Loads the visitor's session into the context, new sessions are created lazily
 // Runs before handlers
 package middleware
 
@@ -6,13 +6,10 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/internal/domain/port"
 	"context"
+	"log/slog"
 	"net/http"
-
-	"1337b04rd/pkg/utils"
 )
 
-const sessionCookieName = "session_id"
-
 // Custom key type used for storing values in context.Context
 // To avoid name collision
 type sessionKeyType string
@@ -21,68 +18,113 @@ const sessionKey sessionKeyType = "user-session"
 
 // Struct because I can add more data later (e.g. UserName, Role, etc)
 type SessionData struct {
-	AvatarURL string
+	AvatarURL   string
+	DisplayName string // empty until the visitor picks a name
+	Ephemeral   bool   // visitor has no session yet, pages render for an anonymous reader
 }
 
-// Why do I need this and why can't I pass just avaratURL var for example?
+// Per request session state, the session itself is created only when a handler asks for it
+type sessionState struct {
+	session  *model.Session
+	create   func() (*model.Session, error)
+	switchTo func(*model.Session) error // moves another session to this visitor
+}
 
 // This returns middleware function that takes and wraps another http.Handler
-func SessionMiddleware(sessionService port.SessionService) func(http.Handler) http.Handler {
+// Visitors without a cookie browse with no session at all, nothing is written for crawlers and health checks
+func SessionMiddleware(sessionService port.SessionService, cookies *SessionCookies, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler { // standard go middleware signature
 		// my logic BEFORE the handler
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Try to read existing cookie
-			cookie, err := r.Cookie(sessionCookieName)
+			state := &sessionState{}
 
-			var session *model.Session
-
-			// CASE 1: Cookie exists → fetch session from DB
+			// Cookie exists and its signature checks out → fetch session from DB
+			// Forged or tampered cookies never reach the db
+			sessionID, err := cookies.Read(r)
+			if err != nil && err != http.ErrNoCookie {
+				logger.Warn("rejected session cookie", slog.String("remote_addr", r.RemoteAddr), slog.Any("error", err))
+			}
 			if err == nil {
-				// If cookie is present, convert it to UUID type
-				sessionID := utils.UUID(cookie.Value)
-
-				// Fetch session from the db
 				s, err := sessionService.GetSessionByID(r.Context(), sessionID)
 				if err == nil {
-					session = s
+					state.session = s
+					renewSession(w, r, sessionService, cookies, s, logger)
 				}
 			}
 
-			// CASE 2: No valid session → create one
-			if session == nil {
+			// No valid session → one is made on first write, see RequireSession
+			state.create = func() (*model.Session, error) {
 				newSession := &model.Session{}
-				err := sessionService.CreateSession(r.Context(), newSession)
-				if err != nil {
-					http.Error(w, "Failed to initialize session", http.StatusInternalServerError)
-					return
+				if err := sessionService.CreateSession(r.Context(), newSession); err != nil {
+					return nil, err
 				}
-				session = newSession
+				if err := cookies.Write(w, newSession); err != nil {
+					return nil, err
+				}
+				return newSession, nil
+			}
 
-				// Set cookie
-				http.SetCookie(w, &http.Cookie{
-					Name:     sessionCookieName,         // Cookie key
-					Value:    string(session.SessionID), // Cookie value
-					Path:     "/",
-					HttpOnly: true,
-					SameSite: http.SameSiteStrictMode,
-					Secure:   false,
-					Expires:  session.ExpiresAt,
-				})
+			state.switchTo = func(s *model.Session) error {
+				return cookies.Rotate(w, r, sessionService, s)
 			}
 
-			// Add session to context
-			ctx := context.WithValue(r.Context(), sessionKey, session)
+			// Add session state to context
+			ctx := context.WithValue(r.Context(), sessionKey, state)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			// my logic AFTER the handler
 		})
 	}
 }
 
-// Allows handlers to retrieve session
+// Extended sessions get a new cookie with the later expiry, a failed renewal only costs the extension
+func renewSession(w http.ResponseWriter, r *http.Request, sessionService port.SessionService, cookies *SessionCookies, session *model.Session, logger *slog.Logger) {
+	renewed, err := sessionService.RenewSession(r.Context(), session)
+	if err != nil {
+		logger.Warn("failed to renew session", slog.Any("error", err))
+		return
+	}
+	if renewed {
+		if err := cookies.Write(w, session); err != nil {
+			logger.Warn("failed to re-issue session cookie", slog.Any("error", err))
+		}
+	}
+}
+
+// Allows handlers to retrieve session, nil for visitors that never wrote anything
 func GetSessionFromContext(ctx context.Context) *model.Session {
-	val := ctx.Value(sessionKey)
-	if session, ok := val.(*model.Session); ok {
-		return session
+	if state, ok := ctx.Value(sessionKey).(*sessionState); ok {
+		return state.session
+	}
+	return nil
+}
+
+// RequireSession returns the visitor's session, creating it and setting the cookie on first use
+// Must be called before anything is written to the response
+func RequireSession(r *http.Request) (*model.Session, error) {
+	state, ok := r.Context().Value(sessionKey).(*sessionState)
+	if !ok {
+		return nil, model.ErrSessionNotFound
+	}
+	if state.session == nil {
+		session, err := state.create()
+		if err != nil {
+			return nil, err
+		}
+		state.session = session
+	}
+	return state.session, nil
+}
+
+// SwitchSession moves another session to the visitor, used when a recovery code is redeemed
+// The session gets a fresh ID on the way, so browsers still holding the old one lose it
+func SwitchSession(r *http.Request, session *model.Session) error {
+	state, ok := r.Context().Value(sessionKey).(*sessionState)
+	if !ok {
+		return model.ErrSessionNotFound
+	}
+	if err := state.switchTo(session); err != nil {
+		return err
 	}
+	state.session = session
 	return nil
 }
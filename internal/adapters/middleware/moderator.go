@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// ModeratorMiddleware guards moderation pages with HTTP Basic auth, any user name with the configured password
+// Without a password the pages don't exist at all, changes are only taken from pages of the site itself
+func ModeratorMiddleware(password string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if password == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			_, given, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+				if ok {
+					logger.Warn("rejected moderator password", slog.String("remote_addr", r.RemoteAddr))
+				}
+				w.Header().Set("WWW-Authenticate", `Basic realm="1337b04rd moderation", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// Browsers resend Basic credentials on any request to the site, even one a foreign page triggers
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+				logger.Warn("rejected cross-site moderator request", slog.String("remote_addr", r.RemoteAddr))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sameOrigin tells whether the request comes from a page of this site, by Origin or else Referer
+// Requests that send neither are refused, every browser sends one of them on form posts
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Referer()
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
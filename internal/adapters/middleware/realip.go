@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPMiddleware takes the client address from a header set by the reverse proxy in front
+// The last entry is the one the proxy added, earlier ones come from the client and may be forged
+// Without a header name, or when the value is not an IP, the peer address stays
+func ClientIPMiddleware(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if header == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values := strings.Split(r.Header.Get(header), ",")
+			if ip := net.ParseIP(strings.TrimSpace(values[len(values)-1])); ip != nil {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/lib/pq"
+)
+
+// Boards are set up in init.sql, the app only reads them
+type PostgresBoardRepo struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// Constructor
+func NewPostgresBoardRepo(db *sql.DB, logger *slog.Logger) *PostgresBoardRepo {
+	return &PostgresBoardRepo{db: db, logger: logger}
+}
+
+// Lifetimes are stored in minutes and selected in nanoseconds, they scan straight into time.Duration
+const (
+	boardColumns = `b.board_id, b.slug, b.title, b.description, b.is_nsfw, b.max_threads, b.bump_limit,
+	       b.lifetime_minutes * 60000000000::bigint, b.lifetime_reply_minutes * 60000000000::bigint, b.allowed_types`
+
+	// Board fields every post carries, for posts aliased p joined with boards b
+	postBoardColumns = `p.board_id, b.slug, b.lifetime_minutes * 60000000000::bigint, b.lifetime_reply_minutes * 60000000000::bigint`
+)
+
+func (r *PostgresBoardRepo) GetBoards(ctx context.Context) ([]model.Board, error) {
+	query := `SELECT ` + boardColumns + ` FROM boards b ORDER BY b.slug`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetBoards", "select from boards", dbError(err))
+	}
+	defer rows.Close()
+
+	var boards []model.Board
+	for rows.Next() {
+		board, err := scanBoard(rows)
+		if err != nil {
+			return nil, logger.ErrorWrapper("repository", "GetBoards", "row scan", dbError(err))
+		}
+		boards = append(boards, *board)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetBoards", "row iteration", dbError(err))
+	}
+	return boards, nil
+}
+
+func (r *PostgresBoardRepo) GetBoardBySlug(ctx context.Context, slug string) (*model.Board, error) {
+	query := `SELECT ` + boardColumns + ` FROM boards b WHERE b.slug = $1`
+	return r.getBoard(ctx, "GetBoardBySlug", query, slug)
+}
+
+func (r *PostgresBoardRepo) GetBoardByID(ctx context.Context, id int) (*model.Board, error) {
+	query := `SELECT ` + boardColumns + ` FROM boards b WHERE b.board_id = $1`
+	return r.getBoard(ctx, "GetBoardByID", query, id)
+}
+
+func (r *PostgresBoardRepo) getBoard(ctx context.Context, fn, query string, arg any) (*model.Board, error) {
+	board, err := scanBoard(r.db.QueryRowContext(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrBoardNotFound
+		}
+		return nil, logger.ErrorWrapper("repository", fn, "select from boards", dbError(err))
+	}
+	return board, nil
+}
+
+// scanBoard reads the boardColumns of a row
+func scanBoard(row interface{ Scan(...any) error }) (*model.Board, error) {
+	var b model.Board
+	err := row.Scan(
+		&b.BoardID,
+		&b.Slug,
+		&b.Title,
+		&b.Description,
+		&b.NSFW,
+		&b.MaxThreads,
+		&b.BumpLimit,
+		&b.Archive.Lifetime,
+		&b.Archive.LifetimeReply,
+		pq.Array(&b.AllowedTypes),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -10,65 +10,75 @@ import (
 	"errors"
 	"log/slog"
 	"time"
-
-	"github.com/lib/pq"
 )
 
 // Injecting PostgreSQL
 type PostgresCommentRepo struct {
 	db     *sql.DB
+	tx     *sql.Tx // set when the repo comes from a unit of work
+	names  model.NameMode
 	logger *slog.Logger
 }
 
 // Constructor
-func NewPostgresCommentRepo(db *sql.DB, logger *slog.Logger) *PostgresCommentRepo {
-	return &PostgresCommentRepo{db: db, logger: logger}
+func NewPostgresCommentRepo(db *sql.DB, names model.NameMode, logger *slog.Logger) *PostgresCommentRepo {
+	return &PostgresCommentRepo{db: db, names: names, logger: logger}
 }
 
+// Comment and its image links are saved in one transaction
 func (r *PostgresCommentRepo) CreateComment(ctx context.Context, comment *model.Comment) error {
 	query := `
 		INSERT INTO comments (
-			comment_id, post_id, session_id, user_name, comment_content, parent_comment_id, image_urls, created_at, is_archived
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			comment_id, post_id, session_id, tripcode, comment_content, parent_comment_id, created_at, is_archived, sage
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, $7, $8, $9)
 	`
 
-	_, err := r.db.ExecContext(
-		ctx,
-		query,
-		comment.CommentID,
-		comment.PostID,
-		comment.SessionID,
-		comment.UserName,
-		comment.Content,
-		comment.ParentCommentID,
-		pq.Array(comment.ImageURLs),
-		comment.CreatedAt,
-		comment.IsArchived,
-	)
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			comment.CommentID,
+			comment.PostID,
+			comment.SessionID,
+			comment.Tripcode,
+			comment.Content,
+			comment.ParentCommentID,
+			comment.CreatedAt,
+			comment.IsArchived,
+			comment.Sage,
+		)
+		if err != nil {
+			return logger.ErrorWrapper("repository", "CreateComment", "insert into comments", dbError(err))
+		}
 
+		if err := attachImages(ctx, tx, commentImages, string(comment.CommentID), comment.Attachments); err != nil {
+			return logger.ErrorWrapper("repository", "CreateComment", "attaching images", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return logger.ErrorWrapper("repository", "CreateComment", "insert into comments", model.ErrDatabase)
+		return logger.ErrorWrapper("repository", "CreateComment", "saving comment", err)
 	}
-
 	return nil
 }
 
 func (r *PostgresCommentRepo) GetCommentsByPostID(ctx context.Context, postID utils.UUID, includeArchived bool) ([]*model.Comment, error) {
 	query := `
-		SELECT comment_id, post_id, session_id, user_name, comment_content, parent_comment_id, image_urls, created_at, is_archived
-		FROM comments
-		WHERE post_id = $1
+		SELECT c.comment_id, c.post_id, c.session_id, ` + authorNameSQL(r.names, "c") + `, c.tripcode, c.comment_content,
+		       COALESCE(c.parent_comment_id::text, ''), c.created_at, c.edited_at, c.is_archived, c.is_deleted, c.sage
+		FROM comments c
+		WHERE c.post_id = $1
 	`
 
 	// Return only active comments if it is the main page
 	if !includeArchived {
-		query += " AND is_archived = false"
+		query += " AND c.is_archived = false"
 	}
-	query += " ORDER BY created_at DESC"
+	query += " ORDER BY c.created_at DESC"
 
-	rows, err := r.db.QueryContext(ctx, query, postID)
+	rows, err := r.conn().QueryContext(ctx, query, postID)
 	if err != nil {
-		return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "select from comments", model.ErrDatabase)
+		return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "select from comments", dbError(err))
 	}
 	defer rows.Close()
 
@@ -81,56 +91,61 @@ func (r *PostgresCommentRepo) GetCommentsByPostID(ctx context.Context, postID ut
 			&comment.PostID,
 			&comment.SessionID,
 			&comment.UserName,
+			&comment.Tripcode,
 			&comment.Content,
 			&comment.ParentCommentID,
-			pq.Array(comment.ImageURLs),
 			&comment.CreatedAt,
+			&comment.EditedAt,
 			&comment.IsArchived,
+			&comment.IsDeleted,
+			&comment.Sage,
 		)
 		if err != nil {
-			return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "row scan", model.ErrDatabase)
+			return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "row scan", dbError(err))
 		}
 		comments = append(comments, &comment)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "row iteration", model.ErrDatabase)
+		return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "row iteration", dbError(err))
 	}
 
-	if len(comments) == 0 {
-		return nil, model.ErrCommentNotFound
+	if err := r.loadImages(ctx, comments); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentsByPostID", "loading images", err)
 	}
 
+	// A thread without comments is not an error, its page still renders
 	return comments, nil
 }
 
 func (r *PostgresCommentRepo) GetCommentByID(ctx context.Context, commentID utils.UUID) (*model.Comment, error) {
 	query := `
-		SELECT comment_id, post_id, session_id, user_name, comment_content, parent_comment_id, image_urls, created_at, is_archived
-		FROM comments
-		WHERE comment_id = $1
+		SELECT c.comment_id, c.post_id, c.session_id, ` + authorNameSQL(r.names, "c") + `, c.tripcode, c.comment_content, c.parent_comment_id, c.created_at, c.edited_at, c.is_archived, c.is_deleted
+		FROM comments c
+		WHERE c.comment_id = $1
 	`
 
 	var c model.Comment
 	var parentCommentID sql.NullString
-	var imageURLs []string
 
-	err := r.db.QueryRowContext(ctx, query, commentID).Scan(
+	err := r.conn().QueryRowContext(ctx, query, commentID).Scan(
 		&c.CommentID,
 		&c.PostID,
 		&c.SessionID,
 		&c.UserName,
+		&c.Tripcode,
 		&c.Content,
 		&parentCommentID,
-		pq.Array(&imageURLs),
 		&c.CreatedAt,
+		&c.EditedAt,
 		&c.IsArchived,
+		&c.IsDeleted,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, model.ErrCommentNotFound
 		}
-		return nil, logger.ErrorWrapper("repository", "GetCommentByID", "scanning result", err)
+		return nil, logger.ErrorWrapper("repository", "GetCommentByID", "scanning result", dbError(err))
 	}
 
 	if parentCommentID.Valid {
@@ -139,11 +154,88 @@ func (r *PostgresCommentRepo) GetCommentByID(ctx context.Context, commentID util
 	} else {
 		c.ParentCommentID = ""
 	}
-	c.ImageURLs = imageURLs
+
+	if err := r.loadImages(ctx, []*model.Comment{&c}); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentByID", "loading images", err)
+	}
 
 	return &c, nil
 }
 
+// Comments written by the session with the thread each one belongs to
+func (r *PostgresCommentRepo) GetCommentsBySession(ctx context.Context, sessionID utils.UUID) ([]model.CommentActivity, error) {
+	query := `
+		SELECT c.comment_id, c.post_id, c.session_id, ` + authorNameSQL(r.names, "c") + `, c.tripcode, c.comment_content,
+		       COALESCE(c.parent_comment_id::text, ''), c.created_at, c.is_archived,
+		       (SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.comment_id AND r.is_deleted = false),
+		       ` + postBoardColumns + `, p.post_title, p.created_at, p.is_archived,
+		       (SELECT COUNT(*) FROM comments t WHERE t.post_id = p.post_id AND t.is_deleted = false),
+		       (SELECT MAX(t.created_at) FROM comments t WHERE t.post_id = p.post_id AND t.is_archived = false)
+		FROM comments c
+		JOIN posts p ON p.post_id = c.post_id
+		JOIN boards b ON b.board_id = p.board_id
+		WHERE c.session_id = $1 AND c.is_deleted = false
+		ORDER BY c.created_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentsBySession", "select from comments", dbError(err))
+	}
+	defer rows.Close()
+
+	var activity []model.CommentActivity
+	var comments []*model.Comment
+	for rows.Next() {
+		var comment model.Comment
+		var post model.Post
+		var entry model.CommentActivity
+		var lastComment sql.NullTime
+
+		err := rows.Scan(
+			&comment.CommentID,
+			&comment.PostID,
+			&comment.SessionID,
+			&comment.UserName,
+			&comment.Tripcode,
+			&comment.Content,
+			&comment.ParentCommentID,
+			&comment.CreatedAt,
+			&comment.IsArchived,
+			&entry.ReplyCount,
+			&post.BoardID,
+			&post.BoardSlug,
+			&post.Archive.Lifetime,
+			&post.Archive.LifetimeReply,
+			&post.Title,
+			&post.CreatedAt,
+			&post.IsArchived,
+			&entry.Thread.ReplyCount,
+			&lastComment,
+		)
+		if err != nil {
+			return nil, logger.ErrorWrapper("repository", "GetCommentsBySession", "row scan", dbError(err))
+		}
+		if lastComment.Valid {
+			entry.Thread.LastCommentAt = &lastComment.Time
+		}
+		post.PostID = comment.PostID
+		entry.Comment = &comment
+		entry.Thread.Post = &post
+		activity = append(activity, entry)
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentsBySession", "row iteration", dbError(err))
+	}
+
+	if err := r.loadImages(ctx, comments); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentsBySession", "loading images", err)
+	}
+	return activity, nil
+}
+
 // Fetch the most recent comment's created_at
 // Need it for archiving logic
 func (r *PostgresCommentRepo) GetLatestCommentTime(ctx context.Context, postID utils.UUID) (*time.Time, error) {
@@ -154,9 +246,9 @@ func (r *PostgresCommentRepo) GetLatestCommentTime(ctx context.Context, postID u
 	`
 
 	var latestTime sql.NullTime
-	err := r.db.QueryRowContext(ctx, query, postID).Scan(&latestTime)
+	err := r.conn().QueryRowContext(ctx, query, postID).Scan(&latestTime)
 	if err != nil {
-		return nil, logger.ErrorWrapper("repository", "GetLatestCommentTime", "select MAX(created_at)", model.ErrDatabase)
+		return nil, logger.ErrorWrapper("repository", "GetLatestCommentTime", "select MAX(created_at)", dbError(err))
 	}
 
 	if !latestTime.Valid {
@@ -167,16 +259,16 @@ func (r *PostgresCommentRepo) GetLatestCommentTime(ctx context.Context, postID u
 }
 
 // Make all comments of a specific post as is_archived = true
-func (r *PostgresCommentRepo) ArchiveCommentByPostIDTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error {
+func (r *PostgresCommentRepo) ArchiveCommentByPostID(ctx context.Context, postID utils.UUID) error {
 	query := `
 		UPDATE comments
 		SET is_archived = true
 		WHERE post_id = $1
 	`
 
-	result, err := tx.ExecContext(ctx, query, postID)
+	result, err := r.conn().ExecContext(ctx, query, postID)
 	if err != nil {
-		return logger.ErrorWrapper("repository", "ArchiveCommentByPostID", "update comments", model.ErrDatabase)
+		return logger.ErrorWrapper("repository", "ArchiveCommentByPostID", "update comments", dbError(err))
 	}
 
 	rowsAffected, _ := result.RowsAffected()
@@ -187,27 +279,127 @@ func (r *PostgresCommentRepo) ArchiveCommentByPostIDTx(ctx context.Context, tx *
 	return nil
 }
 
-func (r *PostgresCommentRepo) UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error {
+// Fills Attachments of the given comments with a single query
+func (r *PostgresCommentRepo) loadImages(ctx context.Context, comments []*model.Comment) error {
+	ids := make([]string, 0, len(comments))
+	for _, c := range comments {
+		ids = append(ids, string(c.CommentID))
+	}
+
+	attachments, err := loadAttachments(ctx, r.conn(), commentImages, ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		c.Attachments = attachments[string(c.CommentID)]
+	}
+	return nil
+}
+
+// Text and tripcode are blanked, the row stays so reply chains and notifications keep their parent
+func (r *PostgresCommentRepo) DeleteComment(ctx context.Context, commentID utils.UUID) ([]model.Image, error) {
 	query := `
-	UPDATE comments 
-	SET user_name = $1 
-	WHERE session_id = $2
+		UPDATE comments
+		SET comment_content = '', tripcode = '', is_deleted = true
+		WHERE comment_id = $1
 	`
 
-	result, err := r.db.ExecContext(ctx, query, newName, sessionID)
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, commentID)
+		if err != nil {
+			return dbError(err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return model.ErrCommentNotFound
+		}
+
+		released, err = detachImages(ctx, tx, commentImages, []string{string(commentID)})
+		return err
+	})
 	if err != nil {
-		return logger.ErrorWrapper("repository", "UpdateUserNameForSession", "updating user name for comment", model.ErrDatabase)
+		return nil, logger.ErrorWrapper("repository", "DeleteComment", "deleting comment", err)
 	}
+	return released, nil
+}
 
-	// To check whether we changed rows
-	affected, err := result.RowsAffected()
+// The comment stays, only its images are unlinked
+func (r *PostgresCommentRepo) DeleteCommentImages(ctx context.Context, commentID utils.UUID) ([]model.Image, error) {
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		var err error
+		released, err = detachImages(ctx, tx, commentImages, []string{string(commentID)})
+		return err
+	})
 	if err != nil {
-		return logger.ErrorWrapper("repository", "UpdateUserNameForSession", "checking rows affected for comment", err)
+		return nil, logger.ErrorWrapper("repository", "DeleteCommentImages", "unlinking images", err)
 	}
+	return released, nil
+}
 
-	if affected == 0 {
-		// If we did not update any row, it means there is no such comment
-		return model.ErrCommentNotFound
+// The replaced version goes to comment_revisions first, both happen in one transaction
+func (r *PostgresCommentRepo) UpdateComment(ctx context.Context, comment *model.Comment, replaceImages bool) ([]model.Image, error) {
+	query := `
+		UPDATE comments
+		SET comment_content = $2, edited_at = $3
+		WHERE comment_id = $1
+	`
+
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		if err := saveRevision(ctx, tx, commentRevisions, string(comment.CommentID), *comment.EditedAt); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, comment.CommentID, comment.Content, comment.EditedAt); err != nil {
+			return dbError(err)
+		}
+
+		if !replaceImages {
+			return nil
+		}
+		var err error
+		if released, err = detachImages(ctx, tx, commentImages, []string{string(comment.CommentID)}); err != nil {
+			return err
+		}
+		return attachImages(ctx, tx, commentImages, string(comment.CommentID), comment.Attachments)
+	})
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "UpdateComment", "saving edit", err)
 	}
-	return nil
+	return released, nil
+}
+
+func (r *PostgresCommentRepo) GetCommentRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error) {
+	query := `
+		SELECT r.comment_id, r.revision, r.title, r.content, r.image_hashes, r.written_at, r.replaced_at
+		FROM comment_revisions r
+		JOIN comments c ON c.comment_id = r.comment_id
+		WHERE c.post_id = $1
+		ORDER BY c.created_at, r.revision
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentRevisions", "select from comment_revisions", dbError(err))
+	}
+	revisions, err := scanRevisions(rows)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetCommentRevisions", "row scan", err)
+	}
+	return revisions, nil
+}
+
+// withTx returns a copy of the repo bound to tx
+func (r *PostgresCommentRepo) withTx(tx *sql.Tx) *PostgresCommentRepo {
+	c := *r
+	c.tx = tx
+	return &c
+}
+
+// Statements go through the unit of work transaction when there is one
+func (r *PostgresCommentRepo) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
 }
@@ -0,0 +1,11 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/model"
+	"fmt"
+)
+
+// dbError keeps model.ErrDatabase for callers to match and the driver error for the logs
+func dbError(err error) error {
+	return fmt.Errorf("%w: %v", model.ErrDatabase, err)
+}
@@ -0,0 +1,271 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/logger"
+	"context"
+	"database/sql"
+	"log/slog"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+type PostgresImageRepo struct {
+	db     *sql.DB
+	tx     *sql.Tx // set on copies handed out by the unit of work
+	logger *slog.Logger
+}
+
+func NewPostgresImageRepo(db *sql.DB, logger *slog.Logger) *PostgresImageRepo {
+	return &PostgresImageRepo{db: db, logger: logger}
+}
+
+// ReferencedKeys collects keys of images linked from at least one post or comment
+// Rows left without links (e.g. after a failed transaction bumped nothing) do not count
+func (r *PostgresImageRepo) ReferencedKeys(ctx context.Context) (map[string]bool, error) {
+	query := `
+	SELECT i.storage_key, i.thumbnail_key
+	FROM images i
+	WHERE EXISTS (SELECT 1 FROM post_images p WHERE p.image_hash = i.image_hash)
+	   OR EXISTS (SELECT 1 FROM comment_images c WHERE c.image_hash = i.image_hash)
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "ReferencedKeys", "select from images", dbError(err))
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	for rows.Next() {
+		var storageKey, thumbnailKey string
+		if err := rows.Scan(&storageKey, &thumbnailKey); err != nil {
+			return nil, logger.ErrorWrapper("repository", "ReferencedKeys", "row scan", dbError(err))
+		}
+		keys[storageKey] = true
+		if thumbnailKey != "" {
+			keys[thumbnailKey] = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "ReferencedKeys", "row iteration", dbError(err))
+	}
+	return keys, nil
+}
+
+// Transaction level advisory locks, released by commit or rollback, so only useful in a unit of work
+// Sorted, two transactions locking overlapping sets then wait instead of deadlocking
+func (r *PostgresImageRepo) LockImages(ctx context.Context, hashes []string) error {
+	sorted := slices.Clone(hashes)
+	slices.Sort(sorted)
+	for _, hash := range slices.Compact(sorted) {
+		if _, err := r.conn().ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, hash); err != nil {
+			return logger.ErrorWrapper("repository", "LockImages", "advisory lock", dbError(err))
+		}
+	}
+	return nil
+}
+
+func (r *PostgresImageRepo) LinkedHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	query := `
+	SELECT image_hash FROM post_images WHERE image_hash = ANY($1)
+	UNION
+	SELECT image_hash FROM comment_images WHERE image_hash = ANY($1)
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, pq.Array(hashes))
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "LinkedHashes", "select links", dbError(err))
+	}
+	defer rows.Close()
+
+	linked := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, logger.ErrorWrapper("repository", "LinkedHashes", "row scan", dbError(err))
+		}
+		linked[hash] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "LinkedHashes", "row iteration", dbError(err))
+	}
+	return linked, nil
+}
+
+// withTx returns a copy of the repo bound to tx
+func (r *PostgresImageRepo) withTx(tx *sql.Tx) *PostgresImageRepo {
+	c := *r
+	c.tx = tx
+	return &c
+}
+
+// Statements go through the unit of work transaction when there is one
+func (r *PostgresImageRepo) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// Link tables between images and their owners
+type imageLink struct {
+	table       string // post_images or comment_images
+	ownerColumn string // post_id or comment_id
+}
+
+var (
+	postImages    = imageLink{table: "post_images", ownerColumn: "post_id"}
+	commentImages = imageLink{table: "comment_images", ownerColumn: "comment_id"}
+)
+
+// attachImages saves image rows and links them to the owner in the given order
+// An image that is already known only gets its ref_count bumped
+func attachImages(ctx context.Context, tx *sql.Tx, link imageLink, ownerID string, attachments []model.Attachment) error {
+	const upsertImage = `
+	INSERT INTO images (image_hash, storage_key, thumbnail_key, mime_type, size_bytes, width, height, ref_count)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, 1)
+	ON CONFLICT (image_hash) DO UPDATE
+	SET ref_count = images.ref_count + 1,
+	    thumbnail_key = CASE WHEN images.thumbnail_key = '' THEN EXCLUDED.thumbnail_key ELSE images.thumbnail_key END
+	`
+	insertLink := `INSERT INTO ` + link.table + ` (` + link.ownerColumn + `, position, image_hash, original_name) VALUES ($1, $2, $3, $4)`
+
+	for i, a := range attachments {
+		if _, err := tx.ExecContext(ctx, upsertImage,
+			a.Hash,
+			a.StorageKey,
+			a.ThumbnailKey,
+			a.MimeType,
+			a.Size,
+			a.Width,
+			a.Height,
+		); err != nil {
+			return logger.ErrorWrapper("repository", "attachImages", "upsert into images", dbError(err))
+		}
+
+		if _, err := tx.ExecContext(ctx, insertLink, ownerID, i, a.Hash, a.OriginalName); err != nil {
+			return logger.ErrorWrapper("repository", "attachImages", "insert into "+link.table, dbError(err))
+		}
+	}
+	return nil
+}
+
+// detachImages unlinks every image of the owners and drops the rows of images nothing refers to anymore
+// The dropped images are returned, their files stay until the caller has committed and releases them
+func detachImages(ctx context.Context, tx *sql.Tx, link imageLink, ownerIDs []string) ([]model.Image, error) {
+	if len(ownerIDs) == 0 {
+		return nil, nil
+	}
+
+	unlink := `
+	WITH removed AS (
+		DELETE FROM ` + link.table + ` WHERE ` + link.ownerColumn + ` = ANY($1) RETURNING image_hash
+	)
+	UPDATE images i
+	SET ref_count = i.ref_count - r.n
+	FROM (SELECT image_hash, COUNT(*) AS n FROM removed GROUP BY image_hash) r
+	WHERE i.image_hash = r.image_hash
+	RETURNING i.image_hash
+	`
+	// Links decide, like in ReferencedKeys, ref_count is bookkeeping only
+	const drop = `
+	DELETE FROM images i
+	WHERE i.image_hash = ANY($1)
+	  AND NOT EXISTS (SELECT 1 FROM post_images p WHERE p.image_hash = i.image_hash)
+	  AND NOT EXISTS (SELECT 1 FROM comment_images c WHERE c.image_hash = i.image_hash)
+	RETURNING i.image_hash, i.storage_key, i.thumbnail_key
+	`
+
+	rows, err := tx.QueryContext(ctx, unlink, pq.Array(ownerIDs))
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "detachImages", "delete from "+link.table, dbError(err))
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, logger.ErrorWrapper("repository", "detachImages", "scan image hash", dbError(err))
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "detachImages", "rows iteration", dbError(err))
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	rows, err = tx.QueryContext(ctx, drop, pq.Array(hashes))
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "detachImages", "delete from images", dbError(err))
+	}
+	defer rows.Close()
+
+	var released []model.Image
+	for rows.Next() {
+		var image model.Image
+		if err := rows.Scan(&image.Hash, &image.StorageKey, &image.ThumbnailKey); err != nil {
+			return nil, logger.ErrorWrapper("repository", "detachImages", "scan dropped image", dbError(err))
+		}
+		released = append(released, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "detachImages", "dropped rows iteration", dbError(err))
+	}
+	return released, nil
+}
+
+// loadAttachments fetches images of several owners with one query, keyed by owner ID
+func loadAttachments(ctx context.Context, db querier, link imageLink, ownerIDs []string) (map[string][]model.Attachment, error) {
+	result := make(map[string][]model.Attachment)
+	if len(ownerIDs) == 0 {
+		return result, nil
+	}
+
+	query := `
+	SELECT l.` + link.ownerColumn + `, l.original_name, i.image_hash, i.storage_key, i.thumbnail_key,
+	       i.mime_type, i.size_bytes, i.width, i.height, i.ref_count, i.created_at
+	FROM ` + link.table + ` l
+	JOIN images i ON i.image_hash = l.image_hash
+	WHERE l.` + link.ownerColumn + ` = ANY($1)
+	ORDER BY l.` + link.ownerColumn + `, l.position
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ownerIDs))
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "loadAttachments", "select from "+link.table, dbError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ownerID string
+		var a model.Attachment
+		if err := rows.Scan(
+			&ownerID,
+			&a.OriginalName,
+			&a.Hash,
+			&a.StorageKey,
+			&a.ThumbnailKey,
+			&a.MimeType,
+			&a.Size,
+			&a.Width,
+			&a.Height,
+			&a.RefCount,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, logger.ErrorWrapper("repository", "loadAttachments", "scan image row", dbError(err))
+		}
+		result[ownerID] = append(result[ownerID], a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "loadAttachments", "rows iteration", dbError(err))
+	}
+	return result, nil
+}
@@ -0,0 +1,19 @@
+package postgresql
+
+import "1337b04rd/internal/domain/model"
+
+// authorNameSQL is the display name of the session that wrote the row aliased as alias
+// Names are joined at read time, posts and comments keep only the session ID
+func authorNameSQL(mode model.NameMode, alias string) string {
+	if mode == model.NamesFrozen {
+		// Latest name set before the row was written
+		return `COALESCE((
+			SELECT n.display_name FROM session_names n
+			WHERE n.session_id = ` + alias + `.session_id AND n.effective_from <= ` + alias + `.created_at
+			ORDER BY n.effective_from DESC LIMIT 1
+		), '` + model.DefaultDisplayName + `')`
+	}
+	return `COALESCE((
+		SELECT NULLIF(s.display_name, '') FROM sessions s WHERE s.session_id = ` + alias + `.session_id
+	), '` + model.DefaultDisplayName + `')`
+}
@@ -0,0 +1,128 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/logger"
+	"1337b04rd/pkg/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Replies are read through parent_comment_id, the table only keeps who is notified and the read state
+type PostgresNotificationRepo struct {
+	db     *sql.DB
+	tx     *sql.Tx // set when the repo comes from a unit of work
+	names  model.NameMode
+	logger *slog.Logger
+}
+
+// Constructor
+func NewPostgresNotificationRepo(db *sql.DB, names model.NameMode, logger *slog.Logger) *PostgresNotificationRepo {
+	return &PostgresNotificationRepo{db: db, names: names, logger: logger}
+}
+
+func (r *PostgresNotificationRepo) CreateNotification(ctx context.Context, sessionID, replyID utils.UUID, createdAt time.Time) error {
+	query := `
+		INSERT INTO notifications (reply_id, session_id, created_at)
+		VALUES ($1, $2, $3)
+	`
+
+	if _, err := r.conn().ExecContext(ctx, query, replyID, sessionID, createdAt); err != nil {
+		return logger.ErrorWrapper("repository", "CreateNotification", "insert into notifications", dbError(err))
+	}
+	return nil
+}
+
+func (r *PostgresNotificationRepo) GetUnreadNotifications(ctx context.Context, sessionID utils.UUID) ([]model.Notification, error) {
+	query := `
+		SELECT c.comment_id, c.post_id, c.session_id, ` + authorNameSQL(r.names, "c") + `, c.tripcode, c.comment_content,
+		       COALESCE(c.parent_comment_id::text, ''), c.created_at, c.is_archived,
+		       COALESCE(parent.comment_content, ''), p.post_title, n.created_at
+		FROM notifications n
+		JOIN comments c ON c.comment_id = n.reply_id
+		JOIN comments parent ON parent.comment_id = c.parent_comment_id
+		JOIN posts p ON p.post_id = c.post_id
+		WHERE n.session_id = $1 AND n.read_at IS NULL AND c.is_deleted = false
+		ORDER BY n.created_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetUnreadNotifications", "select from notifications", dbError(err))
+	}
+	defer rows.Close()
+
+	var notifications []model.Notification
+	for rows.Next() {
+		var reply model.Comment
+		var n model.Notification
+
+		err := rows.Scan(
+			&reply.CommentID,
+			&reply.PostID,
+			&reply.SessionID,
+			&reply.UserName,
+			&reply.Tripcode,
+			&reply.Content,
+			&reply.ParentCommentID,
+			&reply.CreatedAt,
+			&reply.IsArchived,
+			&n.ParentContent,
+			&n.PostTitle,
+			&n.CreatedAt,
+		)
+		if err != nil {
+			return nil, logger.ErrorWrapper("repository", "GetUnreadNotifications", "row scan", dbError(err))
+		}
+		n.Reply = &reply
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetUnreadNotifications", "row iteration", dbError(err))
+	}
+	return notifications, nil
+}
+
+// Replies of other sessions are never touched, unknown IDs are ignored
+func (r *PostgresNotificationRepo) MarkNotificationsRead(ctx context.Context, sessionID utils.UUID, replyIDs []utils.UUID, readAt time.Time) error {
+	query := `
+		UPDATE notifications
+		SET read_at = $2
+		WHERE session_id = $1 AND read_at IS NULL
+	`
+	args := []any{sessionID, readAt}
+
+	if len(replyIDs) > 0 {
+		ids := make([]string, 0, len(replyIDs))
+		for _, id := range replyIDs {
+			ids = append(ids, string(id))
+		}
+		query += " AND reply_id = ANY($3)"
+		args = append(args, pq.Array(ids))
+	}
+
+	if _, err := r.conn().ExecContext(ctx, query, args...); err != nil {
+		return logger.ErrorWrapper("repository", "MarkNotificationsRead", "update notifications", dbError(err))
+	}
+	return nil
+}
+
+// withTx returns a copy of the repo bound to tx
+func (r *PostgresNotificationRepo) withTx(tx *sql.Tx) *PostgresNotificationRepo {
+	c := *r
+	c.tx = tx
+	return &c
+}
+
+// Statements go through the unit of work transaction when there is one
+func (r *PostgresNotificationRepo) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
@@ -9,39 +9,54 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
-
-	"github.com/lib/pq"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Injecting PostgreSQL
 type PostgresPostRepo struct {
 	db     *sql.DB
+	tx     *sql.Tx // set when the repo comes from a unit of work
+	names  model.NameMode
 	logger *slog.Logger
 }
 
 // Constructor
-func NewPostgresPostRepo(db *sql.DB, logger *slog.Logger) *PostgresPostRepo {
-	return &PostgresPostRepo{db: db, logger: logger}
+func NewPostgresPostRepo(db *sql.DB, names model.NameMode, logger *slog.Logger) *PostgresPostRepo {
+	return &PostgresPostRepo{db: db, names: names, logger: logger}
 }
 
+// Post and its image links are saved in one transaction
 func (r *PostgresPostRepo) CreatePost(ctx context.Context, post *model.Post) error {
 	query := `
-	INSERT INTO posts (post_id, session_id, user_name, post_title, post_content, image_urls, created_at, is_archived)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	INSERT INTO posts (post_id, board_id, session_id, tripcode, post_title, post_content, created_at, bumped_at, is_archived)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		post.PostID,
-		post.SessionID,
-		post.UserName,
-		post.Title,
-		post.Content,
-		pq.Array(post.ImageURLs),
-		post.CreatedAt,
-		post.IsArchived,
-	)
 
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query,
+			post.PostID,
+			post.BoardID,
+			post.SessionID,
+			post.Tripcode,
+			post.Title,
+			post.Content,
+			post.CreatedAt,
+			post.BumpedAt,
+			post.IsArchived,
+		)
+		if err != nil {
+			return logger.ErrorWrapper("repository", "CreatePost", "insert into posts", dbError(err))
+		}
+
+		if err := attachImages(ctx, tx, postImages, string(post.PostID), post.Attachments); err != nil {
+			return logger.ErrorWrapper("repository", "CreatePost", "attaching images", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return logger.ErrorWrapper("repository", "CreatePost", "insert into posts", err)
+		return logger.ErrorWrapper("repository", "CreatePost", "saving post", err)
 	}
 	return nil
 }
@@ -50,19 +65,31 @@ func (r *PostgresPostRepo) GetPostByID(ctx context.Context, id utils.UUID) (*mod
 
 	var post model.Post
 	query := `
-	SELECT post_id, session_id, user_name, post_title, post_content, image_urls, created_at, is_archived
-	FROM posts 
-	WHERE post_id = $1
+	SELECT p.post_id, ` + postBoardColumns + `, p.session_id, ` + authorNameSQL(r.names, "p") + `, p.tripcode, p.post_title, p.post_content, p.created_at, p.bumped_at, p.edited_at, p.is_archived, p.is_sticky, p.is_locked,
+	       ` + threadCounts + `
+	FROM posts p
+	JOIN boards b ON b.board_id = p.board_id
+	WHERE p.post_id = $1
 	`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn().QueryRowContext(ctx, query, id).Scan(
 		&post.PostID,
+		&post.BoardID,
+		&post.BoardSlug,
+		&post.Archive.Lifetime,
+		&post.Archive.LifetimeReply,
 		&post.SessionID,
 		&post.UserName,
+		&post.Tripcode,
 		&post.Title,
 		&post.Content,
-		&post.ImageURLs,
 		&post.CreatedAt,
+		&post.BumpedAt,
+		&post.EditedAt,
 		&post.IsArchived,
+		&post.IsSticky,
+		&post.IsLocked,
+		&post.ReplyCount,
+		&post.ImageCount,
 	)
 
 	if err != nil {
@@ -72,24 +99,96 @@ func (r *PostgresPostRepo) GetPostByID(ctx context.Context, id utils.UUID) (*mod
 			return nil, model.ErrPostNotFound
 		}
 
-		return nil, logger.ErrorWrapper("repository", "GetPostByID", "select post by ID", err)
+		return nil, logger.ErrorWrapper("repository", "GetPostByID", "select post by ID", dbError(err))
+	}
+
+	if err := r.loadImages(ctx, []*model.Post{&post}); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetPostByID", "loading images", err)
 	}
 	return &post, nil
 }
 
-// Pass "archived" value to retrieve either active or archived posts
-func (r *PostgresPostRepo) GetAllPosts(ctx context.Context, archived bool) ([]*model.Post, error) {
+// Pass "archived" value to retrieve either active or archived posts, boardID 0 for every board
+// Sticky threads come first, then the most recently bumped ones
+func (r *PostgresPostRepo) GetAllPosts(ctx context.Context, boardID int, archived bool) ([]*model.Post, error) {
 	query := `
-	SELECT post_id, session_id, user_name, post_title, post_content, image_urls, created_at, is_archived
-	FROM posts 
-	WHERE is_archived = $1
-	ORDER BY created_at DESC
+	SELECT p.post_id, ` + postBoardColumns + `, p.session_id, ` + authorNameSQL(r.names, "p") + `, p.tripcode, p.post_title, p.post_content, p.created_at, p.bumped_at, p.is_archived, p.is_sticky, p.is_locked,
+	       ` + threadCounts + `
+	FROM posts p
+	JOIN boards b ON b.board_id = p.board_id
+	WHERE p.is_archived = $1 AND ($2 = 0 OR p.board_id = $2)
+	ORDER BY p.is_sticky DESC, p.bumped_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, archived)
+	rows, err := r.conn().QueryContext(ctx, query, archived, boardID)
 	if err != nil {
-		return nil, logger.ErrorWrapper("repository", "GetAllPosts", "query all posts", err)
+		return nil, logger.ErrorWrapper("repository", "GetAllPosts", "query all posts", dbError(err))
 	}
+	posts, err := r.scanListing(ctx, rows)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetAllPosts", "reading posts", err)
+	}
+	return posts, nil
+}
+
+// Sort keys of the listings, newest first, see model.Cursor
+var (
+	catalogKey = []string{"p.is_sticky", "p.bumped_at", "p.post_id"}
+	archiveKey = []string{"p.created_at", "p.post_id"}
+)
+
+// Keyset pagination: the cursor row is compared to the sort key, so every page
+// is an index range scan no matter how deep it is
+func (r *PostgresPostRepo) ListPosts(ctx context.Context, boardID int, archived bool, cursor *model.Cursor, backward bool, limit int) ([]*model.Post, error) {
+	key := catalogKey
+	if archived {
+		key = archiveKey
+	}
+	// Walking back reads the rows before the cursor upwards, then flips them
+	dir, cmp := " DESC", "<"
+	if backward {
+		dir, cmp = " ASC", ">"
+	}
+
+	args := []any{archived, boardID, limit}
+	where := ""
+	if cursor != nil {
+		params := []string{"$4", "$5"}
+		if archived {
+			args = append(args, cursor.At, cursor.PostID)
+		} else {
+			args = append(args, cursor.Sticky, cursor.At, cursor.PostID)
+			params = append(params, "$6")
+		}
+		where = " AND (" + strings.Join(key, ", ") + ") " + cmp + " (" + strings.Join(params, ", ") + ")"
+	}
+
+	query := `
+	SELECT p.post_id, ` + postBoardColumns + `, p.session_id, ` + authorNameSQL(r.names, "p") + `, p.tripcode, p.post_title, p.post_content, p.created_at, p.bumped_at, p.is_archived, p.is_sticky, p.is_locked,
+	       ` + threadCounts + `
+	FROM posts p
+	JOIN boards b ON b.board_id = p.board_id
+	WHERE p.is_archived = $1 AND p.board_id = $2` + where + `
+	ORDER BY ` + strings.Join(key, dir+", ") + dir + `
+	LIMIT $3
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "ListPosts", "query page", dbError(err))
+	}
+	posts, err := r.scanListing(ctx, rows)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "ListPosts", "reading posts", err)
+	}
+	if backward {
+		slices.Reverse(posts)
+	}
+	return posts, nil
+}
+
+// Rows of GetAllPosts and ListPosts, with their images
+func (r *PostgresPostRepo) scanListing(ctx context.Context, rows *sql.Rows) ([]*model.Post, error) {
 	defer rows.Close()
 
 	var posts []*model.Post
@@ -99,41 +198,224 @@ func (r *PostgresPostRepo) GetAllPosts(ctx context.Context, archived bool) ([]*m
 
 		if err := rows.Scan(
 			&post.PostID,
+			&post.BoardID,
+			&post.BoardSlug,
+			&post.Archive.Lifetime,
+			&post.Archive.LifetimeReply,
 			&post.SessionID,
 			&post.UserName,
+			&post.Tripcode,
 			&post.Title,
 			&post.Content,
-			pq.Array((&post.ImageURLs)),
 			&post.CreatedAt,
+			&post.BumpedAt,
 			&post.IsArchived,
+			&post.IsSticky,
+			&post.IsLocked,
+			&post.ReplyCount,
+			&post.ImageCount,
 		); err != nil {
-			return nil, logger.ErrorWrapper("repository", "GetAllPosts", "scan post row", err)
+			return nil, logger.ErrorWrapper("repository", "scanListing", "scan post row", dbError(err))
 		}
 		posts = append(posts, &post)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, logger.ErrorWrapper("repository", "GetAllPosts", "rows iteration", err)
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "scanListing", "rows iteration", dbError(err))
+	}
+
+	if err := r.loadImages(ctx, posts); err != nil {
+		return nil, logger.ErrorWrapper("repository", "scanListing", "loading images", err)
 	}
 	return posts, nil
 }
 
-func (r *PostgresPostRepo) ArchivePostTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error {
+// Threads started by the session, active and archived, with their reply counts
+func (r *PostgresPostRepo) GetThreadsBySession(ctx context.Context, sessionID utils.UUID) ([]model.ThreadActivity, error) {
+	query := `
+	SELECT p.post_id, ` + postBoardColumns + `, p.session_id, ` + authorNameSQL(r.names, "p") + `, p.tripcode, p.post_title, p.post_content, p.created_at, p.is_archived,
+	       (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.post_id AND c.is_deleted = false),
+	       (SELECT MAX(c.created_at) FROM comments c WHERE c.post_id = p.post_id AND c.is_archived = false)
+	FROM posts p
+	JOIN boards b ON b.board_id = p.board_id
+	WHERE p.session_id = $1
+	ORDER BY p.created_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetThreadsBySession", "select from posts", dbError(err))
+	}
+	defer rows.Close()
+
+	var threads []model.ThreadActivity
+	var posts []*model.Post
+	for rows.Next() {
+		var post model.Post
+		var thread model.ThreadActivity
+		var lastComment sql.NullTime
+
+		if err := rows.Scan(
+			&post.PostID,
+			&post.BoardID,
+			&post.BoardSlug,
+			&post.Archive.Lifetime,
+			&post.Archive.LifetimeReply,
+			&post.SessionID,
+			&post.UserName,
+			&post.Tripcode,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.IsArchived,
+			&thread.ReplyCount,
+			&lastComment,
+		); err != nil {
+			return nil, logger.ErrorWrapper("repository", "GetThreadsBySession", "row scan", dbError(err))
+		}
+		if lastComment.Valid {
+			thread.LastCommentAt = &lastComment.Time
+		}
+		thread.Post = &post
+		threads = append(threads, thread)
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetThreadsBySession", "row iteration", dbError(err))
+	}
+
+	if err := r.loadImages(ctx, posts); err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetThreadsBySession", "loading images", err)
+	}
+	return threads, nil
+}
+
+// Fills Attachments of the given posts with a single query
+func (r *PostgresPostRepo) loadImages(ctx context.Context, posts []*model.Post) error {
+	ids := make([]string, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, string(p.PostID))
+	}
+
+	attachments, err := loadAttachments(ctx, r.conn(), postImages, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Attachments = attachments[string(p.PostID)]
+	}
+	return nil
+}
+
+// Reply and image counts of the thread aliased p, deleted comments and their images don't count
+const threadCounts = `(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.post_id AND c.is_deleted = false),
+	       (SELECT COUNT(*) FROM post_images pi WHERE pi.post_id = p.post_id) +
+	       (SELECT COUNT(*) FROM comment_images ci JOIN comments c ON c.comment_id = ci.comment_id WHERE c.post_id = p.post_id)`
+
+func (r *PostgresPostRepo) ArchiveOverflow(ctx context.Context, boardID, maxThreads int) ([]utils.UUID, error) {
+	// The board row lock makes concurrent new threads count one after another,
+	// each one sees the threads the others committed
+	if _, err := r.conn().ExecContext(ctx, `SELECT 1 FROM boards WHERE board_id = $1 FOR UPDATE`, boardID); err != nil {
+		return nil, logger.ErrorWrapper("repository", "ArchiveOverflow", "lock board", dbError(err))
+	}
+
+	query := `
+	UPDATE posts
+	SET is_archived = true
+	WHERE post_id IN (
+		SELECT post_id FROM posts
+		WHERE board_id = $1 AND is_archived = false AND is_sticky = false
+		ORDER BY bumped_at DESC, created_at DESC, post_id DESC
+		OFFSET $2
+	)
+	RETURNING post_id
+	`
+	rows, err := r.conn().QueryContext(ctx, query, boardID, maxThreads)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "ArchiveOverflow", "update is_archived", dbError(err))
+	}
+	defer rows.Close()
+
+	var archived []utils.UUID
+	for rows.Next() {
+		var id utils.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, logger.ErrorWrapper("repository", "ArchiveOverflow", "scan post_id", dbError(err))
+		}
+		archived = append(archived, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logger.ErrorWrapper("repository", "ArchiveOverflow", "rows iteration", dbError(err))
+	}
+	return archived, nil
+}
+
+func (r *PostgresPostRepo) SetSticky(ctx context.Context, postID utils.UUID, sticky bool) error {
+	return r.setFlag(ctx, "SetSticky", "is_sticky", postID, sticky)
+}
+
+func (r *PostgresPostRepo) SetLocked(ctx context.Context, postID utils.UUID, locked bool) error {
+	return r.setFlag(ctx, "SetLocked", "is_locked", postID, locked)
+}
+
+// column is one of the constant flag names above, never user input
+func (r *PostgresPostRepo) setFlag(ctx context.Context, fn, column string, postID utils.UUID, value bool) error {
+	result, err := r.conn().ExecContext(ctx, `UPDATE posts SET `+column+` = $2 WHERE post_id = $1`, postID, value)
+	if err != nil {
+		return logger.ErrorWrapper("repository", fn, "update "+column, dbError(err))
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return model.ErrPostNotFound
+	}
+	return nil
+}
+
+func (r *PostgresPostRepo) LockThread(ctx context.Context, postID utils.UUID) (int, error) {
+	var locked int
+	err := r.conn().QueryRowContext(ctx, `SELECT 1 FROM posts WHERE post_id = $1 FOR UPDATE`, postID).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, model.ErrPostNotFound
+	}
+	if err != nil {
+		return 0, logger.ErrorWrapper("repository", "LockThread", "lock post", dbError(err))
+	}
+
+	// Deleted replies still count, deleting them must not make the thread bump again
+	var replies int
+	if err := r.conn().QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE post_id = $1`, postID).Scan(&replies); err != nil {
+		return 0, logger.ErrorWrapper("repository", "LockThread", "count comments", dbError(err))
+	}
+	return replies, nil
+}
+
+func (r *PostgresPostRepo) BumpPost(ctx context.Context, postID utils.UUID, bumpedAt time.Time) error {
+	result, err := r.conn().ExecContext(ctx, `UPDATE posts SET bumped_at = $2 WHERE post_id = $1`, postID, bumpedAt)
+	if err != nil {
+		return logger.ErrorWrapper("repository", "BumpPost", "update bumped_at", dbError(err))
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return model.ErrPostNotFound
+	}
+	return nil
+}
+
+func (r *PostgresPostRepo) ArchivePost(ctx context.Context, postID utils.UUID) error {
 	query := `
 	UPDATE posts 
 	SET is_archived = true 
 	WHERE post_id = $1
 	`
 	// Execution of the query
-	result, err := tx.ExecContext(ctx, query, postID)
+	result, err := r.conn().ExecContext(ctx, query, postID)
 	if err != nil {
-		return logger.ErrorWrapper("repository", "ArchivePosts", "update is_archived", err)
+		return logger.ErrorWrapper("repository", "ArchivePosts", "update is_archived", dbError(err))
 	}
 
 	// To check whether we changed rows
 	affected, err := result.RowsAffected()
 	if err != nil {
-		return logger.ErrorWrapper("repository", "ArchivePosts", "rows affected", err)
+		return logger.ErrorWrapper("repository", "ArchivePosts", "rows affected", dbError(err))
 	}
 
 	if affected == 0 {
@@ -144,29 +426,136 @@ func (r *PostgresPostRepo) ArchivePostTx(ctx context.Context, tx *sql.Tx, postID
 	return nil
 }
 
-// Need this to update username during current session
-func (r *PostgresPostRepo) UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error {
+// The thread goes with its comments, their images are unlinked first so the counts stay right
+func (r *PostgresPostRepo) DeletePost(ctx context.Context, postID utils.UUID) ([]model.Image, error) {
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		commentIDs, err := commentIDsOfPost(ctx, tx, postID)
+		if err != nil {
+			return err
+		}
+		fromComments, err := detachImages(ctx, tx, commentImages, commentIDs)
+		if err != nil {
+			return err
+		}
+		fromPost, err := detachImages(ctx, tx, postImages, []string{string(postID)})
+		if err != nil {
+			return err
+		}
+		released = append(fromComments, fromPost...)
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE post_id = $1`, postID)
+		if err != nil {
+			return dbError(err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return model.ErrPostNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "DeletePost", "deleting post", err)
+	}
+	return released, nil
+}
+
+// The post stays, only its images are unlinked
+func (r *PostgresPostRepo) DeletePostImages(ctx context.Context, postID utils.UUID) ([]model.Image, error) {
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		var err error
+		released, err = detachImages(ctx, tx, postImages, []string{string(postID)})
+		return err
+	})
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "DeletePostImages", "unlinking images", err)
+	}
+	return released, nil
+}
+
+// The replaced version goes to post_revisions first, both happen in one transaction
+func (r *PostgresPostRepo) UpdatePost(ctx context.Context, post *model.Post, replaceImages bool) ([]model.Image, error) {
 	query := `
-	UPDATE posts 
-	SET user_name = $1 
-	WHERE session_id = $2
+	UPDATE posts
+	SET post_title = $2, post_content = $3, edited_at = $4
+	WHERE post_id = $1
 	`
 
-	// Execution of the query
-	result, err := r.db.ExecContext(ctx, query, newName, sessionID)
+	var released []model.Image
+	err := inTx(ctx, r.db, r.tx, func(tx *sql.Tx) error {
+		if err := saveRevision(ctx, tx, postRevisions, string(post.PostID), *post.EditedAt); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, post.PostID, post.Title, post.Content, post.EditedAt); err != nil {
+			return dbError(err)
+		}
+
+		if !replaceImages {
+			return nil
+		}
+		var err error
+		if released, err = detachImages(ctx, tx, postImages, []string{string(post.PostID)}); err != nil {
+			return err
+		}
+		return attachImages(ctx, tx, postImages, string(post.PostID), post.Attachments)
+	})
 	if err != nil {
-		return logger.ErrorWrapper("repository", "UpdateUserNameForSession", "updating new name in post", err)
+		return nil, logger.ErrorWrapper("repository", "UpdatePost", "saving edit", err)
 	}
+	return released, nil
+}
 
-	// To check whether we changed rows
-	affected, err := result.RowsAffected()
+func (r *PostgresPostRepo) GetPostRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error) {
+	query := `
+	SELECT post_id, revision, title, content, image_hashes, written_at, replaced_at
+	FROM post_revisions
+	WHERE post_id = $1
+	ORDER BY revision
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("repository", "GetPostRevisions", "select from post_revisions", dbError(err))
+	}
+	revisions, err := scanRevisions(rows)
 	if err != nil {
-		return logger.ErrorWrapper("repository", "UpdateUserNameForSession", "checking rows affected for post", err)
+		return nil, logger.ErrorWrapper("repository", "GetPostRevisions", "row scan", err)
 	}
+	return revisions, nil
+}
 
-	if affected == 0 {
-		// If we did not update any row, it means there is no such post
-		return model.ErrPostNotFound
+func commentIDsOfPost(ctx context.Context, tx *sql.Tx, postID utils.UUID) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT comment_id FROM comments WHERE post_id = $1`, postID)
+	if err != nil {
+		return nil, dbError(err)
 	}
-	return nil
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return ids, nil
+}
+
+// withTx returns a copy of the repo bound to tx
+func (r *PostgresPostRepo) withTx(tx *sql.Tx) *PostgresPostRepo {
+	c := *r
+	c.tx = tx
+	return &c
+}
+
+// Statements go through the unit of work transaction when there is one
+func (r *PostgresPostRepo) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
 }
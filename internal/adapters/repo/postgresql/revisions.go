@@ -0,0 +1,96 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Revision tables next to posts and comments, same shape as the image links
+type revisionTable struct {
+	table         string // post_revisions or comment_revisions
+	ownerColumn   string // post_id or comment_id
+	ownerTable    string // posts or comments
+	titleColumn   string // empty for comments, they have no title
+	contentColumn string // post_content or comment_content
+	imageLink     imageLink
+	notFound      error
+}
+
+var (
+	postRevisions = revisionTable{
+		table:         "post_revisions",
+		ownerColumn:   "post_id",
+		ownerTable:    "posts",
+		titleColumn:   "post_title",
+		contentColumn: "post_content",
+		imageLink:     postImages,
+		notFound:      model.ErrPostNotFound,
+	}
+	commentRevisions = revisionTable{
+		table:         "comment_revisions",
+		ownerColumn:   "comment_id",
+		ownerTable:    "comments",
+		contentColumn: "comment_content",
+		imageLink:     commentImages,
+		notFound:      model.ErrCommentNotFound,
+	}
+)
+
+// saveRevision copies the current version of the owner into its revision table
+// Two edits racing for the same number collide on the primary key, the later one fails
+func saveRevision(ctx context.Context, tx *sql.Tx, rev revisionTable, ownerID string, replacedAt time.Time) error {
+	title := "''"
+	if rev.titleColumn != "" {
+		title = "o." + rev.titleColumn
+	}
+
+	query := `
+	INSERT INTO ` + rev.table + ` (` + rev.ownerColumn + `, revision, title, content, image_hashes, written_at, replaced_at)
+	SELECT o.` + rev.ownerColumn + `,
+	       (SELECT COALESCE(MAX(r.revision), 0) + 1 FROM ` + rev.table + ` r WHERE r.` + rev.ownerColumn + ` = o.` + rev.ownerColumn + `),
+	       ` + title + `, COALESCE(o.` + rev.contentColumn + `, ''),
+	       ARRAY(SELECT l.image_hash FROM ` + rev.imageLink.table + ` l WHERE l.` + rev.imageLink.ownerColumn + ` = o.` + rev.ownerColumn + ` ORDER BY l.position),
+	       COALESCE(o.edited_at, o.created_at), $2
+	FROM ` + rev.ownerTable + ` o
+	WHERE o.` + rev.ownerColumn + ` = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, ownerID, replacedAt)
+	if err != nil {
+		return dbError(err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return rev.notFound
+	}
+	return nil
+}
+
+// scanRevisions reads rows of owner ID, revision, title, content, image hashes, written_at and replaced_at
+func scanRevisions(rows *sql.Rows) ([]model.Revision, error) {
+	defer rows.Close()
+
+	var revisions []model.Revision
+	for rows.Next() {
+		var r model.Revision
+		if err := rows.Scan(
+			&r.OwnerID,
+			&r.Number,
+			&r.Title,
+			&r.Content,
+			pq.Array(&r.ImageHashes),
+			&r.WrittenAt,
+			&r.ReplacedAt,
+		); err != nil {
+			return nil, dbError(err)
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return revisions, nil
+}
@@ -7,7 +7,9 @@ import (
 	"1337b04rd/pkg/utils"
 	"context"
 	"database/sql"
+	"errors"
 	"log/slog"
+	"time"
 )
 
 type PostgresSessionRepo struct {
@@ -20,33 +22,74 @@ func NewPostgresSessionRepo(db *sql.DB, logger *slog.Logger) *PostgresSessionRep
 	return &PostgresSessionRepo{db: db, logger: logger}
 }
 
+// SeedAvatarPool makes sure avatars 1..avatarPool exist, run on start
+// A smaller pool later simply leaves the extra rows unused
+func (r *PostgresSessionRepo) SeedAvatarPool(ctx context.Context, avatarPool int) error {
+	const query = `
+		INSERT INTO avatars (avatar_id)
+		SELECT generate_series(1, $1)
+		ON CONFLICT (avatar_id) DO NOTHING
+	`
+	if _, err := r.db.ExecContext(ctx, query, avatarPool); err != nil {
+		return logger.ErrorWrapper("repository", "SeedAvatarPool", "insert into avatars", dbError(err))
+	}
+	return nil
+}
+
+// One index lookup, SKIP LOCKED lets concurrent visitors take different avatars without waiting on each other
+func (r *PostgresSessionRepo) AllocateAvatar(ctx context.Context, avatarPool int) (int, error) {
+	const query = `
+		UPDATE avatars
+		SET active_sessions = active_sessions + 1, last_assigned_at = CURRENT_TIMESTAMP
+		WHERE avatar_id = (
+			SELECT avatar_id FROM avatars
+			WHERE avatar_id <= $1
+			ORDER BY active_sessions, last_assigned_at NULLS FIRST, avatar_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING avatar_id
+	`
+
+	var avatarID int
+	err := r.db.QueryRowContext(ctx, query, avatarPool).Scan(&avatarID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Every avatar is being handed out at this very moment, or the pool was not seeded
+		return 0, nil
+	}
+	if err != nil {
+		return 0, logger.ErrorWrapper("repository", "AllocateAvatar", "update avatars", dbError(err))
+	}
+	return avatarID, nil
+}
+
 // Use it on the first POST request to create a post
+// The avatar is allocated and its URL resolved before, so the row is written once
 func (r *PostgresSessionRepo) CreateSession(ctx context.Context, session *model.Session) error {
 	const query = `
-		INSERT INTO sessions (session_id, avatar_url, created_at, expires_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO sessions (session_id, avatar_id, avatar_url, created_at, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
 		session.SessionID,
+		session.AvatarID,
 		session.AvatarURL,
 		session.CreatedAt,
 		session.ExpiresAt,
 	)
-
 	if err != nil {
-		return logger.ErrorWrapper("repository", "CreateSession", "insert into sessions", model.ErrDatabase)
+		return logger.ErrorWrapper("repository", "CreateSession", "insert into sessions", dbError(err))
 	}
-
 	return nil
 }
 
 // To identify returning user by their session ID
 func (r *PostgresSessionRepo) GetSessionByID(ctx context.Context, id utils.UUID) (*model.Session, error) {
 	const query = `
-		SELECT session_id, avatar_url, created_at, expires_at
+		SELECT session_id, COALESCE(avatar_id, 0), avatar_url, display_name, created_at, expires_at
 		FROM sessions
-		WHERE session_id = $1
+		WHERE session_id = $1 AND expires_at > CURRENT_TIMESTAMP
 	`
 
 	row := r.db.QueryRowContext(ctx, query, id)
@@ -54,7 +97,9 @@ func (r *PostgresSessionRepo) GetSessionByID(ctx context.Context, id utils.UUID)
 	var session model.Session
 	err := row.Scan(
 		&session.SessionID,
+		&session.AvatarID,
 		&session.AvatarURL,
+		&session.DisplayName,
 		&session.CreatedAt,
 		&session.ExpiresAt,
 	)
@@ -63,23 +108,170 @@ func (r *PostgresSessionRepo) GetSessionByID(ctx context.Context, id utils.UUID)
 		if err == sql.ErrNoRows {
 			return nil, model.ErrSessionNotFound
 		}
-		return nil, logger.ErrorWrapper("repository", "GetSessionByID", "select from sessions", model.ErrDatabase)
+		return nil, logger.ErrorWrapper("repository", "GetSessionByID", "select from sessions", dbError(err))
 	}
 
 	return &session, nil
 }
 
+// Avatar usage is recounted here, which also corrects allocations whose session was never saved
+// Posts and comments keep their author's row, it owns them and /me lists them
 func (r *PostgresSessionRepo) DeleteExpiredSession(ctx context.Context) error {
 	const query = `
-		DELETE FROM sessions
-		WHERE expires_at < CURRENT_TIMESTAMP
+		DELETE FROM sessions s
+		WHERE s.expires_at < CURRENT_TIMESTAMP
+		AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.session_id = s.session_id)
+		AND NOT EXISTS (SELECT 1 FROM comments c WHERE c.session_id = s.session_id)
 	`
 
 	_, err := r.db.ExecContext(ctx, query)
 
 	if err != nil {
-		return logger.ErrorWrapper("repository", "DeleteExpiredSession", "delete expired sessions", model.ErrDatabase)
+		return logger.ErrorWrapper("repository", "DeleteExpiredSession", "delete expired sessions", dbError(err))
+	}
+	return nil
+}
+
+func (r *PostgresSessionRepo) RecountAvatars(ctx context.Context) error {
+	const query = `
+		UPDATE avatars a
+		SET active_sessions = (
+			SELECT COUNT(*) FROM sessions s
+			WHERE s.avatar_id = a.avatar_id AND s.expires_at > CURRENT_TIMESTAMP
+		)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return logger.ErrorWrapper("repository", "RecountAvatars", "update avatars", dbError(err))
+	}
+	return nil
+}
+
+// Never moves expires_at backwards, two requests renewing at once both succeed
+func (r *PostgresSessionRepo) ExtendSession(ctx context.Context, id utils.UUID, expiresAt time.Time) error {
+	const query = `
+		UPDATE sessions
+		SET expires_at = GREATEST(expires_at, $1)
+		WHERE session_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, expiresAt, id); err != nil {
+		return logger.ErrorWrapper("repository", "ExtendSession", "update sessions", dbError(err))
+	}
+	return nil
+}
+
+// Foreign keys cascade on update, so posts, comments and name history move with the session
+func (r *PostgresSessionRepo) RotateSessionID(ctx context.Context, oldID, newID utils.UUID) error {
+	const query = `
+		UPDATE sessions
+		SET session_id = $1
+		WHERE session_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, newID, oldID)
+	if err != nil {
+		return logger.ErrorWrapper("repository", "RotateSessionID", "update sessions", dbError(err))
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return logger.ErrorWrapper("repository", "RotateSessionID", "rows affected", dbError(err))
+	}
+	if affected == 0 {
+		return model.ErrSessionNotFound
+	}
+	return nil
+}
+
+// Name change is one row update plus a history entry, old posts are never rewritten
+func (r *PostgresSessionRepo) SetDisplayName(ctx context.Context, id utils.UUID, name string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logger.ErrorWrapper("repository", "SetDisplayName", "starting tx", dbError(err))
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, `SELECT display_name FROM sessions WHERE session_id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.ErrSessionNotFound
+		}
+		return logger.ErrorWrapper("repository", "SetDisplayName", "select from sessions", dbError(err))
+	}
+
+	// Same name again is not a change worth a history entry
+	if current == name {
+		return nil
 	}
 
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET display_name = $1 WHERE session_id = $2`, name, id); err != nil {
+		return logger.ErrorWrapper("repository", "SetDisplayName", "update sessions", dbError(err))
+	}
+
+	const history = `
+		INSERT INTO session_names (session_id, display_name, effective_from)
+		VALUES ($1, $2, $3)
+	`
+	if _, err := tx.ExecContext(ctx, history, id, name, at); err != nil {
+		return logger.ErrorWrapper("repository", "SetDisplayName", "insert into session_names", dbError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return logger.ErrorWrapper("repository", "SetDisplayName", "committing tx", dbError(err))
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// A session has at most one unused code, issuing a new one invalidates the old
+func (r *PostgresSessionRepo) ReplaceRecoveryCode(ctx context.Context, sessionID utils.UUID, codeHash string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logger.ErrorWrapper("repository", "ReplaceRecoveryCode", "starting tx", dbError(err))
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE session_id = $1`, sessionID); err != nil {
+		return logger.ErrorWrapper("repository", "ReplaceRecoveryCode", "delete from recovery_codes", dbError(err))
+	}
+
+	const insert = `
+		INSERT INTO recovery_codes (code_hash, session_id, created_at)
+		VALUES ($1, $2, $3)
+	`
+	if _, err := tx.ExecContext(ctx, insert, codeHash, sessionID, at); err != nil {
+		return logger.ErrorWrapper("repository", "ReplaceRecoveryCode", "insert into recovery_codes", dbError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return logger.ErrorWrapper("repository", "ReplaceRecoveryCode", "committing tx", dbError(err))
+	}
+	return nil
+}
+
+// Delete and return in one statement, two browsers racing with the same code can't both win
+func (r *PostgresSessionRepo) ConsumeRecoveryCode(ctx context.Context, codeHash string) (utils.UUID, error) {
+	const query = `
+		DELETE FROM recovery_codes
+		WHERE code_hash = $1
+		RETURNING session_id
+	`
+
+	var sessionID utils.UUID
+	err := r.db.QueryRowContext(ctx, query, codeHash).Scan(&sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", model.ErrInvalidRecovery
+		}
+		return "", logger.ErrorWrapper("repository", "ConsumeRecoveryCode", "delete from recovery_codes", dbError(err))
+	}
+	return sessionID, nil
+}
+
+func (r *PostgresSessionRepo) DeleteRecoveryCodes(ctx context.Context, sessionID utils.UUID) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE session_id = $1`, sessionID); err != nil {
+		return logger.ErrorWrapper("repository", "DeleteRecoveryCodes", "delete from recovery_codes", dbError(err))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package postgresql
+
+import (
+	"1337b04rd/internal/domain/port"
+	"1337b04rd/pkg/logger"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type PostgresUnitOfWork struct {
+	db       *sql.DB
+	posts    *PostgresPostRepo
+	comments *PostgresCommentRepo
+	notifies *PostgresNotificationRepo
+	images   *PostgresImageRepo
+	logger   *slog.Logger
+}
+
+// Repos given here are copied and bound to every transaction
+func NewPostgresUnitOfWork(db *sql.DB, posts *PostgresPostRepo, comments *PostgresCommentRepo, notifies *PostgresNotificationRepo, images *PostgresImageRepo, logger *slog.Logger) *PostgresUnitOfWork {
+	return &PostgresUnitOfWork{db: db, posts: posts, comments: comments, notifies: notifies, images: images, logger: logger}
+}
+
+type pgTx struct {
+	tx       *sql.Tx
+	posts    *PostgresPostRepo
+	comments *PostgresCommentRepo
+	notifies *PostgresNotificationRepo
+	images   *PostgresImageRepo
+}
+
+func (t *pgTx) Posts() port.PostRepo                 { return t.posts }
+func (t *pgTx) Comments() port.CommentRepo           { return t.comments }
+func (t *pgTx) Notifications() port.NotificationRepo { return t.notifies }
+func (t *pgTx) Images() port.ImageRepo               { return t.images }
+
+func (u *PostgresUnitOfWork) Do(ctx context.Context, fn func(tx port.Tx) error) (err error) {
+	sqlTx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logger.ErrorWrapper("repository", "UnitOfWork", "starting tx", dbError(err))
+	}
+
+	tx := &pgTx{
+		tx:       sqlTx,
+		posts:    u.posts.withTx(sqlTx),
+		comments: u.comments.withTx(sqlTx),
+		notifies: u.notifies.withTx(sqlTx),
+		images:   u.images.withTx(sqlTx),
+	}
+
+	// No-op once committed, also reached on panic
+	defer sqlTx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return logger.ErrorWrapper("repository", "UnitOfWork", "committing tx", dbError(err))
+	}
+	return nil
+}
+
+// inTx runs fn in the repo's transaction, or in a short one of its own when the repo is not bound to any
+func inTx(ctx context.Context, db *sql.DB, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if tx != nil {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting tx: %w", dbError(err))
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing tx: %w", dbError(err))
+	}
+	return nil
+}
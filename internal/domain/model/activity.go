@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// SessionActivity is everything one session wrote, for the /me page
+type SessionActivity struct {
+	Threads  []ThreadActivity
+	Comments []CommentActivity
+}
+
+type ThreadActivity struct {
+	Post          *Post
+	ReplyCount    int        // comments in the thread
+	LastCommentAt *time.Time // latest active comment, nil if there is none
+}
+
+// ArchivesIn is the time left before the thread is archived, 0 once it is
+func (t ThreadActivity) ArchivesIn(now time.Time) time.Duration {
+	if t.Post.IsArchived {
+		return 0
+	}
+	return max(t.Post.ArchivesAt(t.LastCommentAt).Sub(now), 0)
+}
+
+type CommentActivity struct {
+	Comment    *Comment
+	ReplyCount int            // comments answering this one
+	Thread     ThreadActivity // thread the comment is in, without its images
+}
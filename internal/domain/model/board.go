@@ -0,0 +1,54 @@
+package model
+
+import (
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Board groups threads under a slug like /b/ or /g/, each with its own settings
+type Board struct {
+	BoardID      int
+	Slug         string
+	Title        string
+	Description  string
+	NSFW         bool
+	MaxThreads   int // active threads kept on the board, 0 means no limit
+	BumpLimit    int // replies that still bump a thread, 0 means no limit
+	Archive      ArchivePolicy
+	AllowedTypes []string // MIME types accepted for uploads, empty accepts every supported image
+}
+
+// ArchivePolicy is how long threads of a board stay active
+type ArchivePolicy struct {
+	Lifetime      time.Duration // without comments
+	LifetimeReply time.Duration // after the latest comment
+}
+
+// Zero values fall back to the defaults
+func (a ArchivePolicy) orDefault() ArchivePolicy {
+	if a.Lifetime <= 0 {
+		a.Lifetime = ThreadLifetime
+	}
+	if a.LifetimeReply <= 0 {
+		a.LifetimeReply = ThreadLifetimeReply
+	}
+	return a
+}
+
+// Bumps tells whether a new reply to a thread that already has replies moves it to the top
+func (b *Board) Bumps(replies int) bool {
+	return b.BumpLimit == 0 || replies < b.BumpLimit
+}
+
+// Accepts tells whether images of mimeType may be uploaded to the board
+func (b *Board) Accepts(mimeType string) bool {
+	return len(b.AllowedTypes) == 0 || slices.Contains(b.AllowedTypes, mimeType)
+}
+
+// Slugs end up in URLs, short lowercase letters and digits only
+var boardSlug = regexp.MustCompile(`^[a-z0-9]{1,10}$`)
+
+func ValidBoardSlug(slug string) bool {
+	return boardSlug.MatchString(slug)
+}
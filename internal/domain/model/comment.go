@@ -12,9 +12,18 @@ type Comment struct {
 	PostID          utils.UUID
 	SessionID       utils.UUID
 	UserName        string
+	Tripcode        string // hashed "#secret" from the name field, empty if none was given
 	Content         string
 	ParentCommentID utils.UUID
-	ImageURLs       []string
+	Attachments     []Attachment
 	CreatedAt       time.Time
+	EditedAt        *time.Time // nil until the author edits the comment
 	IsArchived      bool
+	IsDeleted       bool // tombstone left by the author, replies still point at it
+	Sage            bool // the reply doesn't bump the thread
+}
+
+// Images links every original to its thumbnail
+func (c *Comment) Images() []ImageLink {
+	return imageLinks(c.Attachments)
 }
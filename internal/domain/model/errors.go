@@ -7,6 +7,7 @@ var (
 	ErrNotFound     = errors.New("resource not found")
 	ErrInvalidInput = errors.New("invalid input provided")
 	ErrInternal     = errors.New("internal server error")
+	ErrNotOwner     = errors.New("only the author can do this")
 )
 
 // Post-specific errors
@@ -14,6 +15,14 @@ var (
 	ErrPostNotFound     = errors.New("post not found")
 	ErrMissingTitle     = errors.New("post title is required")
 	ErrMissingSessionID = errors.New("session ID is required")
+	ErrThreadLocked     = errors.New("thread is locked")
+	ErrInvalidCursor    = errors.New("invalid page cursor")
+)
+
+// Board-specific errors
+var (
+	ErrBoardNotFound       = errors.New("board not found")
+	ErrImageTypeNotAllowed = errors.New("image type is not allowed on this board")
 )
 
 // Comment-specific errors
@@ -24,14 +33,29 @@ var (
 
 // Session-related errors
 var (
-	ErrSessionNotFound  = errors.New("session not found")
-	ErrSessionExpired   = errors.New("session expired")
-	ErrInvalidSessionID = errors.New("invalid session ID")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrInvalidSessionID   = errors.New("invalid session ID")
+	ErrInvalidDisplayName = errors.New("invalid display name")
+	ErrInvalidRecovery    = errors.New("recovery code is invalid or already used")
+	ErrTooManyAttempts    = errors.New("too many attempts")
 )
 
+// Posts and comments can only be edited for a while after they were written
+var ErrEditWindowClosed = errors.New("edit window has closed")
+
 // Triple-S related
 var ErrBucketAlreadyExists = errors.New("bucket already exists")
 
+// Image upload errors
+var (
+	ErrUnsupportedImageType  = errors.New("unsupported image type")
+	ErrImageTypeMismatch     = errors.New("image content does not match its extension")
+	ErrInvalidImage          = errors.New("file is not a valid image")
+	ErrImageTooLarge         = errors.New("image file is too large")
+	ErrImageDimensionsTooBig = errors.New("image dimensions are too large")
+)
+
 // Misc
 var (
 	ErrDatabase       = errors.New("database error")
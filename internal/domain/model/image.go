@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// Stored images are served by the /media/ handler, links look like /media/<key>
+const MediaURLPrefix = "/media/"
+
+func MediaURL(key string) string {
+	return MediaURLPrefix + key
+}
+
+// Image is a stored file keyed by the SHA-256 of its content
+// Identical uploads share one row, RefCount tracks how many posts and comments use it
+type Image struct {
+	Hash         string
+	StorageKey   string
+	ThumbnailKey string
+	MimeType     string
+	Size         int64
+	Width        int
+	Height       int
+	RefCount     int
+	CreatedAt    time.Time
+	Created      bool // set by the uploader when this call wrote the object, a failed post deletes only those
+}
+
+// Attachment is an image attached to a post or comment
+type Attachment struct {
+	Image
+	OriginalName string // what the user uploaded it as, display only
+}
+
+// ImageObject is a stored image read back from the uploader, used to serve /media/ requests
+type ImageObject struct {
+	Key         string
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// ObjectInfo describes a stored object without reading it
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// GCReport is the result of one orphaned upload collection run
+type GCReport struct {
+	DryRun     bool
+	Scanned    int          // objects found in storage
+	Referenced int          // keys still used by posts and comments
+	Recent     int          // orphans younger than the grace period, kept for now
+	Orphans    []ObjectInfo // orphans older than the grace period
+	Deleted    int
+	Failed     int
+}
+
+// ImageLink pairs an original image with its thumbnail for templates
+type ImageLink struct {
+	URL          string
+	ThumbnailURL string
+	Name         string
+}
+
+// Builds image links for templates, thumbnail falls back to the original
+func imageLinks(attachments []Attachment) []ImageLink {
+	links := make([]ImageLink, 0, len(attachments))
+	for _, a := range attachments {
+		link := ImageLink{URL: MediaURL(a.StorageKey), ThumbnailURL: MediaURL(a.StorageKey), Name: a.OriginalName}
+		if a.ThumbnailKey != "" {
+			link.ThumbnailURL = MediaURL(a.ThumbnailKey)
+		}
+		links = append(links, link)
+	}
+	return links
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Notification tells a session that someone replied to one of its comments
+type Notification struct {
+	Reply         *Comment
+	ParentContent string // the session's own comment that was answered
+	PostTitle     string
+	CreatedAt     time.Time
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"1337b04rd/pkg/utils"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Threads per catalog or archive page
+const (
+	DefaultPageSize = 30
+	MaxPageSize     = 100
+)
+
+// PageRequest asks for one page of a listing, After and Before are cursors of an earlier page
+type PageRequest struct {
+	After  string
+	Before string
+	Limit  int // DefaultPageSize when 0
+}
+
+// PostPage is one page of a catalog or archive, Next and Prev are empty at the ends
+type PostPage struct {
+	Posts []*Post
+	Next  string
+	Prev  string
+}
+
+// Cursor is the sort key of a thread in its listing. Catalogs sort by
+// (is_sticky, bumped_at, post_id), archives by (created_at, post_id), newest first.
+type Cursor struct {
+	Sticky bool
+	At     time.Time
+	PostID utils.UUID
+}
+
+var cursorPostID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Cursor of the post in the catalog or the archive
+func (p *Post) Cursor(archived bool) Cursor {
+	if archived {
+		return Cursor{At: p.CreatedAt, PostID: p.PostID}
+	}
+	return Cursor{Sticky: p.IsSticky, At: p.BumpedAt, PostID: p.PostID}
+}
+
+// Encode makes the cursor opaque for URLs and the API
+func (c Cursor) Encode() string {
+	raw := strconv.FormatBool(c.Sticky) + "|" + strconv.FormatInt(c.At.UnixNano(), 10) + "|" + string(c.PostID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reverses Encode, anything else is ErrInvalidCursor
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || !cursorPostID.MatchString(parts[2]) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	sticky, err := strconv.ParseBool(parts[0])
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{Sticky: sticky, At: time.Unix(0, nanos).UTC(), PostID: utils.UUID(parts[2])}, nil
+}
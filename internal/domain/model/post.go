@@ -7,22 +7,61 @@ import (
 )
 
 type Post struct {
-	PostID     utils.UUID
-	SessionID  utils.UUID
-	UserName   string
-	Title      string
-	Content    string
-	ImageURLs  []string
-	CreatedAt  time.Time
-	IsArchived bool
+	PostID      utils.UUID
+	BoardID     int
+	BoardSlug   string        // joined in when the post is read, CreatePost looks the board up by it
+	Archive     ArchivePolicy // of the board, joined in when the post is read
+	SessionID   utils.UUID
+	UserName    string
+	Tripcode    string // hashed "#secret" from the name field, empty if none was given
+	Title       string
+	Content     string
+	Attachments []Attachment
+	CreatedAt   time.Time
+	BumpedAt    time.Time  // latest bumping reply, the catalog is sorted by it
+	EditedAt    *time.Time // nil until the author edits the post
+	IsArchived  bool
+	IsSticky    bool // pinned above the other threads and never archived by time
+	IsLocked    bool // takes no more replies
+	ReplyCount  int  // comments in the thread, filled by GetPostByID and GetAllPosts
+	ImageCount  int  // images of the post and its comments, same
 }
 
-// Work on this later
-func (p *Post) IsExpired(lastCommentAt *time.Time) bool {
+// Images links every original to its thumbnail
+func (p *Post) Images() []ImageLink {
+	return imageLinks(p.Attachments)
+}
+
+// Thumbnail of the first image, shown in the catalog
+func (p *Post) Thumbnail() string {
+	if images := p.Images(); len(images) > 0 {
+		return images[0].ThumbnailURL
+	}
+	return ""
+}
+
+// Threads live 10 minutes without comments, 15 minutes after the latest comment, unless their board says otherwise
+const (
+	ThreadLifetime      = 10 * time.Minute
+	ThreadLifetimeReply = 15 * time.Minute
+)
+
+// ArchivesAt is when the thread gets archived unless somebody comments before
+func (p *Post) ArchivesAt(lastCommentAt *time.Time) time.Time {
+	policy := p.Archive.orDefault()
 	if lastCommentAt == nil {
-		return time.Since(p.CreatedAt) > 10*time.Minute
+		return p.CreatedAt.Add(policy.Lifetime)
 	}
-	return time.Since(*lastCommentAt) > 15*time.Minute
+	return lastCommentAt.Add(policy.LifetimeReply)
+}
+
+// URL of the thread page, under its board
+func (p *Post) URL() string {
+	return "/" + p.BoardSlug + "/posts/" + string(p.PostID)
+}
+
+func (p *Post) IsExpired(lastCommentAt *time.Time) bool {
+	return time.Now().After(p.ArchivesAt(lastCommentAt))
 }
 
 func (p *Post) ValidatePost() error {
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"1337b04rd/pkg/utils"
+	"time"
+)
+
+// Edit is what an author may change within the edit window
+type Edit struct {
+	Title         string // posts only
+	Content       string
+	ReplaceImages bool // drop the current images, uploads sent with an edit always replace them
+}
+
+// CanEdit tells whether something written at createdAt is still inside the edit window
+func CanEdit(createdAt time.Time, window time.Duration) bool {
+	return time.Since(createdAt) < window
+}
+
+// Revision is an earlier version of a post or comment, kept whenever its author edits it
+type Revision struct {
+	OwnerID     utils.UUID // post or comment the version belongs to
+	Number      int
+	Title       string // posts only
+	Content     string
+	ImageHashes []string
+	WrittenAt   time.Time // when this version was posted or saved by an edit
+	ReplacedAt  time.Time
+}
+
+// ThreadRevisions is the edit history of a thread, for moderators
+type ThreadRevisions struct {
+	Post     *Post
+	Posts    []Revision
+	Comments []Revision
+}
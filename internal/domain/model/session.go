@@ -2,12 +2,42 @@ package model
 
 import (
 	"1337b04rd/pkg/utils"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Session struct {
-	SessionID utils.UUID
-	AvatarURL string
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	SessionID   utils.UUID
+	AvatarID    int // character from the avatar pool, 0 when none was allocated
+	AvatarURL   string
+	DisplayName string // empty until the visitor picks a name
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Shown for sessions that never picked a name
+const DefaultDisplayName = "Anonymous"
+
+const MaxDisplayNameLength = 32
+
+// NameMode decides which name old posts and comments show after a session renames itself
+type NameMode string
+
+const (
+	NamesRetroactive NameMode = "retroactive" // current name of the session everywhere
+	NamesFrozen      NameMode = "frozen"      // name the session had when the post was written
+)
+
+// NormalizeDisplayName trims the name and rejects empty, overlong or control character names
+func NormalizeDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxDisplayNameLength || !utf8.ValidString(name) {
+		return "", ErrInvalidDisplayName
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return "", ErrInvalidDisplayName
+	}
+	return name, nil
 }
@@ -0,0 +1,18 @@
+package model
+
+import "strings"
+
+// Tripcodes prove authorship across devices and sessions without an account
+// "Name#secret" gives a regular tripcode, "Name##secret" a secure one keyed with the server pepper
+const (
+	TripcodePrefix       = "!"
+	SecureTripcodePrefix = "!!"
+)
+
+// SplitNameField separates the trimmed name from the tripcode secret in the name form field
+// The secret must only be hashed, never stored or logged
+func SplitNameField(field string) (name, secret string, secure bool) {
+	name, secret, _ = strings.Cut(field, "#")
+	secret, secure = strings.CutPrefix(secret, "#")
+	return strings.TrimSpace(name), secret, secure
+}
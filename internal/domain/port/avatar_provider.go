@@ -0,0 +1,17 @@
+package port
+
+import (
+	"1337b04rd/pkg/utils"
+	"context"
+)
+
+type AvatarProvider interface {
+	// AvatarURL returns the avatar for a new session
+	// avatarID is the character allocated to the session, 0 lets the provider choose
+	AvatarURL(ctx context.Context, sessionID utils.UUID, avatarID int) (string, error)
+}
+
+// AvatarRenderer draws avatars the app serves itself under /avatars/
+type AvatarRenderer interface {
+	RenderAvatar(seed string) ([]byte, error)
+}
@@ -0,0 +1,13 @@
+package port
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+)
+
+type BoardRepo interface {
+	// GetBoards lists every board ordered by slug
+	GetBoards(ctx context.Context) ([]model.Board, error)
+	GetBoardBySlug(ctx context.Context, slug string) (*model.Board, error)
+	GetBoardByID(ctx context.Context, id int) (*model.Board, error)
+}
@@ -0,0 +1,12 @@
+package port
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+)
+
+type BoardService interface {
+	GetBoards(ctx context.Context) ([]model.Board, error)
+	// GetBoard fails with ErrBoardNotFound for unknown or malformed slugs
+	GetBoard(ctx context.Context, slug string) (*model.Board, error)
+}
@@ -4,7 +4,6 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
-	"database/sql"
 	"time"
 )
 
@@ -13,6 +12,17 @@ type CommentRepo interface {
 	GetCommentsByPostID(ctx context.Context, postID utils.UUID, includeArchived bool) ([]*model.Comment, error)
 	GetCommentByID(ctx context.Context, commentID utils.UUID) (*model.Comment, error)
 	GetLatestCommentTime(ctx context.Context, postID utils.UUID) (*time.Time, error)
-	ArchiveCommentByPostIDTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error
-	UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error
+	ArchiveCommentByPostID(ctx context.Context, postID utils.UUID) error
+	// GetCommentsBySession lists the session's comments, archived ones included, newest first
+	GetCommentsBySession(ctx context.Context, sessionID utils.UUID) ([]model.CommentActivity, error)
+	// DeleteComment turns the comment into a tombstone, replies keep their parent
+	// It returns the images nothing refers to anymore, their files are still stored
+	DeleteComment(ctx context.Context, commentID utils.UUID) ([]model.Image, error)
+	// DeleteCommentImages unlinks the comment's images and keeps the text
+	DeleteCommentImages(ctx context.Context, commentID utils.UUID) ([]model.Image, error)
+	// UpdateComment saves the current version as a revision, then writes content and EditedAt
+	// With replaceImages the links are swapped for comment.Attachments
+	UpdateComment(ctx context.Context, comment *model.Comment, replaceImages bool) ([]model.Image, error)
+	// GetCommentRevisions lists earlier versions of every comment in the thread, oldest first
+	GetCommentRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error)
 }
@@ -11,4 +11,11 @@ import (
 type CommentService interface {
 	CreateComment(ctx context.Context, comment *model.Comment, imageData map[string]io.Reader) error
 	GetCommentsByPostID(ctx context.Context, postID utils.UUID, includeArchived bool) ([]*model.Comment, error)
+	// DeleteComment fails with ErrNotOwner unless sessionID wrote the comment
+	DeleteComment(ctx context.Context, postID, commentID, sessionID utils.UUID, imagesOnly bool) error
+	// EditComment fails with ErrNotOwner for strangers and ErrEditWindowClosed once the window is over
+	EditComment(ctx context.Context, postID, commentID, sessionID utils.UUID, edit model.Edit, imageData map[string]io.Reader) error
+	GetUnreadReplies(ctx context.Context, sessionID utils.UUID) ([]model.Notification, error)
+	// MarkRepliesRead with no IDs marks every reply read
+	MarkRepliesRead(ctx context.Context, sessionID utils.UUID, replyIDs []utils.UUID) error
 }
@@ -0,0 +1,12 @@
+package port
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+)
+
+type ImageGCService interface {
+	// CollectOrphans finds stored objects no post or comment refers to
+	// With dryRun nothing is deleted, the report only lists what would be
+	CollectOrphans(ctx context.Context, dryRun bool) (*model.GCReport, error)
+}
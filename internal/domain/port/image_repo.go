@@ -0,0 +1,13 @@
+package port
+
+import "context"
+
+type ImageRepo interface {
+	// ReferencedKeys returns storage and thumbnail keys of images attached to any post or comment
+	ReferencedKeys(ctx context.Context) (map[string]bool, error)
+	// LockImages holds a lock per image hash until the unit of work ends
+	// Whoever links an image or deletes its files takes it first, so the two never interleave
+	LockImages(ctx context.Context, hashes []string) error
+	// LinkedHashes tells which of the hashes are attached to a post or comment
+	LinkedHashes(ctx context.Context, hashes []string) (map[string]bool, error)
+}
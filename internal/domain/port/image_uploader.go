@@ -2,10 +2,23 @@
 package port
 
 import (
+	"1337b04rd/internal/domain/model"
 	"io"
 )
 
 type ImageUploader interface {
-	UploadPostImage(postID, filename string, r io.Reader) (string, error)
-	UploadCommentImage(postID, commentID, filename string, r io.Reader) (string, error)
+	// StoreImage validates the upload and saves it under a key derived from the SHA-256 of its content
+	// Types accepts rejects (nil takes every supported one) fail with ErrImageTypeNotAllowed before anything is written
+	// Uploading identical content again does not write a second copy, Created tells whether this call wrote it
+	StoreImage(filename string, r io.Reader, accepts func(mimeType string) bool) (*model.Image, error)
+	// StoreThumbnail saves the thumbnail of an already stored image and returns its key
+	StoreThumbnail(hash string, data []byte, ext string) (string, error)
+	// HasImage tells whether an object is stored under the key
+	HasImage(key string) (bool, error)
+	// OpenImage reads an object by the key taken from its /media/ URL
+	OpenImage(key string) (*model.ImageObject, error)
+	// ListImages returns every object in the storage, used by the garbage collector
+	ListImages() ([]model.ObjectInfo, error)
+	// DeleteImage removes an object, missing objects are not an error
+	DeleteImage(key string) error
 }
@@ -0,0 +1,17 @@
+package port
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/utils"
+	"context"
+	"time"
+)
+
+type NotificationRepo interface {
+	// CreateNotification records a reply for the session that wrote the parent comment
+	CreateNotification(ctx context.Context, sessionID, replyID utils.UUID, createdAt time.Time) error
+	// GetUnreadNotifications lists unread replies across all threads, newest first
+	GetUnreadNotifications(ctx context.Context, sessionID utils.UUID) ([]model.Notification, error)
+	// MarkNotificationsRead marks the given replies read, all of them when replyIDs is empty
+	MarkNotificationsRead(ctx context.Context, sessionID utils.UUID, replyIDs []utils.UUID, readAt time.Time) error
+}
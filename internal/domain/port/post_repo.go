@@ -5,13 +5,40 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
-	"database/sql"
+	"time"
 )
 
 type PostRepo interface {
 	CreatePost(ctx context.Context, post *model.Post) error
 	GetPostByID(ctx context.Context, id utils.UUID) (*model.Post, error)
-	GetAllPosts(ctx context.Context, archived bool) ([]*model.Post, error)
-	ArchivePostTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error
-	UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error
+	// GetAllPosts lists the board's active or archived posts, boardID 0 lists every board
+	GetAllPosts(ctx context.Context, boardID int, archived bool) ([]*model.Post, error)
+	// ListPosts returns up to limit threads of the board next to the cursor, in display
+	// order. Without a cursor it starts at the top, backward walks towards the top.
+	ListPosts(ctx context.Context, boardID int, archived bool, cursor *model.Cursor, backward bool, limit int) ([]*model.Post, error)
+	ArchivePost(ctx context.Context, postID utils.UUID) error
+	// ArchiveOverflow archives the least recently bumped threads of a board beyond
+	// maxThreads active ones, sticky threads are left out. Concurrent callers on
+	// one board are serialized until their transaction ends.
+	ArchiveOverflow(ctx context.Context, boardID, maxThreads int) ([]utils.UUID, error)
+	// SetSticky and SetLocked are operator switches
+	SetSticky(ctx context.Context, postID utils.UUID, sticky bool) error
+	SetLocked(ctx context.Context, postID utils.UUID, locked bool) error
+	// LockThread holds the thread's row until the transaction ends and counts its comments, tombstones included
+	// Replies to the same thread then decide about the bump limit one after another
+	LockThread(ctx context.Context, postID utils.UUID) (int, error)
+	// BumpPost moves the thread to the top of its catalog
+	BumpPost(ctx context.Context, postID utils.UUID, bumpedAt time.Time) error
+	// GetThreadsBySession lists the session's threads, archived ones included, newest first
+	GetThreadsBySession(ctx context.Context, sessionID utils.UUID) ([]model.ThreadActivity, error)
+	// DeletePost removes the thread with its comments
+	// It returns the images nothing refers to anymore, their files are still stored
+	DeletePost(ctx context.Context, postID utils.UUID) ([]model.Image, error)
+	// DeletePostImages unlinks the post's images and keeps the post
+	DeletePostImages(ctx context.Context, postID utils.UUID) ([]model.Image, error)
+	// UpdatePost saves the current version as a revision, then writes title, content and EditedAt
+	// With replaceImages the links are swapped for post.Attachments
+	UpdatePost(ctx context.Context, post *model.Post, replaceImages bool) ([]model.Image, error)
+	// GetPostRevisions lists earlier versions of the post, oldest first
+	GetPostRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error)
 }
@@ -8,8 +8,24 @@ import (
 )
 
 type PostService interface {
+	// CreatePost puts the post on the board named by post.BoardSlug
 	CreatePost(ctx context.Context, post *model.Post, imageData map[string]io.Reader) error
-	GetAllPosts(ctx context.Context, archived bool) ([]*model.Post, error)
+	// GetAllPosts lists the board's active or archived posts, boardID 0 lists every board
+	GetAllPosts(ctx context.Context, boardID int, archived bool) ([]*model.Post, error)
+	// ListPosts returns one page of the board's catalog or archive
+	ListPosts(ctx context.Context, boardID int, archived bool, page model.PageRequest) (*model.PostPage, error)
 	GetPostByID(ctx context.Context, postID utils.UUID) (*model.Post, error)
+	// ArchivePost archives the thread once it expired, sticky threads never expire
 	ArchivePost(ctx context.Context, postID utils.UUID) error
+	// SetSticky and SetLocked are for operators, there is no author check
+	SetSticky(ctx context.Context, postID utils.UUID, sticky bool) error
+	SetLocked(ctx context.Context, postID utils.UUID, locked bool) error
+	// GetSessionActivity collects the threads and comments written by the session
+	GetSessionActivity(ctx context.Context, sessionID utils.UUID) (*model.SessionActivity, error)
+	// DeletePost fails with ErrNotOwner unless sessionID wrote the post
+	DeletePost(ctx context.Context, postID, sessionID utils.UUID, imagesOnly bool) error
+	// EditPost fails with ErrNotOwner for strangers and ErrEditWindowClosed once the window is over
+	EditPost(ctx context.Context, postID, sessionID utils.UUID, edit model.Edit, imageData map[string]io.Reader) error
+	// GetThreadRevisions is the edit history of the post and its comments
+	GetThreadRevisions(ctx context.Context, postID utils.UUID) (*model.ThreadRevisions, error)
 }
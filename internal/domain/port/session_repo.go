@@ -5,10 +5,29 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
+	"time"
 )
 
 type SessionRepo interface {
+	// AllocateAvatar takes the least used avatar of 1..avatarPool among active sessions,
+	// so avatars repeat only once the pool is exhausted. 0 when none is free right now.
+	AllocateAvatar(ctx context.Context, avatarPool int) (int, error)
+	// CreateSession saves the session with its avatar ID and URL
 	CreateSession(ctx context.Context, session *model.Session) error
+	// SetDisplayName stores the name on the session and records it in the name history from the given time
+	SetDisplayName(ctx context.Context, id utils.UUID, name string, at time.Time) error
 	GetSessionByID(ctx context.Context, id utils.UUID) (*model.Session, error)
+	ExtendSession(ctx context.Context, id utils.UUID, expiresAt time.Time) error
+	// RotateSessionID renames the session, posts and comments follow it
+	RotateSessionID(ctx context.Context, oldID, newID utils.UUID) error
+
+	// Recovery codes are stored as SHA-256 hashes, one per session
+	ReplaceRecoveryCode(ctx context.Context, sessionID utils.UUID, codeHash string, at time.Time) error
+	// ConsumeRecoveryCode deletes the code and returns its session, ErrInvalidRecovery if there is none
+	ConsumeRecoveryCode(ctx context.Context, codeHash string) (utils.UUID, error)
+	DeleteRecoveryCodes(ctx context.Context, sessionID utils.UUID) error
+	// DeleteExpiredSession removes expired sessions that never posted, the others stay as authors of their posts
 	DeleteExpiredSession(ctx context.Context) error
+	// RecountAvatars counts the unexpired sessions of every avatar, so expired ones free theirs even when the row stays
+	RecountAvatars(ctx context.Context) error
 }
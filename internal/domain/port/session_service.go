@@ -9,6 +9,19 @@ import (
 type SessionService interface {
 	CreateSession(ctx context.Context, session *model.Session) error
 	GetSessionByID(ctx context.Context, id utils.UUID) (*model.Session, error)
+	// RenewSession pushes expires_at forward when sliding expiry is on and the session is close to expiring
+	// Reports whether the session was extended, so the cookie can be re-issued
+	RenewSession(ctx context.Context, session *model.Session) (bool, error)
 	DeleteExpiredSessions(ctx context.Context) error
-	OverrideUserName(ctx context.Context, sessionID utils.UUID, newName string) error
-}
\ No newline at end of file
+	SetDisplayName(ctx context.Context, sessionID utils.UUID, name string) error
+	// RotateSessionID moves the session to a fresh ID, the old one stops working
+	RotateSessionID(ctx context.Context, sessionID utils.UUID) (*model.Session, error)
+
+	// IssueRecoveryCode returns a new one-time code for the session, replacing any unused one
+	// The code is shown once, only its hash is kept
+	IssueRecoveryCode(ctx context.Context, sessionID utils.UUID) (string, error)
+	// RedeemRecoveryCode returns the session the code belongs to and burns the code
+	// client identifies the caller for rate limiting
+	RedeemRecoveryCode(ctx context.Context, code, client string) (*model.Session, error)
+	RevokeRecoveryCodes(ctx context.Context, sessionID utils.UUID) error
+}
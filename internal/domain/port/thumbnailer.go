@@ -0,0 +1,7 @@
+package port
+
+type Thumbnailer interface {
+	// Thumbnail scales the image down to the configured size
+	// Returns encoded thumbnail and file extension matching its format (".jpg" or ".png")
+	Thumbnail(data []byte) ([]byte, string, error)
+}
@@ -0,0 +1,6 @@
+package port
+
+type Tripcoder interface {
+	// Tripcode hashes a secret into the public code shown next to the name
+	Tripcode(secret string, secure bool) string
+}
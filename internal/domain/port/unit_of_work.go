@@ -0,0 +1,17 @@
+package port
+
+import "context"
+
+// UnitOfWork runs several repository calls as one transaction
+type UnitOfWork interface {
+	// Do commits when fn returns nil, otherwise the transaction is rolled back
+	Do(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// Tx hands out repositories bound to the running transaction
+type Tx interface {
+	Posts() PostRepo
+	Comments() CommentRepo
+	Notifications() NotificationRepo
+	Images() ImageRepo
+}
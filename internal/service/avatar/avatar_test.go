@@ -0,0 +1,127 @@
+package avatar
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/service/avatar/avatarstub"
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRemoteProvider(t *testing.T) {
+	srv := avatarstub.NewServer()
+	defer srv.Close()
+
+	provider := NewRemoteProvider(srv.BaseURL(), 3)
+	url, err := provider.AvatarURL(context.Background(), "sess-1", 0)
+	if err != nil {
+		t.Fatalf("AvatarURL failed: %v", err)
+	}
+	if !strings.HasPrefix(url, srv.URL+"/api/character/avatar/") {
+		t.Errorf("unexpected avatar URL: %s", url)
+	}
+}
+
+func TestRemoteProvider_AllocatedID(t *testing.T) {
+	srv := avatarstub.NewServer()
+	defer srv.Close()
+
+	provider := NewRemoteProvider(srv.BaseURL(), 826)
+	url, err := provider.AvatarURL(context.Background(), "sess-1", 42)
+	if err != nil {
+		t.Fatalf("AvatarURL failed: %v", err)
+	}
+	if url != srv.URL+"/api/character/avatar/42.jpeg" {
+		t.Errorf("expected the allocated character, got %s", url)
+	}
+}
+
+func TestRemoteProvider_Down(t *testing.T) {
+	srv := avatarstub.NewServer()
+	defer srv.Close()
+	srv.Fail(http.StatusServiceUnavailable)
+
+	provider := NewRemoteProvider(srv.BaseURL(), 3)
+	if _, err := provider.AvatarURL(context.Background(), "sess-1", 0); err == nil {
+		t.Error("expected error when the API is down")
+	}
+}
+
+func TestChain_FallsBackToIdenticon(t *testing.T) {
+	srv := avatarstub.NewServer()
+	srv.Close() // nothing listens any more
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	chain := NewChain(logger, NewRemoteProvider(srv.BaseURL(), 3))
+
+	url, err := chain.AvatarURL(context.Background(), "sess-1", 0)
+	if err != nil {
+		t.Fatalf("chain must never fail, got %v", err)
+	}
+	if url != IdenticonURL("sess-1") {
+		t.Errorf("expected generated avatar, got %s", url)
+	}
+}
+
+func TestChain_UsesFirstWorkingProvider(t *testing.T) {
+	srv := avatarstub.NewServer()
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	chain := NewChain(logger, NewRemoteProvider(srv.BaseURL(), 3), NewIdenticon())
+
+	url, _ := chain.AvatarURL(context.Background(), "sess-1", 0)
+	if !strings.HasPrefix(url, srv.URL) || srv.Requests() != 1 {
+		t.Errorf("expected remote avatar, got %s after %d requests", url, srv.Requests())
+	}
+}
+
+func TestIdenticon(t *testing.T) {
+	g := NewIdenticon()
+
+	url, _ := g.AvatarURL(context.Background(), "sess-1", 0)
+	if strings.Contains(url, "sess-1") {
+		t.Error("avatar URL must not reveal the session ID")
+	}
+	if url != IdenticonURL("sess-1") {
+		t.Errorf("expected stable URL, got %s", url)
+	}
+
+	seed := strings.TrimSuffix(strings.TrimPrefix(url, URLPrefix), ".png")
+	first, err := g.RenderAvatar(seed)
+	if err != nil {
+		t.Fatalf("RenderAvatar failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("avatar is not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != identiconSize || b.Dy() != identiconSize {
+		t.Errorf("unexpected avatar size %v", b)
+	}
+
+	second, _ := g.RenderAvatar(seed)
+	if !bytes.Equal(first, second) {
+		t.Error("expected the same seed to render the same avatar")
+	}
+
+	otherURL, _ := g.AvatarURL(context.Background(), "sess-2", 0)
+	other, _ := g.RenderAvatar(strings.TrimSuffix(strings.TrimPrefix(otherURL, URLPrefix), ".png"))
+	if bytes.Equal(first, other) {
+		t.Error("expected different sessions to get different avatars")
+	}
+}
+
+func TestIdenticon_BadSeed(t *testing.T) {
+	for _, seed := range []string{"", "../etc/passwd", strings.Repeat("g", seedHexLength), strings.Repeat("a", seedHexLength+1)} {
+		if _, err := NewIdenticon().RenderAvatar(seed); !errors.Is(err, model.ErrInvalidInput) {
+			t.Errorf("seed %q: expected ErrInvalidInput, got %v", seed, err)
+		}
+	}
+}
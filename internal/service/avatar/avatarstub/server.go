@@ -0,0 +1,69 @@
+// In-process stand-in for the Rick and Morty character API, used by tests
+// Serves GET /api/character/{id} with {"id": N, "image": "<url>"}
+package avatarstub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const basePath = "/api/character/"
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int // non-zero makes every request fail with it
+	requests int
+}
+
+// NewServer starts the stand-in server, caller must Close it
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// BaseURL is what AVATAR_API_BASE_URL would be set to
+func (s *Server) BaseURL() string {
+	return s.URL + strings.TrimSuffix(basePath, "/")
+}
+
+// Fail makes the server answer every request with status, 0 restores normal answers
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Requests returns how many requests the server has answered
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	status := s.status
+	s.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, basePath))
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, basePath) || err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id": %d, "image": "%s/api/character/avatar/%d.jpeg"}`, id, s.URL, id)
+}
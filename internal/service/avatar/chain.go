@@ -0,0 +1,30 @@
+package avatar
+
+import (
+	"1337b04rd/internal/domain/port"
+	"1337b04rd/pkg/utils"
+	"context"
+	"log/slog"
+)
+
+// Chain asks providers in order and falls back to an identicon when all of them fail
+// so creating a session never fails because of avatars
+type Chain struct {
+	providers []port.AvatarProvider
+	logger    *slog.Logger
+}
+
+func NewChain(logger *slog.Logger, providers ...port.AvatarProvider) *Chain {
+	return &Chain{providers: providers, logger: logger}
+}
+
+func (c *Chain) AvatarURL(ctx context.Context, sessionID utils.UUID, avatarID int) (string, error) {
+	for _, p := range c.providers {
+		url, err := p.AvatarURL(ctx, sessionID, avatarID)
+		if err == nil {
+			return url, nil
+		}
+		c.logger.Warn("avatar provider failed, trying the next one", slog.Any("error", err))
+	}
+	return IdenticonURL(sessionID), nil
+}
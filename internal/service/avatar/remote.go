@@ -0,0 +1,70 @@
+package avatar
+
+import (
+	"1337b04rd/pkg/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RemoteProvider takes the image of a random character from a Rick and Morty style API:
+// GET <BaseURL>/<id> returns {"image": "<url>"}, ids go from 1 to Characters
+type RemoteProvider struct {
+	BaseURL    string
+	Characters int
+	Client     *http.Client
+}
+
+func NewRemoteProvider(baseURL string, characters int) *RemoteProvider {
+	return &RemoteProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Characters: characters,
+		// New visitors wait for this call, a slow API must not hang the board
+		Client: &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+func (p *RemoteProvider) AvatarURL(ctx context.Context, sessionID utils.UUID, avatarID int) (string, error) {
+	if avatarID < 1 || avatarID > p.Characters {
+		avatarID = rand.IntN(p.Characters) + 1
+	}
+
+	url := fmt.Sprintf("%s/%d", p.BaseURL, avatarID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("building avatar request: %w", err)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching avatar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from avatar API: %d", resp.StatusCode)
+	}
+
+	var data struct {
+		Image string `json:"image"`
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("reading avatar response: %w", err)
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", fmt.Errorf("decoding avatar JSON: %w", err)
+	}
+	if data.Image == "" {
+		return "", fmt.Errorf("avatar API returned no image")
+	}
+
+	return data.Image, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
+	"1337b04rd/pkg/logger"
+	"context"
+	"log/slog"
+)
+
+type BoardServiceImpl struct {
+	repo   port.BoardRepo
+	logger *slog.Logger
+}
+
+func NewBoardServiceImpl(repo port.BoardRepo, logger *slog.Logger) *BoardServiceImpl {
+	return &BoardServiceImpl{repo: repo, logger: logger}
+}
+
+func (s *BoardServiceImpl) GetBoards(ctx context.Context) ([]model.Board, error) {
+	boards, err := s.repo.GetBoards(ctx)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetBoards", "fetching boards", err)
+	}
+	return boards, nil
+}
+
+// Slugs come straight from the URL, malformed ones never reach the database
+func (s *BoardServiceImpl) GetBoard(ctx context.Context, slug string) (*model.Board, error) {
+	if !model.ValidBoardSlug(slug) {
+		return nil, logger.ErrorWrapper("service", "GetBoard", "checking slug", model.ErrBoardNotFound)
+	}
+
+	board, err := s.repo.GetBoardBySlug(ctx, slug)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetBoard", "fetching board", err)
+	}
+	return board, nil
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestGetBoard(t *testing.T) {
+	svc := NewBoardServiceImpl(&MockBoardRepo{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	board, err := svc.GetBoard(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("GetBoard failed: %v", err)
+	}
+	if board.BoardID != 1 {
+		t.Errorf("unexpected board: %+v", board)
+	}
+
+	for _, slug := range []string{"g", "", "B", "b/posts", "toolongslug1"} {
+		if _, err := svc.GetBoard(context.Background(), slug); !errors.Is(err, model.ErrBoardNotFound) {
+			t.Errorf("slug %q: expected ErrBoardNotFound, got %v", slug, err)
+		}
+	}
+}
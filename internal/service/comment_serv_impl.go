@@ -17,15 +17,25 @@ import (
 type CommentServiceImpl struct {
 	repo        port.PostRepo
 	commentRepo port.CommentRepo
+	boards      port.BoardRepo
+	notifies    port.NotificationRepo
+	uow         port.UnitOfWork
 	uploader    port.ImageUploader
+	thumbnailer port.Thumbnailer
+	editWindow  time.Duration // how long after posting the author may edit
 	logger      *slog.Logger
 }
 
-func NewCommentServiceImpl(repo port.PostRepo, commentRepo port.CommentRepo, uploader port.ImageUploader, logger *slog.Logger) *CommentServiceImpl {
+func NewCommentServiceImpl(repo port.PostRepo, commentRepo port.CommentRepo, boards port.BoardRepo, notifies port.NotificationRepo, uow port.UnitOfWork, uploader port.ImageUploader, thumbnailer port.Thumbnailer, editWindow time.Duration, logger *slog.Logger) *CommentServiceImpl {
 	return &CommentServiceImpl{
 		repo:        repo,
 		commentRepo: commentRepo,
+		boards:      boards,
+		notifies:    notifies,
+		uow:         uow,
 		uploader:    uploader,
+		thumbnailer: thumbnailer,
+		editWindow:  editWindow,
 		logger:      logger,
 	}
 }
@@ -51,10 +61,14 @@ func (s *CommentServiceImpl) CreateComment(ctx context.Context, comment *model.C
 	if post.IsArchived {
 		return errors.New("cannot comment on archived post")
 	}
+	if post.IsLocked {
+		return logger.ErrorWrapper("service", "CreateComment", "checking thread", model.ErrThreadLocked)
+	}
 
 	// Check if the ParentCommentID exists in the db
+	var parent *model.Comment
 	if comment.ParentCommentID != "" {
-		parent, err := s.commentRepo.GetCommentByID(ctx, comment.ParentCommentID)
+		parent, err = s.commentRepo.GetCommentByID(ctx, comment.ParentCommentID)
 		if err != nil {
 			return logger.ErrorWrapper("service", "CreateComment", "checking parent comment", err)
 		}
@@ -62,6 +76,9 @@ func (s *CommentServiceImpl) CreateComment(ctx context.Context, comment *model.C
 		if parent.IsArchived {
 			return errors.New("cannot reply to archived comment")
 		}
+		if parent.IsDeleted {
+			return errors.New("cannot reply to deleted comment")
+		}
 		// Check if comment.ParentCommentID refers to the comment under the same PostID
 		if parent.PostID != comment.PostID {
 			return errors.New("cannot reply to comment from different post")
@@ -70,33 +87,68 @@ func (s *CommentServiceImpl) CreateComment(ctx context.Context, comment *model.C
 
 	// Ensure text or image exists
 	if strings.TrimSpace(comment.Content) == "" && len(imageData) == 0 {
-		return errors.New("comment cannot be empty")
+		return model.ErrCommentEmpty
+	}
+
+	// Upload rules and the bump limit come from the thread's board
+	board, err := s.boards.GetBoardByID(ctx, post.BoardID)
+	if err != nil {
+		return logger.ErrorWrapper("service", "CreateComment", "finding board", err)
 	}
 
-	// Check if there are any images attached
+	// Upload comment images and their thumbnails before the transaction
+	var uploaded uploads
 	if len(imageData) > 0 {
+		uploaded, err = uploadImages(imageData, board, s.uploader, s.thumbnailer)
+		if err != nil {
+			s.logger.Error("comment image upload failed", slog.Any("error", err))
+			releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+			return logger.ErrorWrapper("service", "CreateComment", "comment image uploading", err)
+		}
 
-		// Upload comment images to buckets
-		var urls []string
-		for filename, content := range imageData {
-			url, err := s.uploader.UploadCommentImage(string(post.PostID), string(comment.CommentID), filename, content)
-			if err != nil {
-				s.logger.Error("comment image upload failed", slog.String("filename", filename), slog.Any("error", err))
-				return logger.ErrorWrapper("service", "CreateComment", "comment image uploading", err)
-			}
+		// Save image rows to db, they are referenced by hash
+		comment.Attachments = uploaded.attachments()
+	}
+
+	// Image rows, the comment and its notification are saved together
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
 
-			urls = append(urls, url)
+		// The files have to be there when the links commit
+		if err := pinUploads(ctx, tx, s.uploader, uploaded); err != nil {
+			return logger.ErrorWrapper("service", "CreateComment", "pinning images", err)
 		}
 
-		// Save urls to db
-		comment.ImageURLs = urls
-	}
+		// Counted under the thread's lock, post.ReplyCount may be stale by now
+		replies, err := tx.Posts().LockThread(ctx, post.PostID)
+		if err != nil {
+			return logger.ErrorWrapper("service", "CreateComment", "locking thread", err)
+		}
 
-	// Save the comment to the repo
-	if err := s.commentRepo.CreateComment(ctx, comment); err != nil {
-		return logger.ErrorWrapper("service", "CreateComment", "saving comment to db", err)
-	}
+		// Save the comment to the repo
+		if err := tx.Comments().CreateComment(ctx, comment); err != nil {
+			return logger.ErrorWrapper("service", "CreateComment", "saving comment to db", err)
+		}
 
+		// Sage and replies past the bump limit leave the thread where it is
+		if !comment.Sage && board.Bumps(replies) {
+			if err := tx.Posts().BumpPost(ctx, post.PostID, comment.CreatedAt); err != nil {
+				return logger.ErrorWrapper("service", "CreateComment", "bumping thread", err)
+			}
+		}
+
+		// The parent's author learns about the reply, answering yourself is not news
+		if parent != nil && parent.SessionID != comment.SessionID {
+			if err := tx.Notifications().CreateNotification(ctx, parent.SessionID, comment.CommentID, comment.CreatedAt); err != nil {
+				return logger.ErrorWrapper("service", "CreateComment", "notifying parent author", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Only files this call wrote, older ones may belong to other posts
+		releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+		return err
+	}
 	return nil
 }
 
@@ -113,3 +165,132 @@ func (s *CommentServiceImpl) GetCommentsByPostID(ctx context.Context, postID uti
 	s.logger.Info("retrieved comments by post id successfully", slog.String("post_id", string(postID)), slog.Bool("include_archived", includeArchived))
 	return comments, nil
 }
+
+// DeleteComment lets the author leave a "[deleted]" tombstone, or with imagesOnly remove just the pictures
+// Files nothing uses anymore are deleted after the commit
+func (s *CommentServiceImpl) DeleteComment(ctx context.Context, postID, commentID, sessionID utils.UUID, imagesOnly bool) error {
+	comment, err := s.commentRepo.GetCommentByID(ctx, commentID)
+	if err != nil {
+		return logger.ErrorWrapper("service", "DeleteComment", "getting comment", err)
+	}
+	// A comment is only found under its own thread
+	if comment.PostID != postID || comment.IsDeleted {
+		return logger.ErrorWrapper("service", "DeleteComment", "checking thread", model.ErrCommentNotFound)
+	}
+	if comment.SessionID != sessionID {
+		return logger.ErrorWrapper("service", "DeleteComment", "checking author", model.ErrNotOwner)
+	}
+
+	var released []model.Image
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
+		if imagesOnly {
+			released, err = tx.Comments().DeleteCommentImages(ctx, commentID)
+		} else {
+			released, err = tx.Comments().DeleteComment(ctx, commentID)
+		}
+		if err != nil {
+			return logger.ErrorWrapper("service", "DeleteComment", "deleting from repo", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	releaseImages(ctx, s.uow, s.uploader, released, s.logger)
+
+	s.logger.Info("comment deleted by its author", slog.String("comment_id", string(commentID)), slog.Bool("images_only", imagesOnly))
+	return nil
+}
+
+// EditComment lets the author fix content and images within the edit window
+// The replaced version is kept as a revision, files of images nothing uses anymore are deleted after the commit
+func (s *CommentServiceImpl) EditComment(ctx context.Context, postID, commentID, sessionID utils.UUID, edit model.Edit, imageData map[string]io.Reader) error {
+	comment, err := s.commentRepo.GetCommentByID(ctx, commentID)
+	if err != nil {
+		return logger.ErrorWrapper("service", "EditComment", "getting comment", err)
+	}
+	if comment.PostID != postID || comment.IsDeleted {
+		return logger.ErrorWrapper("service", "EditComment", "checking thread", model.ErrCommentNotFound)
+	}
+	if comment.SessionID != sessionID {
+		return logger.ErrorWrapper("service", "EditComment", "checking author", model.ErrNotOwner)
+	}
+	if comment.IsArchived || !model.CanEdit(comment.CreatedAt, s.editWindow) {
+		return logger.ErrorWrapper("service", "EditComment", "checking edit window", model.ErrEditWindowClosed)
+	}
+
+	// A locked thread takes no edits either, its board also sets the upload rules
+	post, err := s.repo.GetPostByID(ctx, postID)
+	if err != nil {
+		return logger.ErrorWrapper("service", "EditComment", "getting post", err)
+	}
+	if post.IsLocked {
+		return logger.ErrorWrapper("service", "EditComment", "checking thread", model.ErrThreadLocked)
+	}
+
+	// Same rule as for new comments, text or at least one image has to stay
+	replaceImages := edit.ReplaceImages || len(imageData) > 0
+	hasImages := len(comment.Attachments) > 0
+	if replaceImages {
+		hasImages = len(imageData) > 0
+	}
+	if strings.TrimSpace(edit.Content) == "" && !hasImages {
+		return model.ErrCommentEmpty
+	}
+
+	// Uploads follow the rules of the thread's board
+	board, err := uploadBoard(ctx, s.boards, post.BoardID, imageData)
+	if err != nil {
+		return logger.ErrorWrapper("service", "EditComment", "finding board", err)
+	}
+
+	now := time.Now()
+	comment.Content = edit.Content
+	comment.EditedAt = &now
+
+	var uploaded uploads
+	if replaceImages {
+		uploaded, err = uploadImages(imageData, board, s.uploader, s.thumbnailer)
+		if err != nil {
+			releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+			return logger.ErrorWrapper("service", "EditComment", "image uploading", err)
+		}
+		comment.Attachments = uploaded.attachments()
+	}
+
+	var released []model.Image
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
+		if err := pinUploads(ctx, tx, s.uploader, uploaded); err != nil {
+			return logger.ErrorWrapper("service", "EditComment", "pinning images", err)
+		}
+		if released, err = tx.Comments().UpdateComment(ctx, comment, replaceImages); err != nil {
+			return logger.ErrorWrapper("service", "EditComment", "saving edit", err)
+		}
+		return nil
+	})
+	if err != nil {
+		releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+		return err
+	}
+	releaseImages(ctx, s.uow, s.uploader, released, s.logger)
+
+	s.logger.Info("comment edited by its author", slog.String("comment_id", string(commentID)))
+	return nil
+}
+
+// GetUnreadReplies lists replies to the session's comments it has not marked read yet
+func (s *CommentServiceImpl) GetUnreadReplies(ctx context.Context, sessionID utils.UUID) ([]model.Notification, error) {
+	notifications, err := s.notifies.GetUnreadNotifications(ctx, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetUnreadReplies", "fetching notifications", err)
+	}
+	return notifications, nil
+}
+
+// MarkRepliesRead marks the given replies read, every unread reply when no IDs are given
+func (s *CommentServiceImpl) MarkRepliesRead(ctx context.Context, sessionID utils.UUID, replyIDs []utils.UUID) error {
+	if err := s.notifies.MarkNotificationsRead(ctx, sessionID, replyIDs, time.Now()); err != nil {
+		return logger.ErrorWrapper("service", "MarkRepliesRead", "marking notifications read", err)
+	}
+	return nil
+}
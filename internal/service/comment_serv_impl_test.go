@@ -4,10 +4,12 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateComment_Basic(t *testing.T) {
@@ -22,13 +24,14 @@ func TestCreateComment_Basic(t *testing.T) {
 
 	mockPost := &MockPostRepo{
 		Posts: map[utils.UUID]*model.Post{
-			postID: {PostID: postID, IsArchived: false},
+			postID: {PostID: postID, BoardID: 1, IsArchived: false},
 		},
 	}
 	mockComment := &MockCommentRepo{}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	svc := NewCommentServiceImpl(mockPost, mockComment, &MockUploader{}, logger)
+	uow := &MockUnitOfWork{Posts: mockPost, Comments: mockComment}
+	svc := NewCommentServiceImpl(mockPost, mockComment, &MockBoardRepo{}, &MockNotificationRepo{}, uow, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, logger)
 
 	err := svc.CreateComment(ctx, comment, map[string]io.Reader{
 		"file.png": strings.NewReader("dummy"),
@@ -39,9 +42,14 @@ func TestCreateComment_Basic(t *testing.T) {
 	if mockComment.CreatedComment == nil {
 		t.Error("expected comment to be created")
 	}
-	if len(mockComment.CreatedComment.ImageURLs) == 0 {
+	if len(mockComment.CreatedComment.Attachments) == 0 {
 		t.Error("expected image to be uploaded")
 	}
+	for _, a := range mockComment.CreatedComment.Attachments {
+		if a.ThumbnailKey == "" {
+			t.Error("expected a thumbnail for every image")
+		}
+	}
 	if mockComment.CreatedComment.CommentID == "" {
 		t.Error("expected comment ID to be generated")
 	}
@@ -53,7 +61,7 @@ func TestCreateComment_MissingPost(t *testing.T) {
 
 	mockPost := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := NewCommentServiceImpl(mockPost, &MockCommentRepo{}, &MockUploader{}, logger)
+	svc := NewCommentServiceImpl(mockPost, &MockCommentRepo{}, &MockBoardRepo{}, &MockNotificationRepo{}, &MockUnitOfWork{}, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, logger)
 
 	err := svc.CreateComment(ctx, comment, nil)
 	if err == nil {
@@ -67,7 +75,7 @@ func TestGetCommentsByPostID(t *testing.T) {
 
 	mockRepo := &MockCommentRepo{}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := NewCommentServiceImpl(nil, mockRepo, nil, logger)
+	svc := NewCommentServiceImpl(nil, mockRepo, &MockBoardRepo{}, nil, nil, nil, nil, 5*time.Minute, logger)
 
 	comments, err := svc.GetCommentsByPostID(ctx, postID, false)
 	if err != nil {
@@ -80,3 +88,184 @@ func TestGetCommentsByPostID(t *testing.T) {
 		t.Errorf("unexpected comment postID: %v", comments[0].PostID)
 	}
 }
+
+func TestCreateComment_NotifiesParentAuthor(t *testing.T) {
+	ctx := context.Background()
+	postID := utils.UUID("post123")
+
+	mockPost := &MockPostRepo{Posts: map[utils.UUID]*model.Post{postID: {PostID: postID, BoardID: 1}}}
+	mockComment := &MockCommentRepo{Comments: map[utils.UUID]*model.Comment{
+		"parent": {CommentID: "parent", PostID: postID, SessionID: "sess-rick"},
+	}}
+	notifies := &MockNotificationRepo{}
+	uow := &MockUnitOfWork{Posts: mockPost, Comments: mockComment, Notifications: notifies}
+	svc := NewCommentServiceImpl(mockPost, mockComment, &MockBoardRepo{}, notifies, uow, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	reply := &model.Comment{PostID: postID, SessionID: "sess-morty", ParentCommentID: "parent", Content: "Aw jeez"}
+	if err := svc.CreateComment(ctx, reply, nil); err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+	if got := notifies.Notified["sess-rick"]; len(got) != 1 || got[0] != reply.CommentID {
+		t.Errorf("expected the parent's session to be notified of the reply, got %v", notifies.Notified)
+	}
+
+	// Answering your own comment leaves no notification
+	self := &model.Comment{PostID: postID, SessionID: "sess-rick", ParentCommentID: "parent", Content: "Wubba lubba"}
+	if err := svc.CreateComment(ctx, self, nil); err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+	if got := notifies.Notified["sess-rick"]; len(got) != 1 {
+		t.Errorf("expected no notification for a self reply, got %v", got)
+	}
+}
+
+func TestMarkRepliesRead(t *testing.T) {
+	notifies := &MockNotificationRepo{}
+	svc := NewCommentServiceImpl(nil, nil, &MockBoardRepo{}, notifies, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.MarkRepliesRead(context.Background(), "sess123", []utils.UUID{"c1"}); err != nil {
+		t.Fatalf("MarkRepliesRead failed: %v", err)
+	}
+	if notifies.ReadAll || len(notifies.ReadIDs) != 1 {
+		t.Errorf("expected only c1 to be marked read, got %v", notifies.ReadIDs)
+	}
+
+	if err := svc.MarkRepliesRead(context.Background(), "sess123", nil); err != nil {
+		t.Fatalf("MarkRepliesRead failed: %v", err)
+	}
+	if !notifies.ReadAll {
+		t.Error("expected no IDs to mark every reply read")
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	ctx := context.Background()
+	mockComment := &MockCommentRepo{Comments: map[utils.UUID]*model.Comment{
+		"c1": {
+			CommentID:   "c1",
+			PostID:      "post123",
+			SessionID:   "sess-rick",
+			Attachments: []model.Attachment{{Image: model.Image{Hash: "h1", StorageKey: "h1.png"}}},
+		},
+	}}
+	uploader := &MockUploader{}
+	uow := &MockUnitOfWork{Comments: mockComment}
+	svc := NewCommentServiceImpl(nil, mockComment, &MockBoardRepo{}, nil, uow, uploader, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.DeleteComment(ctx, "post123", "c1", "sess-morty", false); !errors.Is(err, model.ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner for someone else's comment, got %v", err)
+	}
+	if err := svc.DeleteComment(ctx, "other-post", "c1", "sess-rick", false); !errors.Is(err, model.ErrCommentNotFound) {
+		t.Fatalf("expected ErrCommentNotFound under another thread, got %v", err)
+	}
+	if mockComment.Deleted != "" {
+		t.Fatal("expected nothing to be deleted so far")
+	}
+
+	if err := svc.DeleteComment(ctx, "post123", "c1", "sess-rick", false); err != nil {
+		t.Fatalf("DeleteComment failed: %v", err)
+	}
+	if mockComment.Deleted != "c1" {
+		t.Error("expected the comment to become a tombstone")
+	}
+	if len(uploader.Deleted) != 1 || uploader.Deleted[0] != "h1.png" {
+		t.Errorf("expected the file to be deleted after the commit, got %v", uploader.Deleted)
+	}
+
+	if err := svc.DeleteComment(ctx, "post123", "c1", "sess-rick", true); err != nil {
+		t.Fatalf("DeleteComment images only failed: %v", err)
+	}
+	if mockComment.ImagesDeleted != "c1" {
+		t.Error("expected only the images to be unlinked")
+	}
+}
+
+func TestEditComment(t *testing.T) {
+	ctx := context.Background()
+	mockComment := &MockCommentRepo{Comments: map[utils.UUID]*model.Comment{
+		"c1": {CommentID: "c1", PostID: "post123", SessionID: "sess-rick", Content: "Old", CreatedAt: time.Now()},
+		"c2": {CommentID: "c2", PostID: "post123", SessionID: "sess-rick", Content: "Old", CreatedAt: time.Now().Add(-time.Hour)},
+		"c3": {CommentID: "c3", PostID: "locked", SessionID: "sess-rick", Content: "Old", CreatedAt: time.Now()},
+	}}
+	mockPost := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		"post123": {PostID: "post123", BoardID: 1},
+		"locked":  {PostID: "locked", BoardID: 1, IsLocked: true},
+	}}
+	svc := NewCommentServiceImpl(mockPost, mockComment, &MockBoardRepo{}, nil, &MockUnitOfWork{Posts: mockPost, Comments: mockComment}, &MockUploader{}, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.EditComment(ctx, "post123", "c1", "sess-morty", model.Edit{Content: "New"}, nil); !errors.Is(err, model.ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner for someone else's comment, got %v", err)
+	}
+	if err := svc.EditComment(ctx, "post123", "c2", "sess-rick", model.Edit{Content: "New"}, nil); !errors.Is(err, model.ErrEditWindowClosed) {
+		t.Fatalf("expected ErrEditWindowClosed after the window, got %v", err)
+	}
+	if err := svc.EditComment(ctx, "locked", "c3", "sess-rick", model.Edit{Content: "New"}, nil); !errors.Is(err, model.ErrThreadLocked) {
+		t.Fatalf("expected ErrThreadLocked in a locked thread, got %v", err)
+	}
+	if err := svc.EditComment(ctx, "post123", "c1", "sess-rick", model.Edit{Content: "  "}, nil); !errors.Is(err, model.ErrCommentEmpty) {
+		t.Fatalf("expected ErrCommentEmpty for a comment left without text or images, got %v", err)
+	}
+	if mockComment.Updated != nil {
+		t.Fatal("expected nothing to be saved so far")
+	}
+
+	if err := svc.EditComment(ctx, "post123", "c1", "sess-rick", model.Edit{Content: "New"}, nil); err != nil {
+		t.Fatalf("EditComment failed: %v", err)
+	}
+	if mockComment.Updated == nil || mockComment.Updated.Content != "New" || mockComment.Updated.EditedAt == nil {
+		t.Errorf("expected the edit to be saved with its time, got %+v", mockComment.Updated)
+	}
+}
+
+func TestCreateComment_Bump(t *testing.T) {
+	ctx := context.Background()
+	created := time.Now().Add(-time.Hour)
+	boards := &MockBoardRepo{Boards: []model.Board{{BoardID: 1, Slug: "b", BumpLimit: 2}}}
+
+	for _, tc := range []struct {
+		name    string
+		replies int
+		sage    bool
+		bumped  bool
+	}{
+		{"reply bumps", 0, false, true},
+		{"sage", 0, true, false},
+		{"last bumping reply", 1, false, true},
+		{"past the bump limit", 2, false, false},
+	} {
+		post := &model.Post{PostID: "post123", BoardID: 1, CreatedAt: created, BumpedAt: created, ReplyCount: tc.replies}
+		mockPost := &MockPostRepo{Posts: map[utils.UUID]*model.Post{"post123": post}}
+		mockComment := &MockCommentRepo{}
+		uow := &MockUnitOfWork{Posts: mockPost, Comments: mockComment}
+		svc := NewCommentServiceImpl(mockPost, mockComment, boards, nil, uow, &MockUploader{}, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		comment := &model.Comment{PostID: "post123", SessionID: "sess123", Content: "bump", Sage: tc.sage}
+		if err := svc.CreateComment(ctx, comment, nil); err != nil {
+			t.Fatalf("%s: CreateComment failed: %v", tc.name, err)
+		}
+		if bumped := !post.BumpedAt.Equal(created); bumped != tc.bumped {
+			t.Errorf("%s: expected bumped=%v, got bumped_at %v", tc.name, tc.bumped, post.BumpedAt)
+		}
+		if tc.bumped && !post.BumpedAt.Equal(comment.CreatedAt) {
+			t.Errorf("%s: expected the thread to be bumped to the reply time", tc.name)
+		}
+	}
+}
+
+func TestCreateComment_LockedThread(t *testing.T) {
+	postID := utils.UUID("locked")
+	mockPost := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		postID: {PostID: postID, BoardID: 1, IsLocked: true},
+	}}
+	mockComment := &MockCommentRepo{}
+	uow := &MockUnitOfWork{Posts: mockPost, Comments: mockComment}
+	svc := NewCommentServiceImpl(mockPost, mockComment, &MockBoardRepo{}, &MockNotificationRepo{}, uow, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := svc.CreateComment(context.Background(), &model.Comment{PostID: postID, Content: "hi", SessionID: "sess123"}, nil)
+	if !errors.Is(err, model.ErrThreadLocked) {
+		t.Fatalf("expected ErrThreadLocked, got %v", err)
+	}
+	if mockComment.CreatedComment != nil {
+		t.Error("expected no comment in a locked thread")
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
+	"1337b04rd/pkg/logger"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// ImageGCServiceImpl removes stored files that no post or comment refers to
+// They appear when CreatePost or CreateComment fails after the uploader has written them,
+// and when the last post or comment using them is deleted or edited
+type ImageGCServiceImpl struct {
+	imageRepo   port.ImageRepo
+	uploader    port.ImageUploader
+	gracePeriod time.Duration
+	logger      *slog.Logger
+}
+
+func NewImageGCServiceImpl(imageRepo port.ImageRepo, uploader port.ImageUploader, gracePeriod time.Duration, logger *slog.Logger) *ImageGCServiceImpl {
+	return &ImageGCServiceImpl{
+		imageRepo:   imageRepo,
+		uploader:    uploader,
+		gracePeriod: gracePeriod,
+		logger:      logger,
+	}
+}
+
+// A safety net, deletes and failed posts remove their files themselves
+// Objects younger than the grace period are kept, their post may still be in the middle of being saved
+func (s *ImageGCServiceImpl) CollectOrphans(ctx context.Context, dryRun bool) (*model.GCReport, error) {
+	// Listing storage first: an upload finished after this point is simply not seen,
+	// while a post committed after it is already in the referenced keys below
+	objects, err := s.uploader.ListImages()
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "CollectOrphans", "listing storage", err)
+	}
+
+	referenced, err := s.imageRepo.ReferencedKeys(ctx)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "CollectOrphans", "loading referenced keys", err)
+	}
+
+	report := &model.GCReport{DryRun: dryRun, Scanned: len(objects), Referenced: len(referenced)}
+	cutoff := time.Now().Add(-s.gracePeriod)
+
+	for _, obj := range objects {
+		if referenced[obj.Key] {
+			continue
+		}
+		if obj.ModTime.After(cutoff) {
+			report.Recent++
+			continue
+		}
+		report.Orphans = append(report.Orphans, obj)
+	}
+
+	if dryRun {
+		s.logger.Info("orphaned images found (dry run)",
+			slog.Int("scanned", report.Scanned),
+			slog.Int("orphans", len(report.Orphans)),
+			slog.Int("recent", report.Recent))
+		return report, nil
+	}
+
+	for _, obj := range report.Orphans {
+		if err := ctx.Err(); err != nil {
+			return report, logger.ErrorWrapper("service", "CollectOrphans", "deleting orphans", err)
+		}
+		if err := s.uploader.DeleteImage(obj.Key); err != nil {
+			s.logger.Error("failed to delete orphaned image", slog.String("key", obj.Key), slog.Any("error", err))
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+	}
+
+	s.logger.Info("orphaned images collected",
+		slog.Int("scanned", report.Scanned),
+		slog.Int("deleted", report.Deleted),
+		slog.Int("failed", report.Failed),
+		slog.Int("recent", report.Recent))
+	return report, nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newGCFixture() (*MockImageRepo, *MockUploader) {
+	old := time.Now().Add(-2 * time.Hour)
+	repo := &MockImageRepo{Referenced: map[string]bool{"aa/used.png": true, "aa/used_thumb.jpg": true}}
+	uploader := &MockUploader{Objects: []model.ObjectInfo{
+		{Key: "aa/used.png", ModTime: old},
+		{Key: "aa/used_thumb.jpg", ModTime: old},
+		{Key: "bb/orphan.png", ModTime: old},
+		{Key: "cc/fresh.png", ModTime: time.Now()},
+	}}
+	return repo, uploader
+}
+
+func TestCollectOrphans(t *testing.T) {
+	repo, uploader := newGCFixture()
+	svc := NewImageGCServiceImpl(repo, uploader, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	report, err := svc.CollectOrphans(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CollectOrphans failed: %v", err)
+	}
+
+	if len(uploader.Deleted) != 1 || uploader.Deleted[0] != "bb/orphan.png" {
+		t.Errorf("expected only the old orphan to be deleted, got %v", uploader.Deleted)
+	}
+	if report.Scanned != 4 || report.Deleted != 1 || report.Recent != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestCollectOrphans_DryRun(t *testing.T) {
+	repo, uploader := newGCFixture()
+	svc := NewImageGCServiceImpl(repo, uploader, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	report, err := svc.CollectOrphans(context.Background(), true)
+	if err != nil {
+		t.Fatalf("CollectOrphans failed: %v", err)
+	}
+
+	if len(uploader.Deleted) != 0 {
+		t.Errorf("dry run must not delete anything, deleted %v", uploader.Deleted)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Key != "bb/orphan.png" || !report.DryRun {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestCollectOrphans_RepoError(t *testing.T) {
+	repo, uploader := newGCFixture()
+	repo.Err = model.ErrDatabase
+	svc := NewImageGCServiceImpl(repo, uploader, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Without the referenced keys every object would look orphaned
+	_, err := svc.CollectOrphans(context.Background(), false)
+	if !errors.Is(err, model.ErrDatabase) {
+		t.Errorf("expected ErrDatabase, got %v", err)
+	}
+	if len(uploader.Deleted) != 0 {
+		t.Errorf("expected nothing deleted on repo error, got %v", uploader.Deleted)
+	}
+}
@@ -0,0 +1,85 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var mimeExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Objects are keyed by content hash: <first 2 hex chars>/<sha256>.<ext>
+// The prefix directory keeps folders small on the local disk
+func imageKey(hash, ext string) string {
+	return path.Join(hash[:2], hash+ext)
+}
+
+// Thumbnail sits right next to its original: <prefix>/<sha256>_thumb.<ext>
+func thumbnailKey(hash, ext string) string {
+	return path.Join(hash[:2], hash+"_thumb"+ext)
+}
+
+// newImage describes validated image data, the hash is what makes identical uploads collapse into one object
+func newImage(data []byte, info *ImageInfo) *model.Image {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	return &model.Image{
+		Hash:       hash,
+		StorageKey: imageKey(hash, mimeExtensions[info.ContentType]),
+		MimeType:   info.ContentType,
+		Size:       int64(len(data)),
+		Width:      info.Width,
+		Height:     info.Height,
+	}
+}
+
+// Checks arguments of StoreThumbnail, the hash comes from StoreImage
+func validateThumbnail(hash, ext string) error {
+	if len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return fmt.Errorf("thumbnail hash %q: %w", hash, model.ErrInvalidInput)
+	}
+	if ext != ".jpg" && ext != ".png" {
+		return fmt.Errorf("thumbnail extension %q: %w", ext, model.ErrUnsupportedImageType)
+	}
+	return nil
+}
+
+// validateKey makes sure the object key stays inside the storage root
+func validateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "\\\x00") || strings.HasPrefix(key, "/") {
+		return model.ErrInvalidInput
+	}
+	if path.Clean(key) != key {
+		return model.ErrInvalidInput
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." || strings.HasPrefix(part, ".") {
+			return model.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// Content type by extension, falls back to sniffing the content
+func contentTypeOf(key string, data []byte) string {
+	if ct := mime.TypeByExtension(strings.ToLower(filepath.Ext(key))); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
+
+func etagOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
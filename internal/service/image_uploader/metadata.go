@@ -0,0 +1,384 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// stripMetadata removes EXIF (GPS, camera serials), XMP, comments and text chunks
+// Pixel data is copied untouched, so nothing is recompressed
+// Trailing bytes after the end of the image (phone "motion photos", appended archives) are dropped too
+// GPS coordinates and camera details must not leave the poster's phone, and since
+// StoreImage hashes the stripped bytes, the same photo with different EXIF is stored once
+func stripMetadata(data []byte, contentType string) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch contentType {
+	case "image/jpeg":
+		out, err = stripJPEG(data)
+	case "image/png":
+		out, err = stripPNG(data)
+	case "image/gif":
+		out, err = stripGIF(data)
+	default:
+		return nil, fmt.Errorf("stripping %q: %w", contentType, model.ErrUnsupportedImageType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stripping metadata: %w: %v", model.ErrInvalidImage, err)
+	}
+	return out, nil
+}
+
+// ========== JPEG ==========
+
+const (
+	jpegSOI  = 0xD8
+	jpegEOI  = 0xD9
+	jpegSOS  = 0xDA
+	jpegAPP0 = 0xE0
+	jpegAPP1 = 0xE1 // EXIF and XMP
+	jpegAPP2 = 0xE2 // ICC profile, also MPF
+	jpegCOM  = 0xFE
+)
+
+// Orientation is the only EXIF tag worth keeping, without it phone photos show up sideways
+const exifOrientationTag = 0x0112
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return nil, fmt.Errorf("missing SOI marker")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	orientation := 0
+	exifPending := true // minimal EXIF goes right after APP0, before any other segment
+	i := 2
+
+	for {
+		if i >= len(data) || data[i] != 0xFF {
+			return nil, fmt.Errorf("expected marker at offset %d", i)
+		}
+		// Any number of 0xFF fill bytes may precede a marker
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i >= len(data) {
+			return nil, fmt.Errorf("truncated marker")
+		}
+		marker := data[i]
+		i++
+
+		if marker == jpegEOI {
+			out.Write([]byte{0xFF, jpegEOI})
+			return out.Bytes(), nil
+		}
+		// Standalone markers carry no length
+		if (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			out.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, fmt.Errorf("truncated segment length")
+		}
+		length := int(binary.BigEndian.Uint16(data[i:]))
+		if length < 2 || i+length > len(data) {
+			return nil, fmt.Errorf("bad segment length %d", length)
+		}
+		payload := data[i+2 : i+length]
+		i += length
+
+		if dropJPEGSegment(marker, payload) {
+			if marker == jpegAPP1 && orientation == 0 {
+				orientation = exifOrientation(payload)
+			}
+			continue
+		}
+
+		if exifPending && marker != jpegAPP0 {
+			if orientation > 1 {
+				out.Write(orientationSegment(orientation))
+			}
+			exifPending = false
+		}
+		out.Write([]byte{0xFF, marker})
+		out.Write(data[i-length : i])
+
+		// Entropy-coded data follows the scan header, it runs until the next real marker
+		if marker == jpegSOS {
+			j := i
+			for {
+				if j+1 >= len(data) {
+					return nil, fmt.Errorf("truncated scan data")
+				}
+				if data[j] == 0xFF {
+					next := data[j+1]
+					// Stuffed zero byte and restart markers belong to the scan
+					if next == 0x00 || (next >= 0xD0 && next <= 0xD7) {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			out.Write(data[i:j])
+			i = j
+		}
+	}
+}
+
+// APP0 (JFIF), APP14 (Adobe color transform) and ICC profiles are needed to render the image
+// Everything else in APPn and COM is metadata
+func dropJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == jpegCOM:
+		return true
+	case marker == jpegAPP2:
+		return !bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == jpegAPP0 || marker == 0xEE:
+		return false
+	case marker >= jpegAPP1 && marker <= 0xEF:
+		return true
+	}
+	return false
+}
+
+// exifOrientation reads the orientation tag from IFD0 of an EXIF APP1 payload
+// Returns 0 if the payload is not EXIF or has no valid orientation
+func exifOrientation(payload []byte) int {
+	tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// SHORT value is stored inline in the first two bytes of the value field
+		if order.Uint16(tiff[entry:]) == exifOrientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// jpegOrientation finds the EXIF orientation of a JPEG, 0 when it has none
+// Only the segments before the first scan are looked at, that is where APP1 lives
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return 0
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == jpegSOS || marker == jpegEOI {
+			return 0
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0
+		}
+		if marker == jpegAPP1 {
+			if o := exifOrientation(data[i+4 : i+2+length]); o != 0 {
+				return o
+			}
+		}
+		i += 2 + length
+	}
+	return 0
+}
+
+// orientationSegment builds an APP1 segment whose EXIF holds nothing but the orientation
+func orientationSegment(orientation int) []byte {
+	payload := []byte("Exif\x00\x00")
+	payload = append(payload, 'M', 'M', 0, 42, 0, 0, 0, 8) // big endian TIFF header, IFD0 at offset 8
+	payload = append(payload, 0, 1)                        // one entry
+	payload = binary.BigEndian.AppendUint16(payload, exifOrientationTag)
+	payload = append(payload, 0, 3, 0, 0, 0, 1) // SHORT, count 1
+	payload = binary.BigEndian.AppendUint16(payload, uint16(orientation))
+	payload = append(payload, 0, 0, 0, 0, 0, 0) // value padding, no next IFD
+
+	segment := []byte{0xFF, jpegAPP1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// ========== PNG ==========
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Ancillary chunks that affect how the image looks, the rest (tEXt, zTXt, iTXt, eXIf, tIME...) is dropped
+// Critical chunks are always kept, animation chunks keep APNGs moving
+var pngKeepChunks = map[string]bool{
+	"tRNS": true,
+	"gAMA": true,
+	"cHRM": true,
+	"sRGB": true,
+	"iCCP": true,
+	"sBIT": true,
+	"bKGD": true,
+	"pHYs": true,
+	"acTL": true,
+	"fcTL": true,
+	"fdAT": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("missing PNG signature")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	for i := len(pngSignature); ; {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("truncated chunk header")
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length // header, data and CRC
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("bad chunk length %d", length)
+		}
+
+		critical := chunkType[0] >= 'A' && chunkType[0] <= 'Z'
+		if critical || pngKeepChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		if chunkType == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+}
+
+// ========== GIF ==========
+
+// Application extensions that only control looping, XMP and others are dropped
+var gifKeepApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (!bytes.HasPrefix(data, []byte("GIF87a")) && !bytes.HasPrefix(data, []byte("GIF89a"))) {
+		return nil, fmt.Errorf("missing GIF header")
+	}
+
+	// Header and logical screen descriptor, then the global color table if present
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (int(flags&0x07) + 1)
+	}
+	if i > len(data) {
+		return nil, fmt.Errorf("truncated color table")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+
+	for {
+		if i >= len(data) {
+			return nil, fmt.Errorf("missing trailer")
+		}
+
+		switch data[i] {
+		case 0x3B: // trailer
+			out.WriteByte(0x3B)
+			return out.Bytes(), nil
+
+		case 0x21: // extension: introducer, label, sub-blocks
+			if i+2 > len(data) {
+				return nil, fmt.Errorf("truncated extension")
+			}
+			end, err := gifSubBlocksEnd(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			if keepGIFExtension(data[i+1], data[i+2:end]) {
+				out.Write(data[i:end])
+			}
+			i = end
+
+		case 0x2C: // image descriptor, local color table, LZW code size, sub-blocks
+			start := i
+			if i+10 > len(data) {
+				return nil, fmt.Errorf("truncated image descriptor")
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (int(flags&0x07) + 1)
+			}
+			i++ // LZW minimum code size
+			if i > len(data) {
+				return nil, fmt.Errorf("truncated image data")
+			}
+			end, err := gifSubBlocksEnd(data, i)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data[start:end])
+			i = end
+
+		default:
+			return nil, fmt.Errorf("unknown block 0x%02x", data[i])
+		}
+	}
+}
+
+// Comments and unknown applications go, graphic control and plain text extensions stay
+func keepGIFExtension(label byte, blocks []byte) bool {
+	switch label {
+	case 0xFE: // comment
+		return false
+	case 0xFF: // application, first sub-block is the 11 byte identifier
+		return len(blocks) >= 12 && blocks[0] == 11 && gifKeepApplications[string(blocks[1:12])]
+	}
+	return true
+}
+
+// Returns the offset right after the zero-length block terminator
+func gifSubBlocksEnd(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, fmt.Errorf("truncated sub-blocks")
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+}
@@ -0,0 +1,224 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Every secret planted by the fixtures below, none of them may survive stripping
+var metadataSecrets = []string{"GPS-48.8584N-2.2945E", "SECRET-XMP", "SECRET-COMMENT", "SECRET-TRAILER", "SECRET-TEXT"}
+
+// jpegWithMetadata looks like a phone photo: EXIF with GPS and orientation, XMP, a comment and trailing data
+func jpegWithMetadata(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	plain := testImage(t, "jpeg", 8, 6)
+
+	// Little endian EXIF: IFD0 holds orientation and a GPS IFD pointer
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00")
+	exif = binary.LittleEndian.AppendUint16(exif, 2)
+	exif = append(exif, 0x12, 0x01, 3, 0, 1, 0, 0, 0)
+	exif = binary.LittleEndian.AppendUint16(exif, orientation)
+	exif = append(exif, 0, 0)
+	exif = append(exif, 0x25, 0x88, 4, 0, 1, 0, 0, 0, 38, 0, 0, 0)
+	exif = append(exif, 0, 0, 0, 0)
+	exif = append(exif, []byte("GPS-48.8584N-2.2945E")...)
+
+	var buf bytes.Buffer
+	buf.Write(plain[:2])
+	buf.Write(jpegSegment(0xE1, exif))
+	buf.Write(jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>SECRET-XMP</x:xmpmeta>")))
+	buf.Write(jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01fake-profile")))
+	buf.Write(jpegSegment(0xFE, []byte("SECRET-COMMENT")))
+	buf.Write(plain[2:])
+	buf.WriteString("SECRET-TRAILER")
+	return buf.Bytes()
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// pngWithMetadata has text chunks, EXIF, a timestamp and trailing data
+func pngWithMetadata(t *testing.T) []byte {
+	t.Helper()
+	plain := testImage(t, "png", 8, 6)
+	ihdrEnd := len(pngSignature) + 12 + 13
+
+	var buf bytes.Buffer
+	buf.Write(plain[:ihdrEnd])
+	buf.Write(pngChunk("tEXt", []byte("Comment\x00SECRET-TEXT")))
+	buf.Write(pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00SECRET-XMP")))
+	buf.Write(pngChunk("eXIf", []byte("MM\x00*GPS-48.8584N-2.2945E")))
+	buf.Write(pngChunk("tIME", []byte{0x07, 0xEA, 10, 18, 12, 0, 0}))
+	buf.Write(pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}))
+	buf.Write(plain[ihdrEnd:])
+	buf.WriteString("SECRET-TRAILER")
+	return buf.Bytes()
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// gifWithMetadata has a comment and an XMP application extension before the image
+func gifWithMetadata(t *testing.T) []byte {
+	t.Helper()
+	plain := testImage(t, "gif", 8, 6)
+
+	headerEnd := 13
+	if flags := plain[10]; flags&0x80 != 0 {
+		headerEnd += 3 << (int(flags&0x07) + 1)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(plain[:headerEnd])
+	buf.Write([]byte{0x21, 0xFE, byte(len("SECRET-COMMENT"))})
+	buf.WriteString("SECRET-COMMENT")
+	buf.WriteByte(0)
+	buf.Write([]byte{0x21, 0xFF, 11})
+	buf.WriteString("XMP DataXMP")
+	buf.WriteByte(byte(len("SECRET-XMP")))
+	buf.WriteString("SECRET-XMP")
+	buf.WriteByte(0)
+	buf.Write([]byte{0x21, 0xFF, 11})
+	buf.WriteString("NETSCAPE2.0")
+	buf.Write([]byte{3, 1, 0, 0, 0})
+	buf.Write(plain[headerEnd:])
+	return buf.Bytes()
+}
+
+func assertNoSecrets(t *testing.T, data []byte) {
+	t.Helper()
+	for _, secret := range metadataSecrets {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("metadata %q survived stripping", secret)
+		}
+	}
+}
+
+func assertDecodes(t *testing.T, data []byte, width, height int) {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("stripped image does not decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Errorf("expected %dx%d, got %dx%d", width, height, b.Dx(), b.Dy())
+	}
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	stripped, err := stripMetadata(jpegWithMetadata(t, 6), "image/jpeg")
+	if err != nil {
+		t.Fatalf("stripMetadata failed: %v", err)
+	}
+
+	assertNoSecrets(t, stripped)
+	assertDecodes(t, stripped, 8, 6)
+
+	// Orientation is rebuilt as the only EXIF tag, the ICC profile stays for colors
+	idx := bytes.Index(stripped, []byte("Exif\x00\x00"))
+	if idx < 0 {
+		t.Fatal("expected an EXIF segment with the orientation")
+	}
+	if orientation := exifOrientation(stripped[idx:]); orientation != 6 {
+		t.Errorf("expected orientation 6 to be kept, got %d", orientation)
+	}
+	if !bytes.Contains(stripped, []byte("ICC_PROFILE")) {
+		t.Error("expected ICC profile to be kept")
+	}
+	if !bytes.HasSuffix(stripped, []byte{0xFF, 0xD9}) {
+		t.Error("expected data after EOI to be dropped")
+	}
+}
+
+func TestStripMetadata_JPEGWithoutOrientation(t *testing.T) {
+	stripped, err := stripMetadata(jpegWithMetadata(t, 1), "image/jpeg")
+	if err != nil {
+		t.Fatalf("stripMetadata failed: %v", err)
+	}
+	// Default orientation needs no EXIF at all
+	if bytes.Contains(stripped, []byte("Exif")) {
+		t.Error("expected no EXIF segment for default orientation")
+	}
+	assertDecodes(t, stripped, 8, 6)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	stripped, err := stripMetadata(pngWithMetadata(t), "image/png")
+	if err != nil {
+		t.Fatalf("stripMetadata failed: %v", err)
+	}
+
+	assertNoSecrets(t, stripped)
+	assertDecodes(t, stripped, 8, 6)
+	for _, chunk := range []string{"tEXt", "iTXt", "eXIf", "tIME"} {
+		if bytes.Contains(stripped, []byte(chunk)) {
+			t.Errorf("expected %s chunk to be dropped", chunk)
+		}
+	}
+	if !bytes.Contains(stripped, []byte("gAMA")) {
+		t.Error("expected gAMA chunk to be kept")
+	}
+}
+
+func TestStripMetadata_GIF(t *testing.T) {
+	stripped, err := stripMetadata(gifWithMetadata(t), "image/gif")
+	if err != nil {
+		t.Fatalf("stripMetadata failed: %v", err)
+	}
+
+	assertNoSecrets(t, stripped)
+	assertDecodes(t, stripped, 8, 6)
+	if !bytes.Contains(stripped, []byte("NETSCAPE2.0")) {
+		t.Error("expected looping extension to be kept")
+	}
+}
+
+func TestStripMetadata_Truncated(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"image/jpeg", jpegWithMetadata(t, 6)[:40]},
+		{"image/png", testImage(t, "png", 8, 6)[:30]},
+		{"image/gif", testImage(t, "gif", 8, 6)[:20]},
+	} {
+		if _, err := stripMetadata(tc.data, tc.contentType); !errors.Is(err, model.ErrInvalidImage) {
+			t.Errorf("%s: expected ErrInvalidImage, got %v", tc.contentType, err)
+		}
+	}
+}
+
+func TestStoreImage_StripsMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	uploader := NewLocalUploader(tmpDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	image, err := uploader.StoreImage("holiday.jpg", bytes.NewReader(jpegWithMetadata(t, 6)), nil)
+	if err != nil {
+		t.Fatalf("StoreImage failed: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(tmpDir, filepath.FromSlash(image.StorageKey)))
+	if err != nil {
+		t.Fatalf("reading stored image: %v", err)
+	}
+	assertNoSecrets(t, stored)
+	if image.Size != int64(len(stored)) {
+		t.Errorf("expected size of the stripped file, got %d for %d bytes", image.Size, len(stored))
+	}
+}
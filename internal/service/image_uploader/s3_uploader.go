@@ -0,0 +1,365 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/logger"
+	"1337b04rd/pkg/sigv4"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Config holds connection settings for an S3-compatible storage
+type S3Config struct {
+	Endpoint  string // e.g. http://minio:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Uploader stores images in a bucket of an S3-compatible storage
+// so every app replica sees the same files
+type S3Uploader struct {
+	Endpoint string
+	Bucket   string
+	Client   *http.Client
+	Logger   *slog.Logger
+	creds    sigv4.Credentials
+}
+
+func NewS3Uploader(cfg S3Config, logger *slog.Logger) *S3Uploader {
+	return &S3Uploader{
+		Endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		Bucket:   cfg.Bucket,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		Logger:   logger,
+		creds: sigv4.Credentials{
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			Region:    cfg.Region,
+			Service:   "s3",
+		},
+	}
+}
+
+// S3Object is a single object fetched from the bucket
+type S3Object struct {
+	Data         []byte
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// CreateBucket creates the configured bucket
+// Returns model.ErrBucketAlreadyExists if it is already there
+func (u *S3Uploader) CreateBucket(ctx context.Context) error {
+	resp, err := u.do(ctx, http.MethodPut, "", nil, "")
+	if err != nil {
+		return logger.ErrorWrapper("image_uploader", "CreateBucket", "sending request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return model.ErrBucketAlreadyExists
+	}
+	if resp.StatusCode != http.StatusOK {
+		return logger.ErrorWrapper("image_uploader", "CreateBucket", "unexpected response", responseError(resp))
+	}
+
+	u.Logger.Info("bucket created", slog.String("bucket", u.Bucket))
+	return nil
+}
+
+// PutObject uploads data under the given key
+func (u *S3Uploader) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := u.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return logger.ErrorWrapper("image_uploader", "PutObject", "sending request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return logger.ErrorWrapper("image_uploader", "PutObject", "unexpected response", responseError(resp))
+	}
+	return nil
+}
+
+// GetObject downloads the object stored under key
+// Returns model.ErrNotFound if there is no such object
+func (u *S3Uploader) GetObject(ctx context.Context, key string) (*S3Object, error) {
+	resp, err := u.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "GetObject", "sending request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, model.ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, logger.ErrorWrapper("image_uploader", "GetObject", "unexpected response", responseError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "GetObject", "reading body", err)
+	}
+
+	obj := &S3Object{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = lm
+	}
+	return obj, nil
+}
+
+// ObjectExists checks for the object with a HEAD request
+func (u *S3Uploader) ObjectExists(ctx context.Context, key string) (bool, error) {
+	resp, err := u.do(ctx, http.MethodHead, key, nil, "")
+	if err != nil {
+		return false, logger.ErrorWrapper("image_uploader", "ObjectExists", "sending request", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, logger.ErrorWrapper("image_uploader", "ObjectExists", "unexpected response", responseError(resp))
+	}
+}
+
+// DeleteObject removes the object, deleting a missing key is not an error
+func (u *S3Uploader) DeleteObject(ctx context.Context, key string) error {
+	resp, err := u.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return logger.ErrorWrapper("image_uploader", "DeleteObject", "sending request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return logger.ErrorWrapper("image_uploader", "DeleteObject", "unexpected response", responseError(resp))
+	}
+	return nil
+}
+
+// StoreImage saves the image under <hash prefix>/<sha256>.<ext>
+// Identical content is uploaded only once
+func (u *S3Uploader) StoreImage(filename string, r io.Reader, accepts func(mimeType string) bool) (*model.Image, error) {
+	data, info, err := validateImage(filename, r)
+	if err != nil {
+		u.Logger.Warn("invalid image upload", slog.String("filename", filename), slog.Any("error", err))
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "image validation", err)
+	}
+	if err := checkAccepted(filename, info, accepts); err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "board rules", err)
+	}
+
+	// Before hashing, see stripMetadata
+	if data, err = stripMetadata(data, info.ContentType); err != nil {
+		u.Logger.Warn("failed to strip image metadata", slog.String("filename", filename), slog.Any("error", err))
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "stripping metadata", err)
+	}
+
+	image := newImage(data, info)
+	if image.Created, err = u.saveObject(image.StorageKey, data, image.MimeType); err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "saving image failed", err)
+	}
+
+	u.Logger.Info("image stored successfully", slog.String("key", image.StorageKey))
+	return image, nil
+}
+
+// StoreThumbnail saves the thumbnail next to the original image
+func (u *S3Uploader) StoreThumbnail(hash string, data []byte, ext string) (string, error) {
+	if err := validateThumbnail(hash, ext); err != nil {
+		return "", logger.ErrorWrapper("image_uploader", "StoreThumbnail", "thumbnail check", err)
+	}
+
+	key := thumbnailKey(hash, ext)
+	if _, err := u.saveObject(key, data, contentTypeOf(key, data)); err != nil {
+		return "", logger.ErrorWrapper("image_uploader", "StoreThumbnail", "saving thumbnail failed", err)
+	}
+	return key, nil
+}
+
+// Keys are content hashes, an existing object already has the same bytes
+// It is still uploaded again, S3 has no cheap way to refresh LastModified
+// and a stale orphan could be collected right after a new post reused it
+// Reports whether the object did not exist before this call
+func (u *S3Uploader) saveObject(key string, data []byte, contentType string) (bool, error) {
+	ctx := context.Background()
+
+	exists, err := u.ObjectExists(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		u.Logger.Info("object already stored, refreshing it", slog.String("key", key))
+	}
+
+	if err := u.PutObject(ctx, key, data, contentType); err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
+
+// Read stored image by its key, the bucket stays private and images go through /media/
+func (u *S3Uploader) OpenImage(key string) (*model.ImageObject, error) {
+	if err := validateKey(key); err != nil {
+		u.Logger.Warn("rejected unsafe image key", slog.String("key", key))
+		return nil, logger.ErrorWrapper("image_uploader", "OpenImage", "key check", err)
+	}
+
+	obj, err := u.GetObject(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &model.ImageObject{
+		Key:         key,
+		Data:        obj.Data,
+		ContentType: obj.ContentType,
+		ETag:        obj.ETag,
+		ModTime:     obj.LastModified,
+	}
+	if image.ContentType == "" {
+		image.ContentType = contentTypeOf(key, obj.Data)
+	}
+	if image.ETag == "" {
+		image.ETag = etagOf(obj.Data)
+	}
+	return image, nil
+}
+
+// ListObjects pages through ListObjectsV2 and returns every object in the bucket
+func (u *S3Uploader) ListObjects(ctx context.Context) ([]model.ObjectInfo, error) {
+	var objects []model.ObjectInfo
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := u.newRequest(ctx, http.MethodGet, u.objectURL("")+"?"+query.Encode(), nil, "")
+		if err != nil {
+			return nil, logger.ErrorWrapper("image_uploader", "ListObjects", "building request", err)
+		}
+		resp, err := u.Client.Do(req)
+		if err != nil {
+			return nil, logger.ErrorWrapper("image_uploader", "ListObjects", "sending request", err)
+		}
+
+		page, err := decodeListPage(resp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, logger.ErrorWrapper("image_uploader", "ListObjects", "reading page", err)
+		}
+
+		for _, c := range page.Contents {
+			objects = append(objects, model.ObjectInfo{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+type listPage struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func decodeListPage(resp *http.Response) (*listPage, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var page listPage
+	if err := xml.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decoding list response: %w", err)
+	}
+	return &page, nil
+}
+
+// ListImages returns every object in the bucket
+func (u *S3Uploader) ListImages() ([]model.ObjectInfo, error) {
+	return u.ListObjects(context.Background())
+}
+
+func (u *S3Uploader) HasImage(key string) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, logger.ErrorWrapper("image_uploader", "HasImage", "key check", err)
+	}
+	return u.ObjectExists(context.Background(), key)
+}
+
+// DeleteImage removes the object from the bucket
+func (u *S3Uploader) DeleteImage(key string) error {
+	if err := validateKey(key); err != nil {
+		return logger.ErrorWrapper("image_uploader", "DeleteImage", "key check", err)
+	}
+	return u.DeleteObject(context.Background(), key)
+}
+
+// Path-style URL: <endpoint>/<bucket>/<key>
+func (u *S3Uploader) objectURL(key string) string {
+	escaped := (&url.URL{Path: path.Join("/", u.Bucket, key)}).EscapedPath()
+	return u.Endpoint + escaped
+}
+
+func (u *S3Uploader) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := u.newRequest(ctx, method, u.objectURL(key), body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return u.Client.Do(req)
+}
+
+// Builds a signed request, rawURL may carry a query string
+func (u *S3Uploader) newRequest(ctx context.Context, method, rawURL string, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = int64(len(body))
+
+	sigv4.Sign(req, sigv4.HashPayload(body), u.creds, time.Now())
+	return req, nil
+}
+
+// Extracts <Code> from the XML error body returned by the storage
+func responseError(resp *http.Response) error {
+	var body struct {
+		Code string `xml:"Code"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err := xml.Unmarshal(raw, &body); err != nil || body.Code == "" {
+		return fmt.Errorf("storage responded with status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("storage responded with status %d: %s", resp.StatusCode, body.Code)
+}
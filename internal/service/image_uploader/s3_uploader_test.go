@@ -0,0 +1,163 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/service/image_uploader/s3stub"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func newTestS3Uploader(t *testing.T) (*S3Uploader, *s3stub.Server) {
+	t.Helper()
+	srv := s3stub.NewServer()
+	t.Cleanup(srv.Close)
+
+	uploader := NewS3Uploader(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "images",
+		Region:    s3stub.Region,
+		AccessKey: s3stub.AccessKey,
+		SecretKey: s3stub.SecretKey,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := uploader.CreateBucket(context.Background()); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	return uploader, srv
+}
+
+func TestS3CreateBucket_AlreadyExists(t *testing.T) {
+	uploader, _ := newTestS3Uploader(t)
+
+	err := uploader.CreateBucket(context.Background())
+	if !errors.Is(err, model.ErrBucketAlreadyExists) {
+		t.Errorf("expected ErrBucketAlreadyExists, got %v", err)
+	}
+}
+
+func TestS3StoreImage_Valid(t *testing.T) {
+	uploader, srv := newTestS3Uploader(t)
+
+	content := testImage(t, "png", 4, 4)
+	image, err := uploader.StoreImage("image.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("StoreImage failed: %v", err)
+	}
+
+	data, ok := srv.Object("images", image.StorageKey)
+	if !ok {
+		t.Fatal("expected object to be stored in bucket")
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("unexpected object content: %q", data)
+	}
+	if image.MimeType != "image/png" {
+		t.Errorf("unexpected mime type: %s", image.MimeType)
+	}
+}
+
+func TestS3StoreImage_Duplicate(t *testing.T) {
+	uploader, _ := newTestS3Uploader(t)
+
+	content := testImage(t, "png", 4, 4)
+	first, err := uploader.StoreImage("cat.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("first upload failed: %v", err)
+	}
+	second, err := uploader.StoreImage("cat.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("second upload of the same content failed: %v", err)
+	}
+	if !first.Created || second.Created {
+		t.Errorf("expected only the first upload to create the object: %v %v", first.Created, second.Created)
+	}
+	if first.StorageKey != second.StorageKey {
+		t.Errorf("expected the same key, got %s and %s", first.StorageKey, second.StorageKey)
+	}
+}
+
+func TestS3GetAndDeleteObject(t *testing.T) {
+	uploader, _ := newTestS3Uploader(t)
+	ctx := context.Background()
+
+	if err := uploader.PutObject(ctx, "a/b.png", []byte("content"), "image/png"); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	obj, err := uploader.GetObject(ctx, "a/b.png")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	if string(obj.Data) != "content" || obj.ContentType != "image/png" {
+		t.Errorf("unexpected object: %+v", obj)
+	}
+
+	image, err := uploader.OpenImage("a/b.png")
+	if err != nil {
+		t.Fatalf("OpenImage failed: %v", err)
+	}
+	if string(image.Data) != "content" || image.ETag == "" {
+		t.Errorf("unexpected image: %+v", image)
+	}
+
+	if err := uploader.DeleteObject(ctx, "a/b.png"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if _, err := uploader.GetObject(ctx, "a/b.png"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestS3ListAndDeleteImages(t *testing.T) {
+	uploader, srv := newTestS3Uploader(t)
+	srv.PageSize = 1 // force several ListObjectsV2 pages
+	ctx := context.Background()
+
+	for _, key := range []string{"aa/one.png", "bb/two.png", "cc/three.png"} {
+		if err := uploader.PutObject(ctx, key, []byte(key), "image/png"); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+
+	objects, err := uploader.ListImages()
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("expected 3 objects across pages, got %d", len(objects))
+	}
+	if objects[0].Key != "aa/one.png" || objects[0].Size != int64(len("aa/one.png")) || objects[0].ModTime.IsZero() {
+		t.Errorf("unexpected object info: %+v", objects[0])
+	}
+
+	if err := uploader.DeleteImage("bb/two.png"); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	if _, ok := srv.Object("images", "bb/two.png"); ok {
+		t.Error("expected object to be deleted")
+	}
+	if err := uploader.DeleteImage("../escape"); !errors.Is(err, model.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestS3_BadCredentials(t *testing.T) {
+	srv := s3stub.NewServer()
+	defer srv.Close()
+
+	uploader := NewS3Uploader(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "images",
+		Region:    s3stub.Region,
+		AccessKey: s3stub.AccessKey,
+		SecretKey: "wrong",
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := uploader.CreateBucket(context.Background()); err == nil {
+		t.Error("expected request with wrong secret to be rejected")
+	}
+}
@@ -0,0 +1,209 @@
+// In-process stand-in for an S3-compatible storage, used by tests
+// Keeps buckets in memory and verifies request signatures like the real thing
+package s3stub
+
+import (
+	"1337b04rd/pkg/sigv4"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessKey = "stub-access-key"
+	SecretKey = "stub-secret-key"
+	Region    = "us-east-1"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+type Server struct {
+	*httptest.Server
+
+	// PageSize limits keys per ListObjectsV2 response, tests lower it to exercise paging
+	PageSize int
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	creds   sigv4.Credentials
+}
+
+// NewServer starts the stand-in server, caller must Close it
+func NewServer() *Server {
+	s := &Server{
+		PageSize: 1000,
+		buckets:  make(map[string]map[string]*object),
+		creds:    sigv4.Credentials{AccessKey: AccessKey, SecretKey: SecretKey, Region: Region, Service: "s3"},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Object returns stored object content, used by tests for assertions
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return obj.data, true
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := sigv4.Verify(r, s.creds); err != nil {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" {
+		s.handleBucket(w, r, bucket)
+		return
+	}
+	s.handleObject(w, r, bucket, key)
+}
+
+func (s *Server) handleBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	_, exists := s.buckets[bucket]
+
+	switch r.Method {
+	case http.MethodPut:
+		if exists {
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+			return
+		}
+		s.buckets[bucket] = make(map[string]*object)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchBucket")
+			return
+		}
+		if r.URL.Query().Get("list-type") != "2" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented")
+			return
+		}
+		s.listObjects(w, s.buckets[bucket], r.URL.Query().Get("continuation-token"))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *Server) handleObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	objects, exists := s.buckets[bucket]
+	if !exists {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if r.Header.Get(sigv4.HeaderPayload) != sigv4.HashPayload(data) {
+			writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+			return
+		}
+		objects[key] = &object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", `"`+sigv4.HashPayload(data)[:32]+`"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"`+sigv4.HashPayload(obj.data)[:32]+`"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// Keys are returned in lexical order, the continuation token is the last key of the previous page
+func (s *Server) listObjects(w http.ResponseWriter, objects map[string]*object, after string) {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := listResult{}
+	if len(keys) > s.PageSize {
+		keys = keys[:s.PageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		obj := objects[key]
+		result.Contents = append(result.Contents, listEntry{
+			Key:          key,
+			Size:         int64(len(obj.data)),
+			LastModified: obj.modTime.Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(result)
+}
+
+type listResult struct {
+	XMLName               xml.Name    `xml:"ListBucketResult"`
+	Contents              []listEntry `xml:"Contents"`
+	IsTruncated           bool        `xml:"IsTruncated"`
+	NextContinuationToken string      `xml:"NextContinuationToken,omitempty"`
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>`+code+`</Code></Error>`)
+}
@@ -1,6 +1,7 @@
 package imageuploader
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -8,40 +9,51 @@ import (
 	"path/filepath"
 )
 
-// This function is shared by UploadPostImage and UploadCommentImage
-func SaveImageFile(fullPath string, r io.Reader, logger *slog.Logger) (string, error) {
+var ErrFileExists = errors.New("file already exists")
+
+// This function is shared by StoreImage and StoreThumbnail
+// Data goes to a temp file first, so a crash never leaves a half-written object under its final name
+func SaveImageFile(fullPath string, r io.Reader, logger *slog.Logger) error {
 
 	// Check if parent directory exists
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
 		logger.Error("failed to create directory", slog.String("path", filepath.Dir(fullPath)), slog.Any("error", err))
-		return "", fmt.Errorf("could not create parent directory: %w", err)
+		return fmt.Errorf("could not create parent directory: %w", err)
 	}
 
 	// Check for filename collision
 	if _, err := os.Stat(fullPath); err == nil {
-		logger.Warn("file already exists", slog.String("imagePath", fullPath))
-		return "", fmt.Errorf("file already exists")
+		logger.Debug("file already exists", slog.String("imagePath", fullPath))
+		return ErrFileExists
 	}
 
-	// Create file
-	dst, err := os.Create(fullPath)
+	// Create temp file next to the target
+	dst, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
 	if err != nil {
 		logger.Error("failed to create file",
 			slog.String("imagePath", fullPath),
 			slog.Any("error", err))
-		return "", fmt.Errorf("could not create file: %w", err)
+		return fmt.Errorf("could not create file: %w", err)
 	}
-	defer dst.Close()
+	defer os.Remove(dst.Name()) // no-op after successful rename
 
 	// Copy content
 	if _, err := io.Copy(dst, r); err != nil {
+		dst.Close()
 		logger.Error("failed to copy image data",
 			slog.String("imagePath", fullPath),
 			slog.Any("error", err))
-		return "", fmt.Errorf("copy failed: %w", err)
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
 	}
 
-	// Public URL format
-	imageURL := fmt.Sprintf("/%s", fullPath)
-	return imageURL, nil
+	if err := os.Chmod(dst.Name(), 0o644); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if err := os.Rename(dst.Name(), fullPath); err != nil {
+		return fmt.Errorf("moving file into place: %w", err)
+	}
+	return nil
 }
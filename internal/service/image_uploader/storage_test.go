@@ -17,18 +17,13 @@ func TestSaveImageFile_CreatesFile(t *testing.T) {
 	reader := bytes.NewReader(content)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	url, err := SaveImageFile(targetPath, reader, logger)
-	if err != nil {
+	if err := SaveImageFile(targetPath, reader, logger); err != nil {
 		t.Fatalf("SaveImageFile failed: %v", err)
 	}
 
 	if _, err := os.Stat(targetPath); err != nil {
 		t.Errorf("expected file to exist: %v", err)
 	}
-
-	if url != "/"+targetPath {
-		t.Errorf("expected URL /%s, got %s", targetPath, url)
-	}
 }
 
 func TestSaveImageFile_FileExists(t *testing.T) {
@@ -38,7 +33,7 @@ func TestSaveImageFile_FileExists(t *testing.T) {
 	os.WriteFile(path, []byte("existing"), 0644)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	_, err := SaveImageFile(path, bytes.NewReader([]byte("new")), logger)
+	err := SaveImageFile(path, bytes.NewReader([]byte("new")), logger)
 	if err == nil {
 		t.Error("expected error for existing file, got nil")
 	}
@@ -0,0 +1,159 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+const thumbnailJPEGQuality = 85
+
+// Thumbnailer produces downscaled copies of uploaded images with the standard image packages
+// JPEG sources become JPEG thumbnails, PNG and GIF become PNG to keep transparency
+type Thumbnailer struct {
+	MaxWidth  int
+	MaxHeight int
+}
+
+func NewThumbnailer(maxWidth, maxHeight int) *Thumbnailer {
+	return &Thumbnailer{MaxWidth: maxWidth, MaxHeight: maxHeight}
+}
+
+func (t *Thumbnailer) Thumbnail(data []byte) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image: %w", model.ErrInvalidImage)
+	}
+
+	// Phone photos are stored sideways with an EXIF note on how to turn them.
+	// Turning after scaling gives the same thumbnail on far fewer pixels, as long
+	// as quarter turns fit the source into the swapped box
+	orientation := 0
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	maxWidth, maxHeight := t.MaxWidth, t.MaxHeight
+	if orientation >= 5 {
+		maxWidth, maxHeight = maxHeight, maxWidth
+	}
+	thumb := orient(scaleDown(src, maxWidth, maxHeight), orientation)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, "", fmt.Errorf("encoding jpeg thumbnail: %w", err)
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, "", fmt.Errorf("encoding png thumbnail: %w", err)
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+// scaleDown fits the image into maxWidth x maxHeight keeping the aspect ratio
+// Each target pixel is the average of the source pixels it covers (box filter)
+// Source rows are converted one at a time by image/draw, which has fast paths for
+// the decoders' concrete types, so no pixel goes through the color interfaces
+func scaleDown(src image.Image, maxWidth, maxHeight int) *image.NRGBA {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	// Never upscale
+	dstW, dstH := srcW, srcH
+	if srcW > maxWidth || srcH > maxHeight {
+		dstW, dstH = maxWidth, srcH*maxWidth/srcW
+		if dstH > maxHeight {
+			dstW, dstH = srcW*maxHeight/srcH, maxHeight
+		}
+		dstW, dstH = max(dstW, 1), max(dstH, 1)
+	}
+
+	// Source columns covered by each target column
+	x0s, x1s := make([]int, dstW), make([]int, dstW)
+	for x := range dstW {
+		x0s[x] = x * srcW / dstW
+		x1s[x] = max((x+1)*srcW/dstW, x0s[x]+1)
+	}
+
+	row := image.NewRGBA(image.Rect(0, 0, srcW, 1)) // alpha-premultiplied
+	sums := make([]uint64, dstW*4)
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := range dstH {
+		y0 := y * srcH / dstH
+		y1 := max((y+1)*srcH/dstH, y0+1)
+
+		clear(sums)
+		for sy := y0; sy < y1; sy++ {
+			draw.Draw(row, row.Rect, src, image.Pt(b.Min.X, b.Min.Y+sy), draw.Src)
+			for x := range dstW {
+				s := sums[x*4 : x*4+4]
+				for i := x0s[x] * 4; i < x1s[x]*4; i += 4 {
+					s[0] += uint64(row.Pix[i])
+					s[1] += uint64(row.Pix[i+1])
+					s[2] += uint64(row.Pix[i+2])
+					s[3] += uint64(row.Pix[i+3])
+				}
+			}
+		}
+
+		for x := range dstW {
+			s := sums[x*4 : x*4+4]
+			if s[3] == 0 {
+				continue
+			}
+			// Back from premultiplied sums to NRGBA
+			n := uint64((x1s[x] - x0s[x]) * (y1 - y0))
+			off := dst.PixOffset(x, y)
+			dst.Pix[off+0] = uint8(s[0] * 0xff / s[3])
+			dst.Pix[off+1] = uint8(s[1] * 0xff / s[3])
+			dst.Pix[off+2] = uint8(s[2] * 0xff / s[3])
+			dst.Pix[off+3] = uint8(s[3] / n)
+		}
+	}
+	return dst
+}
+
+// orient turns the image upright according to an EXIF orientation (1 to 8)
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // mirrored, turned left
+				dx, dy = y, x
+			case 6: // turned left, needs a right turn
+				dx, dy = h-1-y, x
+			case 7: // mirrored, turned right
+				dx, dy = h-1-y, w-1-x
+			case 8: // turned right, needs a left turn
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,105 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnail_ScalesDownKeepingAspect(t *testing.T) {
+	thumbnailer := NewThumbnailer(100, 100)
+
+	cases := []struct {
+		format  string
+		w, h    int
+		wantExt string
+		wantW   int
+		wantH   int
+	}{
+		{"jpeg", 400, 200, ".jpg", 100, 50},
+		{"png", 120, 300, ".png", 40, 100},
+		{"gif", 50, 30, ".png", 50, 30}, // smaller than bounds, not upscaled
+	}
+
+	for _, tc := range cases {
+		thumb, ext, err := thumbnailer.Thumbnail(testImage(t, tc.format, tc.w, tc.h))
+		if err != nil {
+			t.Fatalf("%s: Thumbnail failed: %v", tc.format, err)
+		}
+		if ext != tc.wantExt {
+			t.Errorf("%s: expected %s thumbnail, got %s", tc.format, tc.wantExt, ext)
+		}
+
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatalf("%s: thumbnail does not decode: %v", tc.format, err)
+		}
+		if cfg.Width != tc.wantW || cfg.Height != tc.wantH {
+			t.Errorf("%s: expected %dx%d, got %dx%d", tc.format, tc.wantW, tc.wantH, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestThumbnail_InvalidImage(t *testing.T) {
+	_, _, err := NewThumbnailer(100, 100).Thumbnail([]byte("not an image"))
+	if !errors.Is(err, model.ErrInvalidImage) {
+		t.Errorf("expected ErrInvalidImage, got %v", err)
+	}
+}
+
+func TestThumbnail_ExifOrientation(t *testing.T) {
+	// 40x20 stored, orientation 6 means it is shown turned right, 20x40
+	data := testImage(t, "jpeg", 40, 20)
+	data = append(append(append([]byte{}, data[:2]...), orientationSegment(6)...), data[2:]...)
+
+	thumb, _, err := NewThumbnailer(100, 10).Thumbnail(data)
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("thumbnail does not decode: %v", err)
+	}
+	if cfg.Width != 5 || cfg.Height != 10 {
+		t.Errorf("expected an upright 5x10 thumbnail, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestScaleDown_AveragesPixels(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x / 2 * 200), G: 100, B: 50, A: 255})
+		}
+	}
+
+	dst := scaleDown(src, 2, 2)
+	if dst.Rect.Dx() != 2 || dst.Rect.Dy() != 1 {
+		t.Fatalf("expected 2x1, got %v", dst.Rect)
+	}
+	if got := dst.NRGBAAt(0, 0); got != (color.NRGBA{R: 0, G: 100, B: 50, A: 255}) {
+		t.Errorf("left half: got %v", got)
+	}
+	if got := dst.NRGBAAt(1, 0); got != (color.NRGBA{R: 200, G: 100, B: 50, A: 255}) {
+		t.Errorf("right half: got %v", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+
+	// Turned right: the left pixel ends up on top
+	dst := orient(src, 6)
+	if dst.Rect.Dx() != 1 || dst.Rect.Dy() != 2 || dst.NRGBAAt(0, 0).R != 255 {
+		t.Errorf("orientation 6: got %v with top %v", dst.Rect, dst.NRGBAAt(0, 0))
+	}
+	// Turned left: the left pixel ends up at the bottom
+	dst = orient(src, 8)
+	if dst.NRGBAAt(0, 1).R != 255 {
+		t.Errorf("orientation 8: expected the marked pixel at the bottom, got %v", dst.NRGBAAt(0, 1))
+	}
+}
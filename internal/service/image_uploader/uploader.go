@@ -1,24 +1,20 @@
 package imageuploader
 
 import (
+	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/logger"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-var allowedExtensions = map[string]bool{
-	".jpg":  true,
-	".jpeg": true,
-	".png":  true,
-	".gif":  true,
-	".webp": true,
-	".bmp":  true,
-	".svg":  true,
-}
-
 type LocalUploader struct {
 	RootDir string
 	Logger  *slog.Logger
@@ -28,59 +24,162 @@ func NewLocalUploader(RootDir string, logger *slog.Logger) *LocalUploader {
 	return &LocalUploader{RootDir: RootDir, Logger: logger}
 }
 
-// Shared function between UploadPostImage and UploadCommentImage
-// Validating image extension
-func validateExtension(filename string) error {
-	// Avoid empty filenames and traversal
-	if filename == "" || strings.Contains(filename, "..") || strings.HasPrefix(filename, ".") {
-		return fmt.Errorf("invalid or unsafe filename: %s", filename)
+// StoreImage saves the image as <RootDir>/<hash prefix>/<sha256>.<ext>
+// Identical content is written only once
+func (u *LocalUploader) StoreImage(filename string, r io.Reader, accepts func(mimeType string) bool) (*model.Image, error) {
+
+	// Validate file extension and real content
+	data, info, err := validateImage(filename, r)
+	if err != nil {
+		u.Logger.Warn("invalid image upload", slog.String("filename", filename), slog.Any("error", err))
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "image validation", err)
+	}
+	if err := checkAccepted(filename, info, accepts); err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "board rules", err)
+	}
+
+	// Before hashing, see stripMetadata
+	if data, err = stripMetadata(data, info.ContentType); err != nil {
+		u.Logger.Warn("failed to strip image metadata", slog.String("filename", filename), slog.Any("error", err))
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "stripping metadata", err)
 	}
 
-	ext := strings.ToLower(filepath.Ext(filename))
-	if !allowedExtensions[ext] {
-		return fmt.Errorf("unsupported image extension: %s", ext)
+	image := newImage(data, info)
+	if image.Created, err = u.save(image.StorageKey, data); err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "StoreImage", "saving image failed", err)
 	}
-	return nil
+
+	u.Logger.Info("image stored successfully", slog.String("key", image.StorageKey))
+	return image, nil
+}
+
+// StoreThumbnail saves the thumbnail next to the original image
+func (u *LocalUploader) StoreThumbnail(hash string, data []byte, ext string) (string, error) {
+	if err := validateThumbnail(hash, ext); err != nil {
+		return "", logger.ErrorWrapper("image_uploader", "StoreThumbnail", "thumbnail check", err)
+	}
+
+	key := thumbnailKey(hash, ext)
+	if _, err := u.save(key, data); err != nil {
+		return "", logger.ErrorWrapper("image_uploader", "StoreThumbnail", "saving thumbnail failed", err)
+	}
+	return key, nil
 }
 
-// Upload image for a post (path: /<postID>/<filename>)
-func (u *LocalUploader) UploadPostImage(postID, filename string, r io.Reader) (string, error) {
+// Existing object under the same key has the same content, so it is not an error
+// Its mtime is refreshed so the garbage collector treats it as a fresh upload
+// Reports whether the file was written by this call
+func (u *LocalUploader) save(key string, data []byte) (bool, error) {
+	fullPath := filepath.Join(u.RootDir, filepath.FromSlash(key))
 
-	// Validate file extension
-	if err := validateExtension(filename); err != nil {
-		u.Logger.Warn("invalid image extension", slog.String("filename", filename))
-		return "", logger.ErrorWrapper("image_uploader", "UploadPostImage", "extension check", err)
+	err := SaveImageFile(fullPath, bytes.NewReader(data), u.Logger)
+	if errors.Is(err, ErrFileExists) {
+		u.Logger.Info("image already stored, reusing it", slog.String("key", key))
+		now := time.Now()
+		if err := os.Chtimes(fullPath, now, now); err != nil {
+			return false, fmt.Errorf("refreshing mtime: %w", err)
+		}
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	bucketPath := filepath.Join(u.RootDir, postID)
-	fullPath := filepath.Join(bucketPath, filename)
+// Read stored image by its key (path relative to RootDir)
+func (u *LocalUploader) OpenImage(key string) (*model.ImageObject, error) {
+	if err := validateKey(key); err != nil {
+		u.Logger.Warn("rejected unsafe image key", slog.String("key", key))
+		return nil, logger.ErrorWrapper("image_uploader", "OpenImage", "key check", err)
+	}
 
-	imageURL, err := SaveImageFile(fullPath, r, u.Logger)
+	// Double check that resolved path did not escape the root
+	fullPath := filepath.Join(u.RootDir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(u.RootDir, fullPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, logger.ErrorWrapper("image_uploader", "OpenImage", "resolving path", model.ErrInvalidInput)
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			return nil, model.ErrNotFound
+		}
+		return nil, logger.ErrorWrapper("image_uploader", "OpenImage", "stat file", err)
+	}
+
+	data, err := os.ReadFile(fullPath)
 	if err != nil {
-		return "", logger.ErrorWrapper("image_uploader", "UploadPostImage", "saving post image failed", err)
+		return nil, logger.ErrorWrapper("image_uploader", "OpenImage", "reading file", err)
 	}
 
-	u.Logger.Info("post image uploaded successfully", slog.String("imageURL", imageURL))
-	return imageURL, nil
+	return &model.ImageObject{
+		Key:         key,
+		Data:        data,
+		ContentType: contentTypeOf(key, data),
+		ETag:        etagOf(data),
+		ModTime:     info.ModTime(),
+	}, nil
 }
 
-// Upload image for a comment (path: /<postID>/comments/<commentID>/<filename>)
-func (u *LocalUploader) UploadCommentImage(postID, commentID, filename string, r io.Reader) (string, error) {
+// ListImages walks RootDir, unfinished temp files are skipped
+func (u *LocalUploader) ListImages() ([]model.ObjectInfo, error) {
+	var objects []model.ObjectInfo
 
-	// Validate file extension
-	if err := validateExtension(filename); err != nil {
-		u.Logger.Warn("invalid image extension", slog.String("filename", filename))
-		return "", logger.ErrorWrapper("image_uploader", "UploadCommentImage", "extension check", err)
+	err := filepath.WalkDir(u.RootDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == u.RootDir {
+				return fs.SkipDir // nothing uploaded yet
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(u.RootDir, p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, model.ObjectInfo{
+			Key:     filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, logger.ErrorWrapper("image_uploader", "ListImages", "walking root dir", err)
 	}
-	// Construct full path: /<RootDir>/<postID>/comments/<commentID>/<filename>
-	commentImagePath := filepath.Join(u.RootDir, postID, "comments", commentID)
-	fullPath := filepath.Join(commentImagePath, filename)
+	return objects, nil
+}
 
-	imageURL, err := SaveImageFile(fullPath, r, u.Logger)
+func (u *LocalUploader) HasImage(key string) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, logger.ErrorWrapper("image_uploader", "HasImage", "key check", err)
+	}
+
+	_, err := os.Stat(filepath.Join(u.RootDir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
 	if err != nil {
-		return "", logger.ErrorWrapper("image_uploader", "UploadCommentImage", "saving comment image failed", err)
+		return false, logger.ErrorWrapper("image_uploader", "HasImage", "stat file", err)
 	}
+	return true, nil
+}
 
-	u.Logger.Info("comment image uploaded successfully", slog.String("imageURL", imageURL))
-	return imageURL, nil
+// DeleteImage removes the file, empty prefix directories are left for later uploads
+func (u *LocalUploader) DeleteImage(key string) error {
+	if err := validateKey(key); err != nil {
+		return logger.ErrorWrapper("image_uploader", "DeleteImage", "key check", err)
+	}
+
+	err := os.Remove(filepath.Join(u.RootDir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return logger.ErrorWrapper("image_uploader", "DeleteImage", "removing file", err)
+	}
+	return nil
 }
@@ -1,69 +1,266 @@
 package imageuploader
 
 import (
+	"1337b04rd/internal/domain/model"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
-func TestUploadPostImage_Valid(t *testing.T) {
+func TestStoreImage_Valid(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	uploader := NewLocalUploader(tmpDir, logger)
 
-	content := []byte("fake image data")
+	content := testImage(t, "png", 4, 3)
 	reader := bytes.NewReader(content)
 
-	url, err := uploader.UploadPostImage("post1", "image.png", reader)
+	image, err := uploader.StoreImage("image.png", reader, nil)
 	if err != nil {
-		t.Fatalf("UploadPostImage failed: %v", err)
+		t.Fatalf("StoreImage failed: %v", err)
 	}
 
-	expectedPath := filepath.Join(tmpDir, "post1", "image.png")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if image.Hash != hash {
+		t.Errorf("expected hash %s, got %s", hash, image.Hash)
+	}
+	if image.StorageKey != hash[:2]+"/"+hash+".png" {
+		t.Errorf("unexpected storage key: %s", image.StorageKey)
+	}
+	if image.MimeType != "image/png" || image.Size != int64(len(content)) || image.Width != 4 || image.Height != 3 {
+		t.Errorf("unexpected image metadata: %+v", image)
+	}
+
+	expectedPath := filepath.Join(tmpDir, hash[:2], hash+".png")
 	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
 		t.Errorf("expected file at %s, but it doesn't exist", expectedPath)
 	}
+}
 
-	if url != "/"+expectedPath {
-		t.Errorf("unexpected image URL: %s", url)
+func TestStoreImage_Deduplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	content := testImage(t, "png", 4, 4)
+
+	first, err := uploader.StoreImage("image.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("first StoreImage failed: %v", err)
+	}
+	// Same name used to fail with "file already exists", same content now maps to the same object
+	second, err := uploader.StoreImage("image.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("second StoreImage failed: %v", err)
+	}
+	third, err := uploader.StoreImage("other-name.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("third StoreImage failed: %v", err)
+	}
+
+	if !first.Created || second.Created || third.Created {
+		t.Errorf("expected only the first upload to create the object: %v %v %v", first.Created, second.Created, third.Created)
+	}
+	if first.StorageKey != second.StorageKey || first.StorageKey != third.StorageKey {
+		t.Errorf("expected identical content to share a key: %s %s %s", first.StorageKey, second.StorageKey, third.StorageKey)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(tmpDir, first.Hash[:2]))
+	if len(entries) != 1 {
+		t.Errorf("expected a single stored file, got %d", len(entries))
 	}
 }
 
-func TestUploadPostImage_InvalidExtension(t *testing.T) {
+func TestStoreImage_InvalidExtension(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	uploader := NewLocalUploader(tmpDir, logger)
 
 	reader := bytes.NewReader([]byte("fake"))
 
-	_, err := uploader.UploadPostImage("post1", "script.exe", reader)
+	_, err := uploader.StoreImage("script.exe", reader, nil)
 	if err == nil {
 		t.Error("expected error for invalid extension, got nil")
 	}
 }
 
-func TestUploadCommentImage_Valid(t *testing.T) {
+func TestStoreImage_RenamedPayload(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	uploader := NewLocalUploader(tmpDir, logger)
 
-	content := []byte("img")
-	reader := bytes.NewReader(content)
+	_, err := uploader.StoreImage("shell.png", bytes.NewReader([]byte("#!/bin/sh\nrm -rf /")), nil)
+	if !errors.Is(err, model.ErrUnsupportedImageType) {
+		t.Errorf("expected ErrUnsupportedImageType, got %v", err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Error("expected rejected upload not to be stored")
+	}
+}
+
+func TestStoreImage_NotAccepted(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	jpegOnly := func(mimeType string) bool { return mimeType == "image/jpeg" }
+	_, err := uploader.StoreImage("cat.png", bytes.NewReader(testImage(t, "png", 4, 4)), jpegOnly)
+	if !errors.Is(err, model.ErrImageTypeNotAllowed) {
+		t.Errorf("expected ErrImageTypeNotAllowed, got %v", err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Error("expected a type the board does not take not to be stored")
+	}
+}
 
-	url, err := uploader.UploadCommentImage("post1", "cmt123", "cat.png", reader)
+func TestStoreThumbnail(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	image, err := uploader.StoreImage("cat.png", bytes.NewReader(testImage(t, "png", 4, 4)), nil)
 	if err != nil {
-		t.Fatalf("UploadCommentImage failed: %v", err)
+		t.Fatalf("StoreImage failed: %v", err)
 	}
 
-	expectedPath := filepath.Join(tmpDir, "post1", "comments", "cmt123", "cat.png")
-	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
-		t.Errorf("expected file at %s, but it doesn't exist", expectedPath)
+	key, err := uploader.StoreThumbnail(image.Hash, testImage(t, "png", 2, 2), ".png")
+	if err != nil {
+		t.Fatalf("StoreThumbnail failed: %v", err)
+	}
+	if key != image.Hash[:2]+"/"+image.Hash+"_thumb.png" {
+		t.Errorf("expected thumbnail next to the original, got %s", key)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(key))); err != nil {
+		t.Errorf("expected thumbnail file: %v", err)
+	}
+
+	if _, err := uploader.StoreThumbnail("../../etc", []byte("x"), ".png"); !errors.Is(err, model.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput for bad hash, got %v", err)
+	}
+}
+
+func TestOpenImage_Valid(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	content := testImage(t, "png", 4, 4)
+	stored, err := uploader.StoreImage("image.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("StoreImage failed: %v", err)
+	}
+
+	image, err := uploader.OpenImage(stored.StorageKey)
+	if err != nil {
+		t.Fatalf("OpenImage failed: %v", err)
+	}
+	if !bytes.Equal(image.Data, content) {
+		t.Errorf("unexpected image content: %q", image.Data)
+	}
+	if image.ContentType != "image/png" {
+		t.Errorf("unexpected content type: %s", image.ContentType)
+	}
+	if image.ETag == "" || image.ModTime.IsZero() {
+		t.Errorf("expected ETag and ModTime to be set: %+v", image)
+	}
+}
+
+func TestOpenImage_RejectsEscapingKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(filepath.Join(tmpDir, "root"), logger)
+
+	os.WriteFile(filepath.Join(tmpDir, "secret.png"), []byte("secret"), 0o644)
+
+	for _, key := range []string{"../secret.png", "post1/../../secret.png", "/etc/passwd", "post1\\..\\secret.png", "", "post1/.hidden"} {
+		_, err := uploader.OpenImage(key)
+		if !errors.Is(err, model.ErrInvalidInput) {
+			t.Errorf("key %q: expected ErrInvalidInput, got %v", key, err)
+		}
+	}
+}
+
+func TestOpenImage_NotFound(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(t.TempDir(), logger)
+
+	if _, err := uploader.OpenImage("post1/missing.png"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestListAndDeleteImages(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	image, err := uploader.StoreImage("image.png", bytes.NewReader(testImage(t, "png", 4, 4)), nil)
+	if err != nil {
+		t.Fatalf("StoreImage failed: %v", err)
 	}
+	// Leftover temp file of an interrupted upload is not an object
+	os.WriteFile(filepath.Join(tmpDir, image.Hash[:2], ".upload-123"), []byte("partial"), 0o644)
 
-	if url != "/"+expectedPath {
-		t.Errorf("unexpected image URL: %s", url)
+	objects, err := uploader.ListImages()
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != image.StorageKey || objects[0].Size != image.Size {
+		t.Fatalf("unexpected objects: %+v", objects)
+	}
+
+	if err := uploader.DeleteImage(image.StorageKey); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	if err := uploader.DeleteImage(image.StorageKey); err != nil {
+		t.Errorf("deleting a missing image should not fail: %v", err)
+	}
+	if err := uploader.DeleteImage("../outside.png"); !errors.Is(err, model.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+	if objects, _ := uploader.ListImages(); len(objects) != 0 {
+		t.Errorf("expected no objects after delete, got %+v", objects)
+	}
+}
+
+func TestListImages_MissingRoot(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(filepath.Join(t.TempDir(), "missing"), logger)
+
+	objects, err := uploader.ListImages()
+	if err != nil || len(objects) != 0 {
+		t.Errorf("expected empty listing, got %v, %v", objects, err)
+	}
+}
+
+func TestStoreImage_RefreshesModTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploader := NewLocalUploader(tmpDir, logger)
+
+	content := testImage(t, "png", 4, 4)
+	image, err := uploader.StoreImage("image.png", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("StoreImage failed: %v", err)
+	}
+	fullPath := filepath.Join(tmpDir, filepath.FromSlash(image.StorageKey))
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(fullPath, old, old)
+
+	// Re-uploading an orphan makes it fresh again, so GC does not race the new post
+	if _, err := uploader.StoreImage("again.png", bytes.NewReader(content), nil); err != nil {
+		t.Fatalf("second StoreImage failed: %v", err)
+	}
+	info, _ := os.Stat(fullPath)
+	if !info.ModTime().After(old.Add(time.Hour)) {
+		t.Errorf("expected mtime to be refreshed, got %v", info.ModTime())
 	}
 }
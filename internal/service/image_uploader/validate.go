@@ -0,0 +1,119 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	// Register decoders for image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Only formats that the standard library can decode are accepted
+// SVG is not allowed because it can carry scripts
+var extensionTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+}
+
+type formatLimit struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+}
+
+var formatLimits = map[string]formatLimit{
+	"image/jpeg": {MaxBytes: 8 << 20, MaxWidth: 8000, MaxHeight: 8000},
+	"image/png":  {MaxBytes: 8 << 20, MaxWidth: 8000, MaxHeight: 8000},
+	"image/gif":  {MaxBytes: 4 << 20, MaxWidth: 4000, MaxHeight: 4000},
+}
+
+// Nothing bigger than this is read into memory
+const maxImageBytes = 8 << 20
+
+// ImageInfo describes a validated upload
+type ImageInfo struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Shared function between UploadPostImage and UploadCommentImage
+// Validating image extension
+func validateExtension(filename string) error {
+	// Avoid empty filenames and traversal
+	if filename == "" || strings.Contains(filename, "..") || strings.HasPrefix(filename, ".") || strings.ContainsAny(filename, "/\\") {
+		return fmt.Errorf("invalid or unsafe filename %q: %w", filename, model.ErrInvalidInput)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if _, ok := extensionTypes[ext]; !ok {
+		return fmt.Errorf("extension %q: %w", ext, model.ErrUnsupportedImageType)
+	}
+	return nil
+}
+
+// validateImage reads the upload and checks that its real content matches the extension
+// Returns the image bytes so they can be stored without reading the stream twice
+func validateImage(filename string, r io.Reader) ([]byte, *ImageInfo, error) {
+	if err := validateExtension(filename); err != nil {
+		return nil, nil, err
+	}
+	expected := extensionTypes[strings.ToLower(filepath.Ext(filename))]
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading image data: %w", err)
+	}
+	if len(data) > maxImageBytes {
+		return nil, nil, model.ErrImageTooLarge
+	}
+
+	// Magic bytes first, DetectContentType only looks at the first 512 bytes
+	sniffed := http.DetectContentType(data)
+	if _, ok := formatLimits[sniffed]; !ok {
+		return nil, nil, fmt.Errorf("detected %q: %w", sniffed, model.ErrUnsupportedImageType)
+	}
+	if sniffed != expected {
+		return nil, nil, fmt.Errorf("detected %q for %q: %w", sniffed, filename, model.ErrImageTypeMismatch)
+	}
+
+	// Then make sure the header actually decodes
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding header: %w", model.ErrInvalidImage)
+	}
+	if "image/"+format != sniffed {
+		return nil, nil, fmt.Errorf("decoded %q as %q: %w", sniffed, format, model.ErrImageTypeMismatch)
+	}
+
+	limit := formatLimits[sniffed]
+	if int64(len(data)) > limit.MaxBytes {
+		return nil, nil, model.ErrImageTooLarge
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, nil, model.ErrInvalidImage
+	}
+	if cfg.Width > limit.MaxWidth || cfg.Height > limit.MaxHeight {
+		return nil, nil, fmt.Errorf("%dx%d: %w", cfg.Width, cfg.Height, model.ErrImageDimensionsTooBig)
+	}
+
+	return data, &ImageInfo{ContentType: sniffed, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// checkAccepted applies the board's rules to the sniffed type, before anything is written
+func checkAccepted(filename string, info *ImageInfo, accepts func(mimeType string) bool) error {
+	if accepts != nil && !accepts(info.ContentType) {
+		return fmt.Errorf("%s is %s: %w", filename, info.ContentType, model.ErrImageTypeNotAllowed)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package imageuploader
+
+import (
+	"1337b04rd/internal/domain/model"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateImage_Valid(t *testing.T) {
+	cases := map[string]string{
+		"photo.jpg":  "jpeg",
+		"photo.JPEG": "jpeg",
+		"pic.png":    "png",
+		"anim.gif":   "gif",
+	}
+	for filename, format := range cases {
+		data, info, err := validateImage(filename, bytes.NewReader(testImage(t, format, 4, 3)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", filename, err)
+			continue
+		}
+		if len(data) == 0 || info.ContentType != "image/"+format || info.Width != 4 || info.Height != 3 {
+			t.Errorf("%s: unexpected result: %+v", filename, info)
+		}
+	}
+}
+
+func TestValidateImage_Rejects(t *testing.T) {
+	png := testImage(t, "png", 2, 2)
+
+	cases := []struct {
+		name     string
+		filename string
+		data     []byte
+		want     error
+	}{
+		{"text renamed to png", "notes.png", []byte("just some text"), model.ErrUnsupportedImageType},
+		{"png renamed to jpg", "photo.jpg", png, model.ErrImageTypeMismatch},
+		{"svg", "logo.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), model.ErrUnsupportedImageType},
+		{"html renamed to gif", "x.gif", []byte("<html><script>alert(1)</script></html>"), model.ErrUnsupportedImageType},
+		{"truncated png", "broken.png", png[:20], model.ErrInvalidImage},
+		{"traversal", "../image.png", png, model.ErrInvalidInput},
+		{"too big", "big.png", append(append([]byte{}, png...), bytes.Repeat([]byte{0}, maxImageBytes)...), model.ErrImageTooLarge},
+		{"too wide", "wide.png", testImage(t, "png", 8001, 1), model.ErrImageDimensionsTooBig},
+		{"gif too tall", "tall.gif", testImage(t, "gif", 1, 4001), model.ErrImageDimensionsTooBig},
+	}
+
+	for _, tc := range cases {
+		_, _, err := validateImage(tc.filename, bytes.NewReader(tc.data))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestValidateExtension_Unsupported(t *testing.T) {
+	for _, name := range []string{"a.webp", "a.bmp", "a.svg", "a.exe", "noext"} {
+		err := validateExtension(name)
+		if !errors.Is(err, model.ErrUnsupportedImageType) {
+			t.Errorf("%s: expected ErrUnsupportedImageType, got %v", name, err)
+		}
+	}
+	if err := validateExtension("dir/a.png"); err == nil || !strings.Contains(err.Error(), "unsafe") {
+		t.Errorf("expected unsafe filename error, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Original names are display only, keep them short and without directories
+const maxOriginalNameLength = 255
+
+// upload is a stored image together with the bytes it came from, kept until commit
+// so that a file deleted in the meantime can be written again
+type upload struct {
+	attachment model.Attachment
+	data       []byte
+	thumb      []byte
+	thumbExt   string
+}
+
+type uploads []upload
+
+func (u uploads) attachments() []model.Attachment {
+	var attachments []model.Attachment
+	for _, up := range u {
+		attachments = append(attachments, up.attachment)
+	}
+	return attachments
+}
+
+// created are the images this call wrote, the only ones a failed transaction may delete
+func (u uploads) created() []model.Image {
+	var images []model.Image
+	for _, up := range u {
+		if up.attachment.Image.Created {
+			images = append(images, up.attachment.Image)
+		}
+	}
+	return images
+}
+
+func (u uploads) hashes() []string {
+	var hashes []string
+	for _, up := range u {
+		hashes = append(hashes, up.attachment.Image.Hash)
+	}
+	return hashes
+}
+
+// uploadImages stores every original and a thumbnail right next to it
+// Storage is content addressed, so the same picture posted twice is kept once
+// It runs before the unit of work, so no transaction waits on storage
+// On error the uploads stored so far are returned too, for the caller to release
+// The board decides which of the supported types it accepts
+func uploadImages(imageData map[string]io.Reader, board *model.Board, uploader port.ImageUploader, thumbnailer port.Thumbnailer) (uploads, error) {
+	var stored uploads
+
+	for filename, content := range imageData {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return stored, fmt.Errorf("reading %s: %w", filename, err)
+		}
+
+		image, err := uploader.StoreImage(filename, bytes.NewReader(data), board.Accepts)
+		if err != nil {
+			return stored, fmt.Errorf("uploading %s: %w", filename, err)
+		}
+		up := upload{attachment: model.Attachment{Image: *image, OriginalName: displayName(filename)}, data: data}
+
+		if thumbnailer != nil {
+			up.thumb, up.thumbExt, err = thumbnailer.Thumbnail(data)
+			if err != nil {
+				return append(stored, up), fmt.Errorf("making thumbnail for %s: %w", filename, err)
+			}
+
+			up.attachment.Image.ThumbnailKey, err = uploader.StoreThumbnail(image.Hash, up.thumb, up.thumbExt)
+			if err != nil {
+				return append(stored, up), fmt.Errorf("uploading thumbnail for %s: %w", filename, err)
+			}
+		}
+
+		stored = append(stored, up)
+	}
+
+	return stored, nil
+}
+
+// pinUploads locks the images for the rest of the transaction and writes back any file
+// a concurrent releaseImages removed since the upload, so a committed link always has its file
+func pinUploads(ctx context.Context, tx port.Tx, uploader port.ImageUploader, stored uploads) error {
+	if len(stored) == 0 {
+		return nil
+	}
+	if err := tx.Images().LockImages(ctx, stored.hashes()); err != nil {
+		return err
+	}
+
+	for _, up := range stored {
+		image := up.attachment.Image
+		ok, err := uploader.HasImage(image.StorageKey)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if _, err := uploader.StoreImage(up.attachment.OriginalName, bytes.NewReader(up.data), nil); err != nil {
+				return fmt.Errorf("restoring %s: %w", image.StorageKey, err)
+			}
+		}
+
+		if image.ThumbnailKey == "" {
+			continue
+		}
+		if ok, err = uploader.HasImage(image.ThumbnailKey); err != nil {
+			return err
+		}
+		if !ok {
+			if _, err := uploader.StoreThumbnail(image.Hash, up.thumb, up.thumbExt); err != nil {
+				return fmt.Errorf("restoring %s: %w", image.ThumbnailKey, err)
+			}
+		}
+	}
+	return nil
+}
+
+// releaseImages deletes the files of images no post or comment links any more
+// Under the image locks, so it cannot race a transaction about to link the same content
+// Failures are only logged, the image garbage collector is the safety net
+func releaseImages(ctx context.Context, uow port.UnitOfWork, uploader port.ImageUploader, images []model.Image, log *slog.Logger) {
+	if len(images) == 0 {
+		return
+	}
+
+	// The request may already be gone, the cleanup should still run
+	ctx = context.WithoutCancel(ctx)
+	err := uow.Do(ctx, func(tx port.Tx) error {
+		var hashes []string
+		for _, image := range images {
+			hashes = append(hashes, image.Hash)
+		}
+		if err := tx.Images().LockImages(ctx, hashes); err != nil {
+			return err
+		}
+
+		linked, err := tx.Images().LinkedHashes(ctx, hashes)
+		if err != nil {
+			return err
+		}
+
+		for _, image := range images {
+			if linked[image.Hash] {
+				continue
+			}
+			for _, key := range []string{image.StorageKey, image.ThumbnailKey} {
+				if key == "" {
+					continue
+				}
+				if err := uploader.DeleteImage(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn("failed to delete released images, left to the garbage collector", slog.Any("error", err))
+	}
+}
+
+// uploadBoard is the board whose upload rules apply, looked up only when there is something to upload
+func uploadBoard(ctx context.Context, boards port.BoardRepo, boardID int, imageData map[string]io.Reader) (*model.Board, error) {
+	if len(imageData) == 0 {
+		return nil, nil
+	}
+	return boards.GetBoardByID(ctx, boardID)
+}
+
+// displayName drops any client supplied directories and caps the length
+func displayName(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	for len(name) > maxOriginalNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
@@ -3,18 +3,44 @@ package service
 
 import (
 	"1337b04rd/internal/domain/model"
+	"1337b04rd/internal/domain/port"
 	"1337b04rd/pkg/utils"
 	"context"
-	"database/sql"
+	"fmt"
 	"io"
+	"sort"
+	"sync"
 	"time"
 )
 
 // ========== Mock SessionRepo ==========
 type MockSessionRepo struct {
-	Sessions map[utils.UUID]*model.Session
-	Saved    *model.Session
-	Expired  bool
+	Sessions  map[utils.UUID]*model.Session
+	Saved     *model.Session
+	Expired   bool
+	NamedAt   time.Time             // time of the last name change
+	Extended  int                   // ExtendSession calls
+	Codes     map[string]utils.UUID // recovery code hash -> session
+	Authors   map[utils.UUID]bool   // sessions with posts or comments, never deleted
+	Avatars   map[int]int           // avatar -> unexpired sessions, set by RecountAvatars
+	DeleteErr error
+}
+
+// Hands out the lowest avatar ID not held by an active session, then the least used one
+func (m *MockSessionRepo) AllocateAvatar(ctx context.Context, avatarPool int) (int, error) {
+	used := make(map[int]int)
+	for _, s := range m.Sessions {
+		if s.ExpiresAt.After(time.Now()) {
+			used[s.AvatarID]++
+		}
+	}
+	avatarID := 0
+	for id := 1; id <= avatarPool; id++ {
+		if avatarID == 0 || used[id] < used[avatarID] {
+			avatarID = id
+		}
+	}
+	return avatarID, nil
 }
 
 func (m *MockSessionRepo) CreateSession(ctx context.Context, session *model.Session) error {
@@ -31,20 +57,147 @@ func (m *MockSessionRepo) GetSessionByID(ctx context.Context, id utils.UUID) (*m
 	return sess, nil
 }
 
+func (m *MockSessionRepo) SetDisplayName(ctx context.Context, id utils.UUID, name string, at time.Time) error {
+	sess, ok := m.Sessions[id]
+	if !ok {
+		return model.ErrSessionNotFound
+	}
+	sess.DisplayName = name
+	m.NamedAt = at
+	return nil
+}
+
+func (m *MockSessionRepo) ExtendSession(ctx context.Context, id utils.UUID, expiresAt time.Time) error {
+	sess, ok := m.Sessions[id]
+	if !ok {
+		return model.ErrSessionNotFound
+	}
+	sess.ExpiresAt = expiresAt
+	m.Extended++
+	return nil
+}
+
+func (m *MockSessionRepo) RotateSessionID(ctx context.Context, oldID, newID utils.UUID) error {
+	sess, ok := m.Sessions[oldID]
+	if !ok {
+		return model.ErrSessionNotFound
+	}
+	delete(m.Sessions, oldID)
+	sess.SessionID = newID
+	m.Sessions[newID] = sess
+	return nil
+}
+
+func (m *MockSessionRepo) ReplaceRecoveryCode(ctx context.Context, sessionID utils.UUID, codeHash string, at time.Time) error {
+	m.DeleteRecoveryCodes(ctx, sessionID)
+	if m.Codes == nil {
+		m.Codes = make(map[string]utils.UUID)
+	}
+	m.Codes[codeHash] = sessionID
+	return nil
+}
+
+func (m *MockSessionRepo) ConsumeRecoveryCode(ctx context.Context, codeHash string) (utils.UUID, error) {
+	id, ok := m.Codes[codeHash]
+	if !ok {
+		return "", model.ErrInvalidRecovery
+	}
+	delete(m.Codes, codeHash)
+	return id, nil
+}
+
+func (m *MockSessionRepo) DeleteRecoveryCodes(ctx context.Context, sessionID utils.UUID) error {
+	for hash, id := range m.Codes {
+		if id == sessionID {
+			delete(m.Codes, hash)
+		}
+	}
+	return nil
+}
+
 func (m *MockSessionRepo) DeleteExpiredSession(ctx context.Context) error {
+	if m.DeleteErr != nil {
+		return m.DeleteErr
+	}
+	for id, s := range m.Sessions {
+		if s.ExpiresAt.Before(time.Now()) && !m.Authors[id] {
+			delete(m.Sessions, id)
+		}
+	}
 	m.Expired = true
 	return nil
 }
 
+func (m *MockSessionRepo) RecountAvatars(ctx context.Context) error {
+	m.Avatars = make(map[int]int)
+	for _, s := range m.Sessions {
+		if s.ExpiresAt.After(time.Now()) {
+			m.Avatars[s.AvatarID]++
+		}
+	}
+	return nil
+}
+
+// ========== Mock AvatarProvider ==========
+type MockAvatarProvider struct {
+	URL       string
+	SessionID utils.UUID // last session asked for
+	AvatarIDs []int
+	Err       error
+}
+
+func (m *MockAvatarProvider) AvatarURL(ctx context.Context, sessionID utils.UUID, avatarID int) (string, error) {
+	m.SessionID = sessionID
+	m.AvatarIDs = append(m.AvatarIDs, avatarID)
+	return m.URL, m.Err
+}
+
+// ========== Mock BoardRepo ==========
+// Without Boards set, /b/ is the only board and accepts every image
+type MockBoardRepo struct {
+	Boards []model.Board
+}
+
+func (m *MockBoardRepo) GetBoards(ctx context.Context) ([]model.Board, error) {
+	if m.Boards == nil {
+		return []model.Board{{BoardID: 1, Slug: "b", Title: "Random"}}, nil
+	}
+	return m.Boards, nil
+}
+
+func (m *MockBoardRepo) GetBoardBySlug(ctx context.Context, slug string) (*model.Board, error) {
+	boards, _ := m.GetBoards(ctx)
+	for _, b := range boards {
+		if b.Slug == slug {
+			return &b, nil
+		}
+	}
+	return nil, model.ErrBoardNotFound
+}
+
+func (m *MockBoardRepo) GetBoardByID(ctx context.Context, id int) (*model.Board, error) {
+	boards, _ := m.GetBoards(ctx)
+	for _, b := range boards {
+		if b.BoardID == id {
+			return &b, nil
+		}
+	}
+	return nil, model.ErrBoardNotFound
+}
+
 // ========== Mock PostRepo ==========
 type MockPostRepo struct {
 	Posts       map[utils.UUID]*model.Post
 	CreatedPost *model.Post
 	ArchivedID  utils.UUID
-	UpdatedName bool
+	CreateErr   error
+	Updated     int // UpdatePost calls
 }
 
 func (m *MockPostRepo) CreatePost(ctx context.Context, post *model.Post) error {
+	if m.CreateErr != nil {
+		return m.CreateErr
+	}
 	m.CreatedPost = post
 	m.Posts[post.PostID] = post
 	return nil
@@ -55,20 +208,32 @@ func (m *MockPostRepo) GetPostByID(ctx context.Context, id utils.UUID) (*model.P
 	if !ok {
 		return nil, model.ErrPostNotFound
 	}
-	return p, nil
+	// A copy like a fresh row, changes count only once saved
+	c := *p
+	return &c, nil
 }
 
-func (m *MockPostRepo) GetAllPosts(ctx context.Context, archived bool) ([]*model.Post, error) {
+func (m *MockPostRepo) GetAllPosts(ctx context.Context, boardID int, archived bool) ([]*model.Post, error) {
 	var result []*model.Post
 	for _, p := range m.Posts {
-		if p.IsArchived == archived {
+		if p.IsArchived == archived && (boardID == 0 || p.BoardID == boardID) {
 			result = append(result, p)
 		}
 	}
 	return result, nil
 }
 
-func (m *MockPostRepo) ArchivePostTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error {
+func (m *MockPostRepo) GetThreadsBySession(ctx context.Context, sessionID utils.UUID) ([]model.ThreadActivity, error) {
+	var threads []model.ThreadActivity
+	for _, p := range m.Posts {
+		if p.SessionID == sessionID {
+			threads = append(threads, model.ThreadActivity{Post: p})
+		}
+	}
+	return threads, nil
+}
+
+func (m *MockPostRepo) ArchivePost(ctx context.Context, postID utils.UUID) error {
 	if post, ok := m.Posts[postID]; ok {
 		post.IsArchived = true
 		m.ArchivedID = postID
@@ -77,16 +242,167 @@ func (m *MockPostRepo) ArchivePostTx(ctx context.Context, tx *sql.Tx, postID uti
 	return model.ErrPostNotFound
 }
 
-func (m *MockPostRepo) UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error {
-	m.UpdatedName = true
+func (m *MockPostRepo) ListPosts(ctx context.Context, boardID int, archived bool, cursor *model.Cursor, backward bool, limit int) ([]*model.Post, error) {
+	var listing []*model.Post
+	for _, p := range m.Posts {
+		if p.IsArchived == archived && p.BoardID == boardID {
+			listing = append(listing, p)
+		}
+	}
+	sort.Slice(listing, func(i, j int) bool {
+		return sortsBefore(listing[i].Cursor(archived), listing[j].Cursor(archived))
+	})
+
+	var result []*model.Post
+	if backward {
+		for i := len(listing) - 1; i >= 0 && len(result) < limit; i-- {
+			if sortsBefore(listing[i].Cursor(archived), *cursor) {
+				result = append([]*model.Post{listing[i]}, result...)
+			}
+		}
+		return result, nil
+	}
+	for _, p := range listing {
+		if len(result) < limit && (cursor == nil || sortsBefore(*cursor, p.Cursor(archived))) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// Display order of the listings, newest first
+func sortsBefore(a, b model.Cursor) bool {
+	if a.Sticky != b.Sticky {
+		return a.Sticky
+	}
+	if !a.At.Equal(b.At) {
+		return a.At.After(b.At)
+	}
+	return a.PostID > b.PostID
+}
+
+// Same order as the SQL: bumped_at, then created_at, then post_id, newest first
+func (m *MockPostRepo) ArchiveOverflow(ctx context.Context, boardID, maxThreads int) ([]utils.UUID, error) {
+	var active []*model.Post
+	for _, p := range m.Posts {
+		if p.BoardID == boardID && !p.IsArchived && !p.IsSticky {
+			active = append(active, p)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		a, b := active[i], active[j]
+		if !a.BumpedAt.Equal(b.BumpedAt) {
+			return a.BumpedAt.After(b.BumpedAt)
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.PostID > b.PostID
+	})
+
+	var archived []utils.UUID
+	for i := maxThreads; i < len(active); i++ {
+		active[i].IsArchived = true
+		archived = append(archived, active[i].PostID)
+	}
+	return archived, nil
+}
+
+func (m *MockPostRepo) SetSticky(ctx context.Context, postID utils.UUID, sticky bool) error {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return model.ErrPostNotFound
+	}
+	post.IsSticky = sticky
 	return nil
 }
 
+func (m *MockPostRepo) SetLocked(ctx context.Context, postID utils.UUID, locked bool) error {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return model.ErrPostNotFound
+	}
+	post.IsLocked = locked
+	return nil
+}
+
+// The mock counts no tombstones of its own, ReplyCount stands for every comment
+func (m *MockPostRepo) LockThread(ctx context.Context, postID utils.UUID) (int, error) {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return 0, model.ErrPostNotFound
+	}
+	return post.ReplyCount, nil
+}
+
+func (m *MockPostRepo) BumpPost(ctx context.Context, postID utils.UUID, bumpedAt time.Time) error {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return model.ErrPostNotFound
+	}
+	post.BumpedAt = bumpedAt
+	return nil
+}
+
+// Nothing else links images in the mocks, so every unlinked image is released
+func (m *MockPostRepo) DeletePost(ctx context.Context, postID utils.UUID) ([]model.Image, error) {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return nil, model.ErrPostNotFound
+	}
+	delete(m.Posts, postID)
+	return imagesOf(post.Attachments), nil
+}
+
+func (m *MockPostRepo) DeletePostImages(ctx context.Context, postID utils.UUID) ([]model.Image, error) {
+	post, ok := m.Posts[postID]
+	if !ok {
+		return nil, model.ErrPostNotFound
+	}
+	released := imagesOf(post.Attachments)
+	post.Attachments = nil
+	return released, nil
+}
+
+func (m *MockPostRepo) UpdatePost(ctx context.Context, post *model.Post, replaceImages bool) ([]model.Image, error) {
+	old, ok := m.Posts[post.PostID]
+	if !ok {
+		return nil, model.ErrPostNotFound
+	}
+	var released []model.Image
+	if replaceImages {
+		released = imagesOf(old.Attachments)
+	}
+	m.Updated++
+	m.Posts[post.PostID] = post
+	return released, nil
+}
+
+func imagesOf(attachments []model.Attachment) []model.Image {
+	var images []model.Image
+	for _, a := range attachments {
+		images = append(images, a.Image)
+	}
+	return images
+}
+
+func (m *MockPostRepo) GetPostRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error) {
+	return []model.Revision{{OwnerID: postID, Number: 1}}, nil
+}
+
 // ========== Mock CommentRepo ==========
 type MockCommentRepo struct {
 	CreatedComment *model.Comment
 	LatestTime     *time.Time
-	UpdatedName    bool
+	Activity       []model.CommentActivity       // returned for any session
+	Comments       map[utils.UUID]*model.Comment // served by GetCommentByID, anything else is a stub
+	Deleted        utils.UUID
+	ImagesDeleted  utils.UUID
+	Updated        *model.Comment
+}
+
+func (m *MockCommentRepo) GetCommentsBySession(ctx context.Context, sessionID utils.UUID) ([]model.CommentActivity, error) {
+	return m.Activity, nil
 }
 
 func (m *MockCommentRepo) CreateComment(ctx context.Context, comment *model.Comment) error {
@@ -95,6 +411,9 @@ func (m *MockCommentRepo) CreateComment(ctx context.Context, comment *model.Comm
 }
 
 func (m *MockCommentRepo) GetCommentByID(ctx context.Context, id utils.UUID) (*model.Comment, error) {
+	if c, ok := m.Comments[id]; ok {
+		return c, nil
+	}
 	return &model.Comment{CommentID: id, PostID: "post123", IsArchived: false}, nil
 }
 
@@ -106,22 +425,259 @@ func (m *MockCommentRepo) GetLatestCommentTime(ctx context.Context, postID utils
 	return m.LatestTime, nil
 }
 
-func (m *MockCommentRepo) ArchiveCommentByPostIDTx(ctx context.Context, tx *sql.Tx, postID utils.UUID) error {
+// Like the real repo, a post without comments reports ErrCommentNotFound
+func (m *MockCommentRepo) ArchiveCommentByPostID(ctx context.Context, postID utils.UUID) error {
+	if m.LatestTime == nil {
+		return model.ErrCommentNotFound
+	}
+	return nil
+}
+
+func (m *MockCommentRepo) DeleteComment(ctx context.Context, commentID utils.UUID) ([]model.Image, error) {
+	m.Deleted = commentID
+	if c, ok := m.Comments[commentID]; ok {
+		return imagesOf(c.Attachments), nil
+	}
+	return nil, nil
+}
+
+func (m *MockCommentRepo) DeleteCommentImages(ctx context.Context, commentID utils.UUID) ([]model.Image, error) {
+	m.ImagesDeleted = commentID
+	if c, ok := m.Comments[commentID]; ok {
+		return imagesOf(c.Attachments), nil
+	}
+	return nil, nil
+}
+
+func (m *MockCommentRepo) UpdateComment(ctx context.Context, comment *model.Comment, replaceImages bool) ([]model.Image, error) {
+	m.Updated = comment
+	return nil, nil
+}
+
+func (m *MockCommentRepo) GetCommentRevisions(ctx context.Context, postID utils.UUID) ([]model.Revision, error) {
+	return nil, nil
+}
+
+// ========== Mock NotificationRepo ==========
+type MockNotificationRepo struct {
+	Notified map[utils.UUID][]utils.UUID // session → reply IDs
+	Unread   []model.Notification        // returned for any session
+	ReadIDs  []utils.UUID
+	ReadAll  bool
+}
+
+func (m *MockNotificationRepo) CreateNotification(ctx context.Context, sessionID, replyID utils.UUID, createdAt time.Time) error {
+	if m.Notified == nil {
+		m.Notified = make(map[utils.UUID][]utils.UUID)
+	}
+	m.Notified[sessionID] = append(m.Notified[sessionID], replyID)
 	return nil
 }
 
-func (m *MockCommentRepo) UpdateUserNameForSession(ctx context.Context, sessionID utils.UUID, newName string) error {
-	m.UpdatedName = true
+func (m *MockNotificationRepo) GetUnreadNotifications(ctx context.Context, sessionID utils.UUID) ([]model.Notification, error) {
+	return m.Unread, nil
+}
+
+func (m *MockNotificationRepo) MarkNotificationsRead(ctx context.Context, sessionID utils.UUID, replyIDs []utils.UUID, readAt time.Time) error {
+	m.ReadIDs = replyIDs
+	m.ReadAll = len(replyIDs) == 0
 	return nil
 }
 
+// ========== Mock UnitOfWork ==========
+// Runs fn against the plain mocks, RolledBack is set when fn fails
+type MockUnitOfWork struct {
+	Posts         *MockPostRepo
+	Comments      *MockCommentRepo
+	Notifications *MockNotificationRepo
+	Images        *MockImageRepo // created on first use when nil
+	RolledBack    bool
+}
+
+type mockTx struct {
+	uow *MockUnitOfWork
+}
+
+func (t *mockTx) Posts() port.PostRepo                 { return t.uow.Posts }
+func (t *mockTx) Comments() port.CommentRepo           { return t.uow.Comments }
+func (t *mockTx) Notifications() port.NotificationRepo { return t.uow.Notifications }
+func (t *mockTx) Images() port.ImageRepo {
+	if t.uow.Images == nil {
+		t.uow.Images = &MockImageRepo{}
+	}
+	return t.uow.Images
+}
+
+func (m *MockUnitOfWork) Do(ctx context.Context, fn func(tx port.Tx) error) error {
+	tx := &mockTx{uow: m}
+	if err := fn(tx); err != nil {
+		m.RolledBack = true
+		return err
+	}
+	return nil
+}
+
+// ========== Mock UnitOfWork with board locks ==========
+// Models what ArchiveOverflow relies on in Postgres: a new post stays invisible to other
+// transactions until commit, and the board lock ArchiveOverflow takes is held until then
+type MockLockingUnitOfWork struct {
+	mu     sync.Mutex                 // guards Posts
+	Posts  map[utils.UUID]*model.Post // committed rows
+	boards sync.Map                   // board ID -> *sync.Mutex
+}
+
+type lockingTx struct {
+	uow      *MockLockingUnitOfWork
+	created  []*model.Post
+	archived []utils.UUID
+	held     []*sync.Mutex
+}
+
+func (t *lockingTx) Posts() port.PostRepo {
+	return &lockingPostRepo{MockPostRepo: &MockPostRepo{}, tx: t}
+}
+func (t *lockingTx) Comments() port.CommentRepo           { return &MockCommentRepo{} }
+func (t *lockingTx) Notifications() port.NotificationRepo { return &MockNotificationRepo{} }
+func (t *lockingTx) Images() port.ImageRepo               { return &MockImageRepo{} }
+
+func (m *MockLockingUnitOfWork) Do(ctx context.Context, fn func(tx port.Tx) error) error {
+	tx := &lockingTx{uow: m}
+	// Runs last, the board locks outlive the commit below
+	defer func() {
+		for _, lock := range tx.held {
+			lock.Unlock()
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range tx.created {
+		m.Posts[p.PostID] = p
+	}
+	for _, id := range tx.archived {
+		m.Posts[id].IsArchived = true
+	}
+	return nil
+}
+
+// Copies of the committed rows, what a statement starting now sees
+func (m *MockLockingUnitOfWork) snapshot() map[utils.UUID]*model.Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	posts := make(map[utils.UUID]*model.Post, len(m.Posts))
+	for id, p := range m.Posts {
+		c := *p
+		posts[id] = &c
+	}
+	return posts
+}
+
+type lockingPostRepo struct {
+	*MockPostRepo
+	tx *lockingTx
+}
+
+func (r *lockingPostRepo) CreatePost(ctx context.Context, post *model.Post) error {
+	r.tx.created = append(r.tx.created, post)
+	return nil
+}
+
+func (r *lockingPostRepo) ArchiveOverflow(ctx context.Context, boardID, maxThreads int) ([]utils.UUID, error) {
+	l, _ := r.tx.uow.boards.LoadOrStore(boardID, &sync.Mutex{})
+	lock := l.(*sync.Mutex)
+	lock.Lock()
+	r.tx.held = append(r.tx.held, lock)
+
+	// Committed threads plus this transaction's own, archived like the plain mock does
+	view := &MockPostRepo{Posts: r.tx.uow.snapshot()}
+	for _, p := range r.tx.created {
+		c := *p
+		view.Posts[p.PostID] = &c
+	}
+	archived, err := view.ArchiveOverflow(ctx, boardID, maxThreads)
+	r.tx.archived = append(r.tx.archived, archived...)
+
+	// A round trip to the database, other writers count in the meantime unless the lock stops them
+	time.Sleep(time.Millisecond)
+	return archived, err
+}
+
 // ========== Mock Uploader ==========
-type MockUploader struct{}
+type MockUploader struct {
+	Stored     []string // filenames in upload order
+	Thumbnails int
+	Objects    []model.ObjectInfo // returned by ListImages
+	Deleted    []string
+	ListErr    error
+	Existing   bool            // pretend every upload was already stored
+	Missing    map[string]bool // keys HasImage reports as gone
+}
+
+func (m *MockUploader) StoreImage(filename string, r io.Reader, accepts func(mimeType string) bool) (*model.Image, error) {
+	data, _ := io.ReadAll(r)
+	if accepts != nil && !accepts("image/png") {
+		return nil, model.ErrImageTypeNotAllowed
+	}
+	m.Stored = append(m.Stored, filename)
+	hash := fmt.Sprintf("%064x", len(data))
+	return &model.Image{Hash: hash, StorageKey: hash + ".png", MimeType: "image/png", Size: int64(len(data)), Created: !m.Existing}, nil
+}
+
+func (m *MockUploader) StoreThumbnail(hash string, data []byte, ext string) (string, error) {
+	m.Thumbnails++
+	return hash + "_thumb" + ext, nil
+}
+
+func (m *MockUploader) HasImage(key string) (bool, error) {
+	return !m.Missing[key], nil
+}
+
+func (m *MockUploader) OpenImage(key string) (*model.ImageObject, error) {
+	return nil, model.ErrNotFound
+}
+
+func (m *MockUploader) ListImages() ([]model.ObjectInfo, error) {
+	return m.Objects, m.ListErr
+}
+
+func (m *MockUploader) DeleteImage(key string) error {
+	m.Deleted = append(m.Deleted, key)
+	return nil
+}
 
-func (m *MockUploader) UploadPostImage(postID, filename string, r io.Reader) (string, error) {
-	return "https://mock.upload/post.png", nil
+// ========== Mock Image Repo ==========
+type MockImageRepo struct {
+	Referenced map[string]bool
+	Linked     map[string]bool // hashes some other post or comment still uses
+	Locked     []string
+	Err        error
 }
 
-func (m *MockUploader) UploadCommentImage(postID, commentID, filename string, r io.Reader) (string, error) {
-	return "https://mock.upload/comment.png", nil
+func (m *MockImageRepo) ReferencedKeys(ctx context.Context) (map[string]bool, error) {
+	return m.Referenced, m.Err
+}
+
+func (m *MockImageRepo) LockImages(ctx context.Context, hashes []string) error {
+	m.Locked = append(m.Locked, hashes...)
+	return m.Err
+}
+
+func (m *MockImageRepo) LinkedHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	linked := make(map[string]bool)
+	for _, hash := range hashes {
+		if m.Linked[hash] {
+			linked[hash] = true
+		}
+	}
+	return linked, m.Err
+}
+
+// ========== Mock Thumbnailer ==========
+type MockThumbnailer struct{}
+
+func (m *MockThumbnailer) Thumbnail(data []byte) ([]byte, string, error) {
+	return []byte("thumb"), ".jpg", nil
 }
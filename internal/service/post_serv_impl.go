@@ -7,7 +7,6 @@ import (
 	"1337b04rd/pkg/logger"
 	"1337b04rd/pkg/utils"
 	"context"
-	"database/sql"
 	"errors"
 	"io"
 	"log/slog"
@@ -17,17 +16,23 @@ import (
 type PostServiceImpl struct {
 	repo        port.PostRepo
 	commentRepo port.CommentRepo
-	db          *sql.DB
+	boards      port.BoardRepo
+	uow         port.UnitOfWork
 	uploader    port.ImageUploader
+	thumbnailer port.Thumbnailer
+	editWindow  time.Duration // how long after posting the author may edit
 	logger      *slog.Logger
 }
 
-func NewPostServiceImpl(repo port.PostRepo, commentRepo port.CommentRepo, db *sql.DB, uploader port.ImageUploader, logger *slog.Logger) *PostServiceImpl {
+func NewPostServiceImpl(repo port.PostRepo, commentRepo port.CommentRepo, boards port.BoardRepo, uow port.UnitOfWork, uploader port.ImageUploader, thumbnailer port.Thumbnailer, editWindow time.Duration, logger *slog.Logger) *PostServiceImpl {
 	return &PostServiceImpl{
 		repo:        repo,
 		commentRepo: commentRepo,
-		db:          db,
+		boards:      boards,
+		uow:         uow,
 		uploader:    uploader,
+		thumbnailer: thumbnailer,
+		editWindow:  editWindow,
 		logger:      logger,
 	}
 }
@@ -42,6 +47,7 @@ func (s *PostServiceImpl) CreatePost(ctx context.Context, post *model.Post, imag
 	}
 	post.PostID = UUIDnum
 	post.CreatedAt = time.Now()
+	post.BumpedAt = post.CreatedAt
 
 	// Check if title & session are not empty
 	if err := post.ValidatePost(); err != nil {
@@ -49,38 +55,73 @@ func (s *PostServiceImpl) CreatePost(ctx context.Context, post *model.Post, imag
 		return logger.ErrorWrapper("service", "CreatePost", "validation", err)
 	}
 
-	// Check if there are any images attached
+	// Threads are opened on the board named in the form
+	if !model.ValidBoardSlug(post.BoardSlug) {
+		return logger.ErrorWrapper("service", "CreatePost", "checking board", model.ErrBoardNotFound)
+	}
+	board, err := s.boards.GetBoardBySlug(ctx, post.BoardSlug)
+	if err != nil {
+		return logger.ErrorWrapper("service", "CreatePost", "finding board", err)
+	}
+	post.BoardID = board.BoardID
+	post.Archive = board.Archive
+
+	// Upload images and their thumbnails before the transaction
+	var uploaded uploads
 	if len(imageData) > 0 {
+		uploaded, err = uploadImages(imageData, board, s.uploader, s.thumbnailer)
+		if err != nil {
+			s.logger.Error("image upload failed", slog.Any("error", err))
+			releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+			return logger.ErrorWrapper("service", "CreatePost", "image uploading", err)
+		}
 
-		// Upload images to buckets
-		var urls []string
-		for filename, content := range imageData {
-			url, err := s.uploader.UploadPostImage(string(post.PostID), filename, content)
-			if err != nil {
-				s.logger.Error("image upload failed", slog.String("filename", filename), slog.Any("error", err))
-				return logger.ErrorWrapper("service", "CreatePost", "image uploading", err)
-			}
+		// Save image rows to db, they are referenced by hash
+		post.Attachments = uploaded.attachments()
+	}
+
+	// Image rows, the post and the pruning either all succeed or leave nothing behind
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
 
-			urls = append(urls, url)
+		// The files have to be there when the links commit
+		if err := pinUploads(ctx, tx, s.uploader, uploaded); err != nil {
+			return logger.ErrorWrapper("service", "CreatePost", "pinning images", err)
 		}
 
-		// Save urls to db
-		post.ImageURLs = urls
-	}
+		// Save to repo
+		if err := tx.Posts().CreatePost(ctx, post); err != nil {
+			return logger.ErrorWrapper("service", "CreatePost", "saving post to repo", err)
+		}
 
-	// Save to repo
-	if err := s.repo.CreatePost(ctx, post); err != nil {
-		return logger.ErrorWrapper("service", "CreatePost", "saving post to repo", err)
+		// A full board drops its least recently bumped threads to the archive
+		if board.MaxThreads > 0 {
+			pruned, err := tx.Posts().ArchiveOverflow(ctx, board.BoardID, board.MaxThreads)
+			if err != nil {
+				return logger.ErrorWrapper("service", "CreatePost", "pruning threads", err)
+			}
+			for _, id := range pruned {
+				if err := tx.Comments().ArchiveCommentByPostID(ctx, id); err != nil && !errors.Is(err, model.ErrCommentNotFound) {
+					return logger.ErrorWrapper("service", "CreatePost", "archiving pruned comments", err)
+				}
+				s.logger.Info("thread pruned from a full board", slog.String("post_id", string(id)), slog.String("board", board.Slug))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Only files this call wrote, older ones may belong to other posts
+		releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+		return err
 	}
 
 	s.logger.Info("post created successfully", slog.String("postID", string(post.PostID)))
 	return nil
 }
 
-// GetAllPosts retrieves all non-archived posts from the database.
+// GetAllPosts retrieves the active or archived posts of a board, of every board for boardID 0.
 // Used to display the post catalog.
-func (s *PostServiceImpl) GetAllPosts(ctx context.Context, archived bool) ([]*model.Post, error) {
-	posts, err := s.repo.GetAllPosts(ctx, archived)
+func (s *PostServiceImpl) GetAllPosts(ctx context.Context, boardID int, archived bool) ([]*model.Post, error) {
+	posts, err := s.repo.GetAllPosts(ctx, boardID, archived)
 	if err != nil {
 		return nil, logger.ErrorWrapper("service", "GetAllPosts", "fetching posts", err)
 	}
@@ -88,6 +129,65 @@ func (s *PostServiceImpl) GetAllPosts(ctx context.Context, archived bool) ([]*mo
 	return posts, nil
 }
 
+// ListPosts returns one page of a board's catalog or archive.
+// Next and Prev are opaque cursors of the neighbouring pages, empty at either end.
+func (s *PostServiceImpl) ListPosts(ctx context.Context, boardID int, archived bool, page model.PageRequest) (*model.PostPage, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = model.DefaultPageSize
+	}
+	limit = min(limit, model.MaxPageSize)
+
+	var cursor *model.Cursor
+	backward := page.Before != ""
+	for _, raw := range []string{page.After, page.Before} {
+		if raw == "" {
+			continue
+		}
+		if cursor != nil {
+			return nil, logger.ErrorWrapper("service", "ListPosts", "decoding cursor", model.ErrInvalidCursor)
+		}
+		c, err := model.DecodeCursor(raw)
+		if err != nil {
+			return nil, logger.ErrorWrapper("service", "ListPosts", "decoding cursor", err)
+		}
+		cursor = &c
+	}
+
+	// One row more than asked tells whether there is another page
+	posts, err := s.repo.ListPosts(ctx, boardID, archived, cursor, backward, limit+1)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "ListPosts", "fetching posts", err)
+	}
+	more := len(posts) > limit
+	if more && backward {
+		posts = posts[1:]
+	} else if more {
+		posts = posts[:limit]
+	}
+
+	result := &model.PostPage{Posts: posts}
+	if len(posts) == 0 {
+		return result, nil
+	}
+	first, last := posts[0].Cursor(archived).Encode(), posts[len(posts)-1].Cursor(archived).Encode()
+	if backward {
+		// The page came from the cursor, so there is one after it
+		result.Next = last
+		if more {
+			result.Prev = first
+		}
+	} else {
+		if more {
+			result.Next = last
+		}
+		if cursor != nil {
+			result.Prev = first
+		}
+	}
+	return result, nil
+}
+
 // GetPostByID retrieves a single post by its ID.
 // Used to view the full thread along with comments.
 func (s *PostServiceImpl) GetPostByID(ctx context.Context, id utils.UUID) (*model.Post, error) {
@@ -109,57 +209,188 @@ func (s *PostServiceImpl) ArchivePost(ctx context.Context, postID utils.UUID) er
 		return logger.ErrorWrapper("service", "ArchivePost", "getting post", err)
 	}
 
+	// Operators pinned it, only they can take it down
+	if post.IsSticky {
+		s.logger.Debug("sticky post is not archived", slog.String("post_id", string(postID)))
+		return nil
+	}
+
 	// Get the latest comment time
 	latestCommentTime, err := s.commentRepo.GetLatestCommentTime(ctx, postID)
 	if err != nil && !errors.Is(err, model.ErrCommentNotFound) {
 		return logger.ErrorWrapper("service", "ArchivePost", "getting latest comment", err)
 	}
 
-	now := time.Now()
-	shouldArchive := false
+	// 10 minutes without comments, 15 minutes since the latest one
+	if !post.IsExpired(latestCommentTime) {
+		s.logger.Debug("post is not eligible for archival yet", slog.String("post_id", string(postID)))
+		return nil
+	}
 
-	if latestCommentTime == nil {
-		// No comments — archive after 10 minutes
-		if post.CreatedAt.Add(10 * time.Minute).Before(now) {
-			shouldArchive = true
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
+		// Archive the post
+		if err := tx.Posts().ArchivePost(ctx, postID); err != nil {
+			s.logger.Error("failed to archive post", slog.Any("error", err))
+			return logger.ErrorWrapper("service", "ArchivePost", "archiving post", err)
 		}
-	} else {
-		// Has comments — archive after 15 minutes since latest
-		if latestCommentTime.Add(15 * time.Minute).Before(now) {
-			shouldArchive = true
+
+		// Archive related comments, a post without comments is fine
+		if err := tx.Comments().ArchiveCommentByPostID(ctx, postID); err != nil && !errors.Is(err, model.ErrCommentNotFound) {
+			s.logger.Error("failed to archive comments", slog.String("post_id", string(postID)), slog.Any("error", err))
+			return logger.ErrorWrapper("service", "ArchivePost", "archiving comments", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if !shouldArchive {
-		s.logger.Debug("post is not eligible for archival yet", slog.String("post_id", string(postID)))
+	s.logger.Info("post and comments are archived successfully", slog.String("post_id", string(postID)))
+	return nil
+}
+
+// SetSticky pins or unpins a thread, for operators
+func (s *PostServiceImpl) SetSticky(ctx context.Context, postID utils.UUID, sticky bool) error {
+	if err := s.repo.SetSticky(ctx, postID, sticky); err != nil {
+		return logger.ErrorWrapper("service", "SetSticky", "updating post", err)
+	}
+	s.logger.Info("thread sticky changed", slog.String("post_id", string(postID)), slog.Bool("sticky", sticky))
+	return nil
+}
+
+// SetLocked freezes or reopens a thread, for operators
+func (s *PostServiceImpl) SetLocked(ctx context.Context, postID utils.UUID, locked bool) error {
+	if err := s.repo.SetLocked(ctx, postID, locked); err != nil {
+		return logger.ErrorWrapper("service", "SetLocked", "updating post", err)
+	}
+	s.logger.Info("thread lock changed", slog.String("post_id", string(postID)), slog.Bool("locked", locked))
+	return nil
+}
+
+// Threads and comments of one session, for the /me page
+func (s *PostServiceImpl) GetSessionActivity(ctx context.Context, sessionID utils.UUID) (*model.SessionActivity, error) {
+	threads, err := s.repo.GetThreadsBySession(ctx, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetSessionActivity", "getting threads", err)
+	}
+
+	comments, err := s.commentRepo.GetCommentsBySession(ctx, sessionID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetSessionActivity", "getting comments", err)
+	}
+	return &model.SessionActivity{Threads: threads, Comments: comments}, nil
+}
+
+// DeletePost lets the author remove the thread, or with imagesOnly just its pictures
+// Files are deleted after the commit, so a failed transaction never leaves posts without their images
+// and the long lived /media/ cache headers stop serving them right away
+func (s *PostServiceImpl) DeletePost(ctx context.Context, postID, sessionID utils.UUID, imagesOnly bool) error {
+	post, err := s.repo.GetPostByID(ctx, postID)
+	if err != nil {
+		return logger.ErrorWrapper("service", "DeletePost", "getting post", err)
+	}
+	if post.SessionID != sessionID {
+		return logger.ErrorWrapper("service", "DeletePost", "checking author", model.ErrNotOwner)
+	}
+
+	var released []model.Image
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
+		if imagesOnly {
+			released, err = tx.Posts().DeletePostImages(ctx, postID)
+		} else {
+			released, err = tx.Posts().DeletePost(ctx, postID)
+		}
+		if err != nil {
+			return logger.ErrorWrapper("service", "DeletePost", "deleting from repo", err)
+		}
 		return nil
+	})
+	if err != nil {
+		return err
 	}
+	releaseImages(ctx, s.uow, s.uploader, released, s.logger)
+
+	s.logger.Info("post deleted by its author", slog.String("post_id", string(postID)), slog.Bool("images_only", imagesOnly))
+	return nil
+}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+// EditPost lets the author fix title, content and images within the edit window
+// The replaced version is kept as a revision, files of images nothing uses anymore are deleted after the commit
+func (s *PostServiceImpl) EditPost(ctx context.Context, postID, sessionID utils.UUID, edit model.Edit, imageData map[string]io.Reader) error {
+	post, err := s.repo.GetPostByID(ctx, postID)
 	if err != nil {
-		s.logger.Error("failed to begin transaction", slog.Any("error", err))
-		return logger.ErrorWrapper("service", "ArchivePost", "starting tx", err)
+		return logger.ErrorWrapper("service", "EditPost", "getting post", err)
 	}
-	// Archive the post
-	if err := s.repo.ArchivePostTx(ctx, tx, postID); err != nil {
-		tx.Rollback()
-		s.logger.Error("failed to archive post", slog.Any("error", err))
-		return logger.ErrorWrapper("service", "ArchivePost", "archiving post", err)
+	if post.SessionID != sessionID {
+		return logger.ErrorWrapper("service", "EditPost", "checking author", model.ErrNotOwner)
+	}
+	if post.IsArchived || !model.CanEdit(post.CreatedAt, s.editWindow) {
+		return logger.ErrorWrapper("service", "EditPost", "checking edit window", model.ErrEditWindowClosed)
+	}
+	// A locked thread is frozen, its opening post included
+	if post.IsLocked {
+		return logger.ErrorWrapper("service", "EditPost", "checking thread", model.ErrThreadLocked)
 	}
 
-	// Archive related comments
-	if err := s.commentRepo.ArchiveCommentByPostIDTx(ctx, tx, postID); err != nil {
-		tx.Rollback()
-		s.logger.Error("failed to archive comments", slog.String("post_id", string(postID)), slog.Any("error", err))
-		return logger.ErrorWrapper("service", "ArchivePost", "archiving comments", err)
+	now := time.Now()
+	post.Title = edit.Title
+	post.Content = edit.Content
+	post.EditedAt = &now
+	if err := post.ValidatePost(); err != nil {
+		return logger.ErrorWrapper("service", "EditPost", "validation", err)
 	}
 
-	// If both comments and post succeed, commit
-	if err := tx.Commit(); err != nil {
-		s.logger.Error("failed to commit transaction", slog.Any("error", err))
-		return logger.ErrorWrapper("service", "ArchivePost", "committing tx", err)
+	board, err := uploadBoard(ctx, s.boards, post.BoardID, imageData)
+	if err != nil {
+		return logger.ErrorWrapper("service", "EditPost", "finding board", err)
 	}
 
-	s.logger.Info("post and comments are archived successfully", slog.String("post_id", string(postID)))
+	replaceImages := edit.ReplaceImages || len(imageData) > 0
+	var uploaded uploads
+	if replaceImages {
+		uploaded, err = uploadImages(imageData, board, s.uploader, s.thumbnailer)
+		if err != nil {
+			releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+			return logger.ErrorWrapper("service", "EditPost", "image uploading", err)
+		}
+		post.Attachments = uploaded.attachments()
+	}
+
+	var released []model.Image
+	err = s.uow.Do(ctx, func(tx port.Tx) error {
+		if err := pinUploads(ctx, tx, s.uploader, uploaded); err != nil {
+			return logger.ErrorWrapper("service", "EditPost", "pinning images", err)
+		}
+		if released, err = tx.Posts().UpdatePost(ctx, post, replaceImages); err != nil {
+			return logger.ErrorWrapper("service", "EditPost", "saving edit", err)
+		}
+		return nil
+	})
+	if err != nil {
+		releaseImages(ctx, s.uow, s.uploader, uploaded.created(), s.logger)
+		return err
+	}
+	releaseImages(ctx, s.uow, s.uploader, released, s.logger)
+
+	s.logger.Info("post edited by its author", slog.String("post_id", string(postID)))
 	return nil
 }
+
+// Edit history of the thread for moderators, the current version is the post itself
+func (s *PostServiceImpl) GetThreadRevisions(ctx context.Context, postID utils.UUID) (*model.ThreadRevisions, error) {
+	post, err := s.repo.GetPostByID(ctx, postID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetThreadRevisions", "getting post", err)
+	}
+
+	posts, err := s.repo.GetPostRevisions(ctx, postID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetThreadRevisions", "getting post revisions", err)
+	}
+
+	comments, err := s.commentRepo.GetCommentRevisions(ctx, postID)
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "GetThreadRevisions", "getting comment revisions", err)
+	}
+	return &model.ThreadRevisions{Post: post, Posts: posts, Comments: comments}, nil
+}
@@ -4,22 +4,29 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCreatePost(t *testing.T) {
 	ctx := context.Background()
 	post := &model.Post{
+		BoardSlug: "b",
 		Title:     "Test",
 		Content:   "Hello world",
 		SessionID: "session123",
 	}
 
 	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
-	svc := NewPostServiceImpl(mockRepo, nil, nil, &MockUploader{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	uow := &MockUnitOfWork{Posts: mockRepo}
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, uow, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
 
 	err := svc.CreatePost(ctx, post, map[string]io.Reader{
 		"image.png": strings.NewReader("fake image data"),
@@ -32,8 +39,45 @@ func TestCreatePost(t *testing.T) {
 	if mockRepo.CreatedPost == nil {
 		t.Errorf("expected CreatePost to store post")
 	}
-	if len(mockRepo.CreatedPost.ImageURLs) == 0 {
-		t.Errorf("expected uploaded image URL, got none")
+	if len(mockRepo.CreatedPost.Attachments) == 0 {
+		t.Errorf("expected uploaded image, got none")
+	}
+	if !mockRepo.CreatedPost.BumpedAt.Equal(mockRepo.CreatedPost.CreatedAt) {
+		t.Errorf("expected a new thread to start bumped at its creation time")
+	}
+}
+
+func TestCreatePost_Thumbnails(t *testing.T) {
+	post := &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
+	uploader := &MockUploader{}
+	uow := &MockUnitOfWork{Posts: mockRepo}
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, uow, uploader, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := svc.CreatePost(context.Background(), post, map[string]io.Reader{
+		"dir/cat.png": strings.NewReader("fake image data"),
+	})
+	if err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+
+	attachments := mockRepo.CreatedPost.Attachments
+	if len(attachments) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(attachments))
+	}
+	if attachments[0].OriginalName != "cat.png" {
+		t.Errorf("expected original name to be kept without directories, got %q", attachments[0].OriginalName)
+	}
+	if attachments[0].ThumbnailKey != attachments[0].Hash+"_thumb.jpg" {
+		t.Errorf("unexpected thumbnail key: %s", attachments[0].ThumbnailKey)
+	}
+
+	images := mockRepo.CreatedPost.Images()
+	if images[0].URL != "/media/"+attachments[0].StorageKey || images[0].ThumbnailURL != "/media/"+attachments[0].ThumbnailKey {
+		t.Errorf("unexpected image links: %+v", images[0])
+	}
+	if len(uploader.Stored) != 1 || uploader.Thumbnails != 1 {
+		t.Errorf("expected original and thumbnail to be uploaded, got %v and %d thumbnails", uploader.Stored, uploader.Thumbnails)
 	}
 }
 
@@ -44,9 +88,9 @@ func TestGetAllPosts(t *testing.T) {
 			postID: {PostID: postID, Title: "Sample", SessionID: "abc", IsArchived: false},
 		},
 	}
-	svc := NewPostServiceImpl(mockRepo, nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	posts, err := svc.GetAllPosts(context.Background(), false)
+	posts, err := svc.GetAllPosts(context.Background(), 0, false)
 	if err != nil {
 		t.Fatalf("GetAllPosts failed: %v", err)
 	}
@@ -62,7 +106,7 @@ func TestGetPostByID(t *testing.T) {
 			postID: {PostID: postID, Title: "Title", SessionID: "sess1"},
 		},
 	}
-	svc := NewPostServiceImpl(mockRepo, nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
 
 	post, err := svc.GetPostByID(context.Background(), postID)
 	if err != nil {
@@ -73,26 +117,465 @@ func TestGetPostByID(t *testing.T) {
 	}
 }
 
-// // Can't test this function because it needs real db connection for tx
-// func TestArchivePost_NoComments_OlderThan10Min(t *testing.T) {
-// 	postID := utils.UUID("archive-post")
-// 	createdAt := time.Now().Add(-11 * time.Minute)
-// 	mockRepo := &MockPostRepo{
-// 		Posts: map[utils.UUID]*model.Post{
-// 			postID: {
-// 				PostID:    postID,
-// 				CreatedAt: createdAt,
-// 			},
-// 		},
-// 	}
-// 	mockComment := &MockCommentRepo{LatestTime: nil}
-// 	svc := NewPostServiceImpl(mockRepo, mockComment, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
-
-// 	err := svc.ArchivePost(context.Background(), postID)
-// 	if err != nil {
-// 		t.Fatalf("ArchivePost failed: %v", err)
-// 	}
-// 	if !mockRepo.Posts[postID].IsArchived {
-// 		t.Errorf("expected post to be archived")
-// 	}
-// }
+func TestCreatePost_RollbackDeletesCreatedUploads(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool // the file was stored before this call
+		linked   bool // another post linked the same content meanwhile
+		deleted  int
+	}{
+		{name: "written by this call", deleted: 2},
+		{name: "already stored", existing: true},
+		{name: "linked by another post", linked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}
+			mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}, CreateErr: model.ErrDatabase}
+			uploader := &MockUploader{Existing: tt.existing}
+			images := &MockImageRepo{Linked: map[string]bool{}}
+			uow := &MockUnitOfWork{Posts: mockRepo, Images: images}
+			svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, uow, uploader, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			hash := fmt.Sprintf("%064x", len("fake image data"))
+			images.Linked[hash] = tt.linked
+
+			err := svc.CreatePost(context.Background(), post, map[string]io.Reader{
+				"cat.png": strings.NewReader("fake image data"),
+			})
+			if !errors.Is(err, model.ErrDatabase) {
+				t.Fatalf("expected ErrDatabase, got %v", err)
+			}
+			if !uow.RolledBack {
+				t.Error("expected the transaction to roll back")
+			}
+
+			// Files another post may share are left alone
+			if len(uploader.Deleted) != tt.deleted {
+				t.Errorf("expected %d deleted files, got %v", tt.deleted, uploader.Deleted)
+			}
+			if tt.deleted > 0 && !slices.Contains(images.Locked, hash) {
+				t.Errorf("expected the image lock before deleting, locked %v", images.Locked)
+			}
+		})
+	}
+}
+
+func TestCreatePost_RestoresReleasedFile(t *testing.T) {
+	post := &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
+	hash := fmt.Sprintf("%064x", len("fake image data"))
+
+	// Deleted by a failed upload of the same picture between our upload and our commit
+	uploader := &MockUploader{Existing: true, Missing: map[string]bool{hash + ".png": true}}
+	images := &MockImageRepo{}
+	uow := &MockUnitOfWork{Posts: mockRepo, Images: images}
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, uow, uploader, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := svc.CreatePost(context.Background(), post, map[string]io.Reader{
+		"cat.png": strings.NewReader("fake image data"),
+	})
+	if err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+
+	if len(uploader.Stored) != 2 || uploader.Thumbnails != 1 {
+		t.Errorf("expected the original to be stored again, stored %v, thumbnails %d", uploader.Stored, uploader.Thumbnails)
+	}
+	if !slices.Contains(images.Locked, hash) {
+		t.Errorf("expected the image to be locked before linking, locked %v", images.Locked)
+	}
+}
+
+func TestArchivePost_NoComments_OlderThan10Min(t *testing.T) {
+	postID := utils.UUID("archive-post")
+	createdAt := time.Now().Add(-11 * time.Minute)
+	mockRepo := &MockPostRepo{
+		Posts: map[utils.UUID]*model.Post{
+			postID: {
+				PostID:    postID,
+				CreatedAt: createdAt,
+			},
+		},
+	}
+	mockComment := &MockCommentRepo{LatestTime: nil}
+	uow := &MockUnitOfWork{Posts: mockRepo, Comments: mockComment}
+	svc := NewPostServiceImpl(mockRepo, mockComment, &MockBoardRepo{}, uow, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := svc.ArchivePost(context.Background(), postID)
+	if err != nil {
+		t.Fatalf("ArchivePost failed: %v", err)
+	}
+	if !mockRepo.Posts[postID].IsArchived {
+		t.Errorf("expected post to be archived")
+	}
+}
+
+func TestArchivePost_Sticky(t *testing.T) {
+	postID := utils.UUID("rules")
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		postID: {PostID: postID, CreatedAt: time.Now().Add(-24 * time.Hour)},
+	}}
+	mockComment := &MockCommentRepo{}
+	uow := &MockUnitOfWork{Posts: mockRepo, Comments: mockComment}
+	svc := NewPostServiceImpl(mockRepo, mockComment, &MockBoardRepo{}, uow, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.SetSticky(context.Background(), postID, true); err != nil {
+		t.Fatalf("SetSticky failed: %v", err)
+	}
+	if err := svc.ArchivePost(context.Background(), postID); err != nil {
+		t.Fatalf("ArchivePost failed: %v", err)
+	}
+	if mockRepo.Posts[postID].IsArchived {
+		t.Error("expected a sticky thread to stay up")
+	}
+
+	if err := svc.SetSticky(context.Background(), postID, false); err != nil {
+		t.Fatalf("SetSticky failed: %v", err)
+	}
+	if err := svc.ArchivePost(context.Background(), postID); err != nil {
+		t.Fatalf("ArchivePost failed: %v", err)
+	}
+	if !mockRepo.Posts[postID].IsArchived {
+		t.Error("expected the unstuck thread to be archived")
+	}
+}
+
+func TestGetSessionActivity(t *testing.T) {
+	now := time.Now()
+	postRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		"mine":   {PostID: "mine", SessionID: "session-abc", Title: "Mine", CreatedAt: now},
+		"theirs": {PostID: "theirs", SessionID: "session-xyz", Title: "Theirs", CreatedAt: now},
+	}}
+	commentRepo := &MockCommentRepo{Activity: []model.CommentActivity{{
+		Comment: &model.Comment{CommentID: "c1", PostID: "theirs"},
+		Thread:  model.ThreadActivity{Post: postRepo.Posts["theirs"], ReplyCount: 1, LastCommentAt: &now},
+	}}}
+	svc := NewPostServiceImpl(postRepo, commentRepo, &MockBoardRepo{}, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	activity, err := svc.GetSessionActivity(context.Background(), "session-abc")
+	if err != nil {
+		t.Fatalf("GetSessionActivity failed: %v", err)
+	}
+	if len(activity.Threads) != 1 || activity.Threads[0].Post.PostID != "mine" {
+		t.Errorf("expected only the session's thread, got %+v", activity.Threads)
+	}
+	if len(activity.Comments) != 1 || activity.Comments[0].Thread.Post.Title != "Theirs" {
+		t.Errorf("expected the comment with its thread, got %+v", activity.Comments)
+	}
+}
+
+func TestThreadActivity_ArchivesIn(t *testing.T) {
+	now := time.Now()
+	lastComment := now.Add(-5 * time.Minute)
+
+	for _, tc := range []struct {
+		name   string
+		thread model.ThreadActivity
+		want   time.Duration
+	}{
+		{"no comments", model.ThreadActivity{Post: &model.Post{CreatedAt: now.Add(-4 * time.Minute)}}, 6 * time.Minute},
+		{"latest comment counts", model.ThreadActivity{Post: &model.Post{CreatedAt: now.Add(-time.Hour)}, LastCommentAt: &lastComment}, 10 * time.Minute},
+		{"overdue", model.ThreadActivity{Post: &model.Post{CreatedAt: now.Add(-time.Hour)}}, 0},
+		{"archived", model.ThreadActivity{Post: &model.Post{CreatedAt: now, IsArchived: true}}, 0},
+		{"board policy", model.ThreadActivity{Post: &model.Post{CreatedAt: now.Add(-4 * time.Minute), Archive: model.ArchivePolicy{Lifetime: time.Hour}}}, 56 * time.Minute},
+	} {
+		if got := tc.thread.ArchivesIn(now); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	ctx := context.Background()
+	repo := &MockPostRepo{
+		Posts: map[utils.UUID]*model.Post{"post123": {
+			PostID:      "post123",
+			SessionID:   "sess-rick",
+			Attachments: []model.Attachment{{Image: model.Image{Hash: "h1", StorageKey: "h1.png", ThumbnailKey: "h1_thumb.jpg"}}},
+		}},
+	}
+	uploader := &MockUploader{}
+	uow := &MockUnitOfWork{Posts: repo}
+	svc := NewPostServiceImpl(repo, &MockCommentRepo{}, &MockBoardRepo{}, uow, uploader, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.DeletePost(ctx, "post123", "sess-morty", false); !errors.Is(err, model.ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner for someone else's post, got %v", err)
+	}
+	if _, ok := repo.Posts["post123"]; !ok || len(uploader.Deleted) != 0 {
+		t.Fatal("expected nothing to be deleted for a stranger")
+	}
+
+	if err := svc.DeletePost(ctx, "post123", "sess-rick", false); err != nil {
+		t.Fatalf("DeletePost failed: %v", err)
+	}
+	if _, ok := repo.Posts["post123"]; ok {
+		t.Error("expected the post to be removed")
+	}
+	// Deleted right away, /media/ responses are cached for a year
+	if !slices.Equal(uploader.Deleted, []string{"h1.png", "h1_thumb.jpg"}) {
+		t.Errorf("expected the image and its thumbnail to be deleted, got %v", uploader.Deleted)
+	}
+}
+
+func TestDeletePost_ImagesOnly(t *testing.T) {
+	repo := &MockPostRepo{
+		Posts: map[utils.UUID]*model.Post{"post123": {
+			PostID:    "post123",
+			SessionID: "sess-rick",
+			Attachments: []model.Attachment{
+				{Image: model.Image{Hash: "mine", StorageKey: "mine.png"}},
+				{Image: model.Image{Hash: "shared", StorageKey: "shared.png"}},
+			},
+		}},
+	}
+	uploader := &MockUploader{}
+
+	// A post written meanwhile linked the same content, its file has to stay
+	images := &MockImageRepo{Linked: map[string]bool{"shared": true}}
+	svc := NewPostServiceImpl(repo, &MockCommentRepo{}, &MockBoardRepo{}, &MockUnitOfWork{Posts: repo, Images: images}, uploader, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.DeletePost(context.Background(), "post123", "sess-rick", true); err != nil {
+		t.Fatalf("DeletePost failed: %v", err)
+	}
+	post, ok := repo.Posts["post123"]
+	if !ok || len(post.Attachments) != 0 {
+		t.Error("expected the post to stay without its images")
+	}
+	if !slices.Equal(uploader.Deleted, []string{"mine.png"}) {
+		t.Errorf("expected only the unshared file to be deleted, got %v", uploader.Deleted)
+	}
+	if !slices.Contains(images.Locked, "shared") {
+		t.Errorf("expected the images to be locked before the check, locked %v", images.Locked)
+	}
+}
+
+func TestEditPost(t *testing.T) {
+	ctx := context.Background()
+	repo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		"fresh":  {PostID: "fresh", SessionID: "sess-rick", Title: "Old", Content: "Old", CreatedAt: time.Now()},
+		"stale":  {PostID: "stale", SessionID: "sess-rick", Title: "Old", Content: "Old", CreatedAt: time.Now().Add(-time.Hour)},
+		"locked": {PostID: "locked", SessionID: "sess-rick", Title: "Old", Content: "Old", CreatedAt: time.Now(), IsLocked: true},
+	}}
+	svc := NewPostServiceImpl(repo, &MockCommentRepo{}, &MockBoardRepo{}, &MockUnitOfWork{Posts: repo}, &MockUploader{}, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	edit := model.Edit{Title: "New", Content: "New"}
+
+	if err := svc.EditPost(ctx, "fresh", "sess-morty", edit, nil); !errors.Is(err, model.ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner for someone else's post, got %v", err)
+	}
+	if err := svc.EditPost(ctx, "stale", "sess-rick", edit, nil); !errors.Is(err, model.ErrEditWindowClosed) {
+		t.Fatalf("expected ErrEditWindowClosed after the window, got %v", err)
+	}
+	if err := svc.EditPost(ctx, "locked", "sess-rick", edit, nil); !errors.Is(err, model.ErrThreadLocked) {
+		t.Fatalf("expected ErrThreadLocked for a locked thread, got %v", err)
+	}
+	if repo.Updated != 0 {
+		t.Fatal("expected nothing to be saved so far")
+	}
+
+	if err := svc.EditPost(ctx, "fresh", "sess-rick", edit, nil); err != nil {
+		t.Fatalf("EditPost failed: %v", err)
+	}
+	post := repo.Posts["fresh"]
+	if post.Title != "New" || post.Content != "New" || post.EditedAt == nil {
+		t.Errorf("expected the edit to be saved with its time, got %+v", post)
+	}
+}
+
+func TestEditPost_ReplaceImages(t *testing.T) {
+	repo := &MockPostRepo{
+		Posts: map[utils.UUID]*model.Post{"post123": {
+			PostID:      "post123",
+			BoardID:     1,
+			SessionID:   "sess-rick",
+			CreatedAt:   time.Now(),
+			Attachments: []model.Attachment{{Image: model.Image{Hash: "old", StorageKey: "old.png"}}},
+		}},
+	}
+	uploader := &MockUploader{}
+	svc := NewPostServiceImpl(repo, &MockCommentRepo{}, &MockBoardRepo{}, &MockUnitOfWork{Posts: repo}, uploader, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	images := map[string]io.Reader{"new.png": strings.NewReader("new")}
+	if err := svc.EditPost(context.Background(), "post123", "sess-rick", model.Edit{Title: "Title", Content: "Content"}, images); err != nil {
+		t.Fatalf("EditPost failed: %v", err)
+	}
+	if len(repo.Posts["post123"].Attachments) != 1 {
+		t.Error("expected the upload to replace the images")
+	}
+	if !slices.Equal(uploader.Deleted, []string{"old.png"}) {
+		t.Errorf("expected the replaced file to be deleted after the commit, got %v", uploader.Deleted)
+	}
+}
+
+func TestCreatePost_Board(t *testing.T) {
+	boards := &MockBoardRepo{Boards: []model.Board{
+		{BoardID: 1, Slug: "b", Archive: model.ArchivePolicy{Lifetime: time.Hour}},
+		{BoardID: 2, Slug: "g", AllowedTypes: []string{"image/jpeg"}},
+	}}
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
+	uploader := &MockUploader{}
+	uow := &MockUnitOfWork{Posts: mockRepo}
+	svc := NewPostServiceImpl(mockRepo, nil, boards, uow, uploader, &MockThumbnailer{}, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, slug := range []string{"", "x", "../b"} {
+		post := &model.Post{BoardSlug: slug, Title: "Test", SessionID: "session123"}
+		if err := svc.CreatePost(context.Background(), post, nil); !errors.Is(err, model.ErrBoardNotFound) {
+			t.Errorf("board %q: expected ErrBoardNotFound, got %v", slug, err)
+		}
+	}
+
+	post := &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}
+	if err := svc.CreatePost(context.Background(), post, nil); err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+	if post.BoardID != 1 || post.Archive.Lifetime != time.Hour {
+		t.Errorf("expected the post to carry its board, got %d %+v", post.BoardID, post.Archive)
+	}
+
+	// The mock uploader stores PNGs only, /g/ takes JPEGs
+	post = &model.Post{BoardSlug: "g", Title: "Test", SessionID: "session123"}
+	err := svc.CreatePost(context.Background(), post, map[string]io.Reader{"cat.png": strings.NewReader("fake image data")})
+	if !errors.Is(err, model.ErrImageTypeNotAllowed) {
+		t.Fatalf("expected ErrImageTypeNotAllowed, got %v", err)
+	}
+	if len(uploader.Stored) != 0 {
+		t.Errorf("expected the rejected upload not to be stored, got %v", uploader.Stored)
+	}
+}
+
+func TestGetAllPosts_Board(t *testing.T) {
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		"p1": {PostID: "p1", BoardID: 1},
+		"p2": {PostID: "p2", BoardID: 2},
+	}}
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	posts, err := svc.GetAllPosts(context.Background(), 2, false)
+	if err != nil {
+		t.Fatalf("GetAllPosts failed: %v", err)
+	}
+	if len(posts) != 1 || posts[0].PostID != "p2" {
+		t.Errorf("expected only the board's posts, got %+v", posts)
+	}
+}
+
+func TestCreatePost_MaxThreads(t *testing.T) {
+	now := time.Now()
+	boards := &MockBoardRepo{Boards: []model.Board{{BoardID: 1, Slug: "b", MaxThreads: 2}}}
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{
+		"rules": {PostID: "rules", BoardID: 1, IsSticky: true, BumpedAt: now.Add(-time.Hour)},
+		"old":   {PostID: "old", BoardID: 1, BumpedAt: now.Add(-2 * time.Minute)},
+		"new":   {PostID: "new", BoardID: 1, BumpedAt: now.Add(-time.Minute)},
+		"other": {PostID: "other", BoardID: 2, BumpedAt: now.Add(-time.Hour)},
+	}}
+	mockComment := &MockCommentRepo{}
+	uow := &MockUnitOfWork{Posts: mockRepo, Comments: mockComment}
+	svc := NewPostServiceImpl(mockRepo, mockComment, boards, uow, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	post := &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}
+	if err := svc.CreatePost(context.Background(), post, nil); err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+	if !mockRepo.Posts["old"].IsArchived {
+		t.Error("expected the least recently bumped thread to be archived")
+	}
+	for _, id := range []utils.UUID{"rules", "new", "other", post.PostID} {
+		if mockRepo.Posts[id].IsArchived {
+			t.Errorf("expected %s to stay active", id)
+		}
+	}
+}
+
+func TestCreatePost_MaxThreadsConcurrent(t *testing.T) {
+	const maxThreads, writers = 3, 20
+	boards := &MockBoardRepo{Boards: []model.Board{{BoardID: 1, Slug: "b", MaxThreads: maxThreads}}}
+	uow := &MockLockingUnitOfWork{Posts: map[utils.UUID]*model.Post{}}
+	svc := NewPostServiceImpl(nil, nil, boards, uow, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.CreatePost(context.Background(), &model.Post{BoardSlug: "b", Title: "Test", SessionID: "session123"}, nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("CreatePost failed: %v", err)
+		}
+	}
+
+	// Each writer counted the threads committed before it, none slipped past the limit
+	active := 0
+	for _, p := range uow.Posts {
+		if !p.IsArchived {
+			active++
+		}
+	}
+	if len(uow.Posts) != writers || active != maxThreads {
+		t.Errorf("expected %d threads with %d active, got %d with %d active", writers, maxThreads, len(uow.Posts), active)
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	now := time.Now()
+	mockRepo := &MockPostRepo{Posts: map[utils.UUID]*model.Post{}}
+	var want []utils.UUID // display order
+	for i := range 7 {
+		id, _ := utils.GenerateUUID()
+		mockRepo.Posts[id] = &model.Post{PostID: id, BoardID: 1, IsSticky: i == 0, BumpedAt: now.Add(-time.Duration(i) * time.Minute)}
+		want = append(want, id)
+	}
+	mockRepo.Posts["other"] = &model.Post{PostID: "other", BoardID: 2, BumpedAt: now}
+	svc := NewPostServiceImpl(mockRepo, nil, &MockBoardRepo{}, nil, nil, nil, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	// Forward through every page
+	var got []utils.UUID
+	var pages []*model.PostPage
+	req := model.PageRequest{Limit: 3}
+	for {
+		page, err := svc.ListPosts(ctx, 1, false, req)
+		if err != nil {
+			t.Fatalf("ListPosts failed: %v", err)
+		}
+		pages = append(pages, page)
+		for _, p := range page.Posts {
+			got = append(got, p.PostID)
+		}
+		if page.Next == "" {
+			break
+		}
+		req = model.PageRequest{After: page.Next, Limit: 3}
+	}
+	if len(pages) != 3 || pages[0].Prev != "" {
+		t.Fatalf("expected 3 pages starting at the top, got %d", len(pages))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the sticky thread first, then by bump time, got %v", got)
+	}
+
+	// And back from the last one
+	page, err := svc.ListPosts(ctx, 1, false, model.PageRequest{Before: pages[2].Prev, Limit: 3})
+	if err != nil {
+		t.Fatalf("ListPosts failed: %v", err)
+	}
+	if len(page.Posts) != 3 || page.Posts[0].PostID != want[3] || page.Next != pages[1].Next || page.Prev == "" {
+		t.Errorf("expected the middle page again, got %+v", page)
+	}
+
+	for _, req := range []model.PageRequest{
+		{After: "not-a-cursor"},
+		{After: model.Cursor{PostID: "'; DROP TABLE posts;--"}.Encode()},
+		{After: pages[0].Next, Before: pages[1].Prev},
+	} {
+		if _, err := svc.ListPosts(ctx, 1, false, req); !errors.Is(err, model.ErrInvalidCursor) {
+			t.Errorf("%+v: expected ErrInvalidCursor, got %v", req, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Crockford base32, no I, L, O or U so codes survive being read aloud or written down
+const recoveryAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	recoveryGroups    = 5
+	recoveryGroupSize = 4 // 20 characters, 100 bits
+)
+
+// newRecoveryCode looks like "7K2D-QX9M-..."
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, recoveryGroups*recoveryGroupSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, r := range raw {
+		if i > 0 && i%recoveryGroupSize == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(recoveryAlphabet[r&31])
+	}
+	return b.String(), nil
+}
+
+// Typed codes may have lower case, spaces, missing dashes or the look-alike letters
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "", "I", "1", "L", "1", "O", "0").Replace(code)
+	return code
+}
+
+// Codes carry 100 random bits, a fast hash is enough
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"1337b04rd/pkg/ratelimit"
+	"1337b04rd/pkg/utils"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRecoveryTestService(limit int) (*SessionServiceImpl, *MockSessionRepo) {
+	repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{
+		"session-abc": {SessionID: "session-abc", DisplayName: "Rick", ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, ratelimit.NewLimiter(limit, time.Minute),
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return svc, repo
+}
+
+func TestRecoveryCode_RoundTrip(t *testing.T) {
+	svc, repo := newRecoveryTestService(5)
+	ctx := context.Background()
+
+	code, err := svc.IssueRecoveryCode(ctx, "session-abc")
+	if err != nil {
+		t.Fatalf("IssueRecoveryCode failed: %v", err)
+	}
+	if !regexp.MustCompile(`^([0-9A-Z]{4}-){4}[0-9A-Z]{4}$`).MatchString(code) {
+		t.Errorf("unexpected code format %q", code)
+	}
+	for hash := range repo.Codes {
+		if strings.Contains(hash, code) || len(hash) != 64 {
+			t.Errorf("expected only a SHA-256 hash to be stored, got %q", hash)
+		}
+	}
+
+	// Typed by hand on another device
+	typed := strings.ToLower(strings.ReplaceAll(code, "-", " "))
+	session, err := svc.RedeemRecoveryCode(ctx, typed, "1.2.3.4")
+	if err != nil {
+		t.Fatalf("RedeemRecoveryCode failed: %v", err)
+	}
+	if session.SessionID != "session-abc" || session.DisplayName != "Rick" {
+		t.Errorf("unexpected session %+v", session)
+	}
+
+	// One-time
+	if _, err := svc.RedeemRecoveryCode(ctx, code, "1.2.3.4"); !errors.Is(err, model.ErrInvalidRecovery) {
+		t.Errorf("expected used code to be rejected, got %v", err)
+	}
+}
+
+func TestRecoveryCode_ReissueAndRevoke(t *testing.T) {
+	svc, _ := newRecoveryTestService(5)
+	ctx := context.Background()
+
+	first, _ := svc.IssueRecoveryCode(ctx, "session-abc")
+	second, _ := svc.IssueRecoveryCode(ctx, "session-abc")
+	if _, err := svc.RedeemRecoveryCode(ctx, first, "1.2.3.4"); !errors.Is(err, model.ErrInvalidRecovery) {
+		t.Errorf("expected a new code to replace the old one, got %v", err)
+	}
+
+	if err := svc.RevokeRecoveryCodes(ctx, "session-abc"); err != nil {
+		t.Fatalf("RevokeRecoveryCodes failed: %v", err)
+	}
+	if _, err := svc.RedeemRecoveryCode(ctx, second, "1.2.3.4"); !errors.Is(err, model.ErrInvalidRecovery) {
+		t.Errorf("expected revoked code to be rejected, got %v", err)
+	}
+}
+
+func TestRecoveryCode_ExpiredSession(t *testing.T) {
+	svc, repo := newRecoveryTestService(5)
+	ctx := context.Background()
+
+	code, _ := svc.IssueRecoveryCode(ctx, "session-abc")
+	delete(repo.Sessions, "session-abc")
+
+	if _, err := svc.RedeemRecoveryCode(ctx, code, "1.2.3.4"); !errors.Is(err, model.ErrInvalidRecovery) {
+		t.Errorf("expected ErrInvalidRecovery, got %v", err)
+	}
+}
+
+func TestRecoveryCode_RateLimited(t *testing.T) {
+	svc, _ := newRecoveryTestService(2)
+	ctx := context.Background()
+	code, _ := svc.IssueRecoveryCode(ctx, "session-abc")
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.RedeemRecoveryCode(ctx, "WRONG-CODE", "1.2.3.4"); !errors.Is(err, model.ErrInvalidRecovery) {
+			t.Fatalf("attempt %d: expected ErrInvalidRecovery, got %v", i, err)
+		}
+	}
+
+	// Even the right code is refused once the budget is spent
+	if _, err := svc.RedeemRecoveryCode(ctx, code, "1.2.3.4"); !errors.Is(err, model.ErrTooManyAttempts) {
+		t.Errorf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if _, err := svc.RedeemRecoveryCode(ctx, code, "5.6.7.8"); err != nil {
+		t.Errorf("expected other clients to be unaffected, got %v", err)
+	}
+}
@@ -5,29 +5,32 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/internal/domain/port"
 	"1337b04rd/pkg/logger"
+	"1337b04rd/pkg/ratelimit"
 	"1337b04rd/pkg/utils"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"log/slog"
-	"math/rand"
-	"net/http"
 	"time"
 )
 
 type SessionServiceImpl struct {
 	sessionRepo port.SessionRepo
-	postRepo    port.PostRepo
-	commentRepo port.CommentRepo
+	avatars     port.AvatarProvider
+	avatarPool  int // number of distinct avatars handed out before they repeat
+	lifetime    time.Duration
+	sliding     bool
+	redeems     *ratelimit.Limiter // recovery code attempts per client
 	logger      *slog.Logger
 }
 
-func NewSessionServiceImpl(sessionRepo port.SessionRepo, postRepo port.PostRepo, commentRepo port.CommentRepo, logger *slog.Logger) *SessionServiceImpl {
+func NewSessionServiceImpl(sessionRepo port.SessionRepo, avatars port.AvatarProvider, avatarPool int, lifetime time.Duration, sliding bool, redeems *ratelimit.Limiter, logger *slog.Logger) *SessionServiceImpl {
 	return &SessionServiceImpl{
 		sessionRepo: sessionRepo,
-		postRepo:    postRepo,
-		commentRepo: commentRepo,
+		avatars:     avatars,
+		avatarPool:  avatarPool,
+		lifetime:    lifetime,
+		sliding:     sliding,
+		redeems:     redeems,
 		logger:      logger}
 }
 
@@ -43,22 +46,28 @@ func (s *SessionServiceImpl) CreateSession(ctx context.Context, session *model.S
 	}
 	session.SessionID = UUID
 
-	// Get avatar URL
-	avatarURL, err := s.fetchRandomAvatar(ctx)
-	if err != nil {
-		s.logger.Error("failed to fetch random avatar", slog.Any("error", err))
-		return logger.ErrorWrapper("service", "CreateSession", "fetching random avatar", err)
+	session.CreatedAt = time.Now()
+	session.ExpiresAt = session.CreatedAt.Add(s.lifetime)
+
+	// Least used avatar first, the provider may go to the network with it
+	if s.avatarPool > 0 {
+		if session.AvatarID, err = s.sessionRepo.AllocateAvatar(ctx, s.avatarPool); err != nil {
+			return logger.ErrorWrapper("service", "CreateSession", "allocating avatar", err)
+		}
 	}
 
-	session.AvatarURL = avatarURL
-	session.CreatedAt = time.Now()
-	session.ExpiresAt = session.CreatedAt.Add(7 * 24 * time.Hour)
+	// The provider chain falls back to a generated one
+	session.AvatarURL, err = s.avatars.AvatarURL(ctx, session.SessionID, session.AvatarID)
+	if err != nil {
+		s.logger.Error("failed to pick avatar", slog.Any("error", err))
+		return logger.ErrorWrapper("service", "CreateSession", "picking avatar", err)
+	}
 
-	// Save session info in db
+	// Written once, with the avatar already in place
 	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
 		return logger.ErrorWrapper("service", "CreateSession", "saving session to db", err)
 	}
-	s.logger.Info("session created", slog.String("session_id", string(session.SessionID)))
+	s.logger.Info("session created", slog.String("session_id", string(session.SessionID)), slog.Int("avatar_id", session.AvatarID))
 	return nil
 }
 
@@ -72,61 +81,112 @@ func (s *SessionServiceImpl) GetSessionByID(ctx context.Context, id utils.UUID)
 	return session, nil
 }
 
-// DeleteExpiredSessions cleans up all expired sessions
+// Sessions are extended only in the second half of their lifetime
+// so an active visitor costs one write per half lifetime, not one per request
+func (s *SessionServiceImpl) RenewSession(ctx context.Context, session *model.Session) (bool, error) {
+	now := time.Now()
+	if !s.sliding || session.ExpiresAt.Sub(now) > s.lifetime/2 {
+		return false, nil
+	}
+
+	expiresAt := now.Add(s.lifetime)
+	if err := s.sessionRepo.ExtendSession(ctx, session.SessionID, expiresAt); err != nil {
+		return false, logger.ErrorWrapper("service", "RenewSession", "extending session", err)
+	}
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// DeleteExpiredSessions cleans up expired sessions and gives their avatars back to the pool
+// Sessions that posted are kept, the recount does not depend on the delete
 func (s *SessionServiceImpl) DeleteExpiredSessions(ctx context.Context) error {
-	if err := s.sessionRepo.DeleteExpiredSession(ctx); err != nil {
-		return logger.ErrorWrapper("service", "DeleteExpiredSessions", "deleting expired sessions", err)
+	deleteErr := s.sessionRepo.DeleteExpiredSession(ctx)
+	if err := s.sessionRepo.RecountAvatars(ctx); err != nil {
+		return logger.ErrorWrapper("service", "DeleteExpiredSessions", "recounting avatars", err)
+	}
+	if deleteErr != nil {
+		return logger.ErrorWrapper("service", "DeleteExpiredSessions", "deleting expired sessions", deleteErr)
 	}
 	s.logger.Info("expired sessions deleted successfully")
 	return nil
 }
 
-func (s *SessionServiceImpl) OverrideUserName(ctx context.Context, sessionID utils.UUID, newName string) error {
-	// Update posts
-	if err := s.postRepo.UpdateUserNameForSession(ctx, sessionID, newName); err != nil {
-		return logger.ErrorWrapper("service", "OverrideUserName", "updating post usernames", err)
+// Changes the name shown on the session's posts and comments
+// Only the session row changes, posts pick the name up when they are rendered
+func (s *SessionServiceImpl) SetDisplayName(ctx context.Context, sessionID utils.UUID, name string) error {
+	name, err := model.NormalizeDisplayName(name)
+	if err != nil {
+		return logger.ErrorWrapper("service", "SetDisplayName", "validating name", err)
 	}
 
-	// Update comments
-	if err := s.commentRepo.UpdateUserNameForSession(ctx, sessionID, newName); err != nil {
-		return logger.ErrorWrapper("service", "OverrideUserName", "updating comment usernames", err)
+	if err := s.sessionRepo.SetDisplayName(ctx, sessionID, name, time.Now()); err != nil {
+		return logger.ErrorWrapper("service", "SetDisplayName", "saving name", err)
 	}
-	s.logger.Info("user name updated successfully for session", slog.String("session_id", string(sessionID)), slog.String("new_name", newName))
+	s.logger.Info("display name updated", slog.String("session_id", string(sessionID)), slog.String("name", name))
 	return nil
 }
 
-func (s *SessionServiceImpl) fetchRandomAvatar(ctx context.Context) (string, error) {
-	rand.Seed(time.Now().UnixNano())
-	randomID := rand.Intn(826) + 1
+// Keeps the session and everything it wrote, only the ID changes
+func (s *SessionServiceImpl) RotateSessionID(ctx context.Context, sessionID utils.UUID) (*model.Session, error) {
+	newID, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, logger.ErrorWrapper("service", "RotateSessionID", "generating session UUID", err)
+	}
+
+	if err := s.sessionRepo.RotateSessionID(ctx, sessionID, newID); err != nil {
+		return nil, logger.ErrorWrapper("service", "RotateSessionID", "renaming session", err)
+	}
 
-	url := fmt.Sprintf("https://rickandmortyapi.com/api/character/%d", randomID)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	session, err := s.sessionRepo.GetSessionByID(ctx, newID)
 	if err != nil {
-		return "", fmt.Errorf("building avatar request: %w", err)
+		return nil, logger.ErrorWrapper("service", "RotateSessionID", "retrieving session", err)
 	}
+	s.logger.Info("session ID rotated", slog.String("session_id", string(newID)))
+	return session, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// Gives a visitor a way back to the session from another browser
+func (s *SessionServiceImpl) IssueRecoveryCode(ctx context.Context, sessionID utils.UUID) (string, error) {
+	code, err := newRecoveryCode()
 	if err != nil {
-		return "", fmt.Errorf("fetching avatar: %w", err)
+		return "", logger.ErrorWrapper("service", "IssueRecoveryCode", "generating code", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status from Rick and Morty API: %d", resp.StatusCode)
+	if err := s.sessionRepo.ReplaceRecoveryCode(ctx, sessionID, hashRecoveryCode(code), time.Now()); err != nil {
+		return "", logger.ErrorWrapper("service", "IssueRecoveryCode", "saving code", err)
 	}
+	s.logger.Info("recovery code issued", slog.String("session_id", string(sessionID)))
+	return code, nil
+}
 
-	var data struct {
-		Image string `json:"image"`
+// Each code works once, the browser that redeems it joins the session
+func (s *SessionServiceImpl) RedeemRecoveryCode(ctx context.Context, code, client string) (*model.Session, error) {
+	if !s.redeems.Allow(client) {
+		s.logger.Warn("recovery attempts rate limited", slog.String("client", client))
+		return nil, model.ErrTooManyAttempts
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	sessionID, err := s.sessionRepo.ConsumeRecoveryCode(ctx, hashRecoveryCode(code))
 	if err != nil {
-		return "", fmt.Errorf("reading avatar response: %w", err)
+		return nil, logger.ErrorWrapper("service", "RedeemRecoveryCode", "consuming code", err)
 	}
 
-	if err := json.Unmarshal(body, &data); err != nil {
-		return "", fmt.Errorf("decoding avatar JSON: %w", err)
+	// Session may have expired since the code was issued
+	session, err := s.sessionRepo.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			return nil, model.ErrInvalidRecovery
+		}
+		return nil, logger.ErrorWrapper("service", "RedeemRecoveryCode", "retrieving session", err)
 	}
+	s.logger.Info("recovery code redeemed", slog.String("session_id", string(sessionID)))
+	return session, nil
+}
 
-	return data.Image, nil
+func (s *SessionServiceImpl) RevokeRecoveryCodes(ctx context.Context, sessionID utils.UUID) error {
+	if err := s.sessionRepo.DeleteRecoveryCodes(ctx, sessionID); err != nil {
+		return logger.ErrorWrapper("service", "RevokeRecoveryCodes", "deleting codes", err)
+	}
+	s.logger.Info("recovery codes revoked", slog.String("session_id", string(sessionID)))
+	return nil
 }
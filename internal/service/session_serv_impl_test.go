@@ -5,29 +5,20 @@ import (
 	"1337b04rd/internal/domain/model"
 	"1337b04rd/pkg/utils"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"strings"
 	"testing"
 	"time"
 )
 
-type sessionServiceWithMockAvatar struct {
-	*SessionServiceImpl
-	MockAvatarURL string
-}
-
-func (s *sessionServiceWithMockAvatar) fetchRandomAvatar(ctx context.Context) (string, error) {
-	return s.MockAvatarURL, nil
-}
-
 func TestCreateSession(t *testing.T) {
 	repo := &MockSessionRepo{Sessions: make(map[utils.UUID]*model.Session)}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	service := &sessionServiceWithMockAvatar{
-		SessionServiceImpl: NewSessionServiceImpl(repo, nil, nil, logger),
-		MockAvatarURL:      "https://rickandmortyapi.com/api/character/avatar/1.jpeg",
-	}
+	avatars := &MockAvatarProvider{URL: "https://rickandmortyapi.com/api/character/avatar/1.jpeg"}
+	service := NewSessionServiceImpl(repo, avatars, 826, 7*24*time.Hour, false, nil, logger)
 
 	sess := &model.Session{}
 	err := service.CreateSession(context.Background(), sess)
@@ -37,8 +28,11 @@ func TestCreateSession(t *testing.T) {
 	if repo.Saved == nil {
 		t.Error("expected session to be saved")
 	}
-	if sess.AvatarURL == "" {
-		t.Error("expected avatar to be assigned")
+	if sess.AvatarURL != avatars.URL {
+		t.Errorf("expected avatar from provider, got %q", sess.AvatarURL)
+	}
+	if avatars.SessionID != sess.SessionID {
+		t.Error("expected provider to get the new session ID")
 	}
 	if sess.SessionID == "" {
 		t.Error("expected session ID to be generated")
@@ -48,12 +42,59 @@ func TestCreateSession(t *testing.T) {
 	}
 }
 
+func TestCreateSession_UniqueAvatars(t *testing.T) {
+	repo := &MockSessionRepo{Sessions: make(map[utils.UUID]*model.Session)}
+	avatars := &MockAvatarProvider{URL: "https://example.com/avatar.jpeg"}
+	svc := NewSessionServiceImpl(repo, avatars, 3, 7*24*time.Hour, false, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	seen := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		sess := &model.Session{}
+		if err := svc.CreateSession(context.Background(), sess); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+		if seen[sess.AvatarID] {
+			t.Errorf("avatar %d handed out twice before the pool ran out", sess.AvatarID)
+		}
+		seen[sess.AvatarID] = true
+	}
+
+	// Pool of 3 is exhausted, the next session reuses one instead of failing
+	sess := &model.Session{}
+	if err := svc.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("CreateSession with exhausted pool failed: %v", err)
+	}
+	if !seen[sess.AvatarID] {
+		t.Errorf("expected a reused avatar from the pool, got %d", sess.AvatarID)
+	}
+	if len(avatars.AvatarIDs) != 4 || avatars.AvatarIDs[3] != sess.AvatarID {
+		t.Errorf("expected provider to get allocated IDs, got %v", avatars.AvatarIDs)
+	}
+	if repo.Sessions[sess.SessionID].AvatarURL != avatars.URL {
+		t.Error("expected avatar URL to be saved")
+	}
+}
+
+func TestCreateSession_AvatarFailure(t *testing.T) {
+	repo := &MockSessionRepo{Sessions: make(map[utils.UUID]*model.Session)}
+	avatars := &MockAvatarProvider{Err: errors.New("avatar API is down")}
+	svc := NewSessionServiceImpl(repo, avatars, 3, 7*24*time.Hour, false, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := svc.CreateSession(context.Background(), &model.Session{}); err == nil {
+		t.Fatal("expected the provider error")
+	}
+	// No session row without an avatar URL
+	if repo.Saved != nil || len(repo.Sessions) != 0 {
+		t.Errorf("expected no session to be saved, got %+v", repo.Saved)
+	}
+}
+
 func TestGetSessionByID(t *testing.T) {
 	id := utils.UUID("sess123")
 	session := &model.Session{SessionID: id, AvatarURL: "https://example.com/avatar.jpg"}
 	repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{id: session}}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := NewSessionServiceImpl(repo, nil, nil, logger)
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, logger)
 
 	got, err := svc.GetSessionByID(context.Background(), id)
 	if err != nil {
@@ -67,7 +108,7 @@ func TestGetSessionByID(t *testing.T) {
 func TestDeleteExpiredSessions(t *testing.T) {
 	repo := &MockSessionRepo{Sessions: make(map[utils.UUID]*model.Session)}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := NewSessionServiceImpl(repo, nil, nil, logger)
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, logger)
 
 	err := svc.DeleteExpiredSessions(context.Background())
 	if err != nil {
@@ -78,17 +119,157 @@ func TestDeleteExpiredSessions(t *testing.T) {
 	}
 }
 
-func TestOverrideUserName(t *testing.T) {
-	postRepo := &MockPostRepo{}
-	commentRepo := &MockCommentRepo{}
+func TestDeleteExpiredSessions_AuthorFreesAvatar(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	repo := &MockSessionRepo{
+		Sessions: map[utils.UUID]*model.Session{
+			"poster":  {SessionID: "poster", AvatarID: 1, ExpiresAt: past},
+			"lurker":  {SessionID: "lurker", AvatarID: 2, ExpiresAt: past},
+			"current": {SessionID: "current", AvatarID: 3, ExpiresAt: time.Now().Add(time.Hour)},
+		},
+		Authors: map[utils.UUID]bool{"poster": true},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, logger)
+
+	if err := svc.DeleteExpiredSessions(context.Background()); err != nil {
+		t.Fatalf("DeleteExpiredSessions failed: %v", err)
+	}
+
+	// The poster's row stays for its posts, its avatar is free all the same
+	if _, ok := repo.Sessions["poster"]; !ok {
+		t.Error("expected the session with a post to be kept")
+	}
+	if _, ok := repo.Sessions["lurker"]; ok {
+		t.Error("expected the session without posts to be deleted")
+	}
+	if repo.Avatars[1] != 0 || repo.Avatars[3] != 1 {
+		t.Errorf("expected only avatar 3 in use, got %v", repo.Avatars)
+	}
+}
+
+func TestDeleteExpiredSessions_RecountsWhenDeleteFails(t *testing.T) {
+	repo := &MockSessionRepo{
+		Sessions: map[utils.UUID]*model.Session{
+			"old": {SessionID: "old", AvatarID: 1, ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+		DeleteErr: model.ErrDatabase,
+	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := NewSessionServiceImpl(nil, postRepo, commentRepo, logger)
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, logger)
 
-	err := svc.OverrideUserName(context.Background(), "session-abc", "Rick")
+	err := svc.DeleteExpiredSessions(context.Background())
+	if !errors.Is(err, model.ErrDatabase) {
+		t.Fatalf("expected ErrDatabase, got %v", err)
+	}
+	if repo.Avatars == nil || repo.Avatars[1] != 0 {
+		t.Errorf("expected the avatars to be recounted anyway, got %v", repo.Avatars)
+	}
+}
+
+func TestSetDisplayName(t *testing.T) {
+	// Session without any posts, the name still sticks to it
+	repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{
+		"session-abc": {SessionID: "session-abc"},
+	}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, logger)
+
+	if err := svc.SetDisplayName(context.Background(), "session-abc", "  Rick  "); err != nil {
+		t.Fatalf("SetDisplayName failed: %v", err)
+	}
+	if name := repo.Sessions["session-abc"].DisplayName; name != "Rick" {
+		t.Errorf("expected trimmed name Rick, got %q", name)
+	}
+	if repo.NamedAt.IsZero() {
+		t.Error("expected the change to be timestamped")
+	}
+}
+
+func TestSetDisplayName_Invalid(t *testing.T) {
+	repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{
+		"session-abc": {SessionID: "session-abc", DisplayName: "Rick"},
+	}}
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, name := range []string{"   ", strings.Repeat("x", model.MaxDisplayNameLength+1), "Rick\nMorty"} {
+		err := svc.SetDisplayName(context.Background(), "session-abc", name)
+		if !errors.Is(err, model.ErrInvalidDisplayName) {
+			t.Errorf("%q: expected ErrInvalidDisplayName, got %v", name, err)
+		}
+	}
+	if name := repo.Sessions["session-abc"].DisplayName; name != "Rick" {
+		t.Errorf("expected name to stay Rick, got %q", name)
+	}
+}
+
+func TestRotateSessionID(t *testing.T) {
+	repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{
+		"session-abc": {SessionID: "session-abc", DisplayName: "Rick"},
+	}}
+	svc := NewSessionServiceImpl(repo, nil, 0, 7*24*time.Hour, false, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rotated, err := svc.RotateSessionID(context.Background(), "session-abc")
 	if err != nil {
-		t.Fatalf("OverrideUserName failed: %v", err)
+		t.Fatalf("RotateSessionID failed: %v", err)
+	}
+	if rotated.SessionID == "session-abc" || rotated.SessionID == "" {
+		t.Errorf("expected a fresh session ID, got %q", rotated.SessionID)
+	}
+	if rotated.DisplayName != "Rick" {
+		t.Errorf("expected the session to keep its name, got %q", rotated.DisplayName)
 	}
-	if !postRepo.UpdatedName || !commentRepo.UpdatedName {
-		t.Error("expected user names to be updated in both post and comment repos")
+	if _, err := svc.GetSessionByID(context.Background(), "session-abc"); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Errorf("expected old ID to stop working, got %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestCreateSession_UsesLifetime(t *testing.T) {
+	repo := &MockSessionRepo{Sessions: make(map[utils.UUID]*model.Session)}
+	avatars := &MockAvatarProvider{URL: "https://example.com/avatar.jpg"}
+	svc := NewSessionServiceImpl(repo, avatars, 1, 3*24*time.Hour, false, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sess := &model.Session{}
+	if err := svc.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if got := sess.ExpiresAt.Sub(sess.CreatedAt); got != 3*24*time.Hour {
+		t.Errorf("expected a 3 day session, got %v", got)
+	}
+}
+
+func TestRenewSession(t *testing.T) {
+	const lifetime = 7 * 24 * time.Hour
+	for _, tc := range []struct {
+		name    string
+		sliding bool
+		left    time.Duration
+		renewed bool
+	}{
+		{"fresh session is not written", true, 6 * 24 * time.Hour, false},
+		{"close to expiry is extended", true, 2 * 24 * time.Hour, true},
+		{"sliding disabled", false, time.Hour, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			session := &model.Session{SessionID: "sess123", ExpiresAt: time.Now().Add(tc.left)}
+			repo := &MockSessionRepo{Sessions: map[utils.UUID]*model.Session{"sess123": session}}
+			svc := NewSessionServiceImpl(repo, nil, 0, lifetime, tc.sliding, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			renewed, err := svc.RenewSession(context.Background(), session)
+			if err != nil {
+				t.Fatalf("RenewSession failed: %v", err)
+			}
+			if renewed != tc.renewed || (repo.Extended == 1) != tc.renewed {
+				t.Fatalf("expected renewed=%v, got %v with %d writes", tc.renewed, renewed, repo.Extended)
+			}
+			if tc.renewed && time.Until(session.ExpiresAt) < lifetime-time.Minute {
+				t.Errorf("expected expiry a full lifetime away, got %v", time.Until(session.ExpiresAt))
+			}
+
+			// Right after a renewal the next request is a read only
+			if renewed, _ := svc.RenewSession(context.Background(), session); renewed {
+				t.Error("expected renewals to be throttled")
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Characters of the hash shown after the prefix
+const tripcodeLength = 10
+
+type Tripcoder struct {
+	pepper []byte // server secret, keys secure tripcodes
+}
+
+func NewTripcoder(pepper []byte) *Tripcoder {
+	return &Tripcoder{pepper: pepper}
+}
+
+// Regular tripcodes are a plain hash, the same secret gives the same code on any board
+// Secure tripcodes are keyed with the pepper, so they can't be brute forced offline
+func (t *Tripcoder) Tripcode(secret string, secure bool) string {
+	if secret == "" {
+		return ""
+	}
+	if secure {
+		mac := hmac.New(sha256.New, t.pepper)
+		mac.Write([]byte(secret))
+		return model.SecureTripcodePrefix + encodeTripcode(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte("tripcode:" + secret))
+	return model.TripcodePrefix + encodeTripcode(sum[:])
+}
+
+func encodeTripcode(sum []byte) string {
+	return base64.RawURLEncoding.EncodeToString(sum)[:tripcodeLength]
+}
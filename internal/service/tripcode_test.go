@@ -0,0 +1,62 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/model"
+	"strings"
+	"testing"
+)
+
+func TestSplitNameField(t *testing.T) {
+	for _, tc := range []struct {
+		field, name, secret string
+		secure              bool
+	}{
+		{"Rick", "Rick", "", false},
+		{"Rick#pickle", "Rick", "pickle", false},
+		{"Rick ##pickle", "Rick", "pickle", true},
+		{"#pickle", "", "pickle", false},
+		{"Rick#pick#le", "Rick", "pick#le", false},
+	} {
+		name, secret, secure := model.SplitNameField(tc.field)
+		if name != tc.name || secret != tc.secret || secure != tc.secure {
+			t.Errorf("%q: got (%q, %q, %v)", tc.field, name, secret, secure)
+		}
+	}
+}
+
+func TestTripcode(t *testing.T) {
+	tripcoder := NewTripcoder([]byte("pepper"))
+
+	regular := tripcoder.Tripcode("pickle", false)
+	if !strings.HasPrefix(regular, model.TripcodePrefix) || len(regular) != len(model.TripcodePrefix)+tripcodeLength {
+		t.Errorf("unexpected regular tripcode %q", regular)
+	}
+	if regular != tripcoder.Tripcode("pickle", false) {
+		t.Error("expected the same secret to give the same tripcode")
+	}
+	if regular == tripcoder.Tripcode("pickles", false) {
+		t.Error("expected different secrets to give different tripcodes")
+	}
+	if strings.Contains(regular, "pickle") {
+		t.Error("tripcode leaks the secret")
+	}
+	if tripcoder.Tripcode("", true) != "" {
+		t.Error("expected no tripcode without a secret")
+	}
+}
+
+func TestTripcode_SecureUsesPepper(t *testing.T) {
+	a := NewTripcoder([]byte("pepper-a"))
+	b := NewTripcoder([]byte("pepper-b"))
+
+	secure := a.Tripcode("pickle", true)
+	if !strings.HasPrefix(secure, model.SecureTripcodePrefix) {
+		t.Errorf("unexpected secure tripcode %q", secure)
+	}
+	if secure == b.Tripcode("pickle", true) {
+		t.Error("expected secure tripcodes to depend on the pepper")
+	}
+	if a.Tripcode("pickle", false) != b.Tripcode("pickle", false) {
+		t.Error("expected regular tripcodes to be the same on every server")
+	}
+}
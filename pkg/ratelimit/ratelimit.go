@@ -0,0 +1,52 @@
+// Fixed window rate limiter kept in memory, good enough for a single instance
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	count int
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	windows map[string]*window
+	now     func() time.Time // replaced in tests
+}
+
+// NewLimiter allows limit events per key in every period
+func NewLimiter(limit int, period time.Duration) *Limiter {
+	return &Limiter{limit: limit, period: period, windows: make(map[string]*window), now: time.Now}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		// Old windows are dropped here, so the map can't grow past the keys of one period
+		if len(l.windows) > 10000 {
+			l.sweep(now)
+		}
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	w.count++
+	return w.count <= l.limit
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.period {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	if !l.Allow("1.2.3.4") || !l.Allow("1.2.3.4") {
+		t.Fatal("expected the first two attempts to pass")
+	}
+	if l.Allow("1.2.3.4") {
+		t.Error("expected the third attempt to be limited")
+	}
+	if !l.Allow("5.6.7.8") {
+		t.Error("expected other keys to have their own budget")
+	}
+
+	now = now.Add(time.Minute)
+	if !l.Allow("1.2.3.4") {
+		t.Error("expected the budget to reset after the period")
+	}
+}
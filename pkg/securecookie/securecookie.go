@@ -0,0 +1,118 @@
+// Signed and optionally encrypted cookie values
+// The first key signs new values, every key is accepted when verifying, so keys can be rotated
+// without logging everybody out: add the new key in front, drop the old one after the cookies expire
+package securecookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNoKeys       = errors.New("securecookie: at least one key is required")
+	ErrInvalidValue = errors.New("securecookie: invalid cookie value")
+)
+
+type key struct {
+	sign    []byte
+	encrypt cipher.AEAD
+}
+
+type Codec struct {
+	keys    []key
+	encrypt bool
+}
+
+// NewCodec derives signing and encryption keys from every secret, secrets[0] is the current one
+func NewCodec(secrets []string, encrypt bool) (*Codec, error) {
+	c := &Codec{encrypt: encrypt}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		block, err := aes.NewCipher(derive("encrypt", secret))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, key{sign: derive("sign", secret), encrypt: aead})
+	}
+	if len(c.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return c, nil
+}
+
+// Separate keys for separate purposes, both 32 bytes
+func derive(purpose, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("1337b04rd cookie " + purpose))
+	return mac.Sum(nil)
+}
+
+// Encode returns "payload.signature", the cookie name is signed too so values can't be moved between cookies
+func (c *Codec) Encode(name, value string) (string, error) {
+	current := c.keys[0]
+	payload := []byte(value)
+	if c.encrypt {
+		nonce := make([]byte, current.encrypt.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = current.encrypt.Seal(nonce, nonce, payload, []byte(name))
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(current.sign, name, encoded)), nil
+}
+
+// Decode verifies the signature against every key before looking at the payload
+func (c *Codec) Decode(name, cookie string) (string, error) {
+	encoded, sig, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return "", ErrInvalidValue
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+
+	for _, k := range c.keys {
+		if !hmac.Equal(mac, signature(k.sign, name, encoded)) {
+			continue
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", ErrInvalidValue
+		}
+		if !c.encrypt {
+			return string(payload), nil
+		}
+
+		nonceSize := k.encrypt.NonceSize()
+		if len(payload) < nonceSize {
+			return "", ErrInvalidValue
+		}
+		plain, err := k.encrypt.Open(nil, payload[:nonceSize], payload[nonceSize:], []byte(name))
+		if err != nil {
+			return "", ErrInvalidValue
+		}
+		return string(plain), nil
+	}
+	return "", ErrInvalidValue
+}
+
+func signature(key []byte, name, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "|" + encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,82 @@
+package securecookie
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		codec, err := NewCodec([]string{"secret"}, encrypt)
+		if err != nil {
+			t.Fatalf("NewCodec failed: %v", err)
+		}
+
+		cookie, err := codec.Encode("session_id", "abc-123")
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if encrypt == strings.Contains(cookie, "YWJjLTEyMw") {
+			t.Errorf("encrypt=%v: unexpected plaintext visibility in %q", encrypt, cookie)
+		}
+
+		value, err := codec.Decode("session_id", cookie)
+		if err != nil || value != "abc-123" {
+			t.Errorf("encrypt=%v: expected abc-123, got %q, %v", encrypt, value, err)
+		}
+	}
+}
+
+func TestCodec_RejectsTampering(t *testing.T) {
+	codec, _ := NewCodec([]string{"secret"}, false)
+	cookie, _ := codec.Encode("session_id", "abc-123")
+	payload, sig, _ := strings.Cut(cookie, ".")
+
+	for _, bad := range []string{
+		"abc-123",           // plain UUID from an old cookie
+		"YWJjLTEyNA." + sig, // other value, same signature
+		payload + ".AAAA",
+		payload,
+		"",
+	} {
+		if _, err := codec.Decode("session_id", bad); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%q: expected ErrInvalidValue, got %v", bad, err)
+		}
+	}
+
+	// Signature covers the cookie name
+	if _, err := codec.Decode("other", cookie); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected value of another cookie to be rejected, got %v", err)
+	}
+}
+
+func TestCodec_KeyRotation(t *testing.T) {
+	old, _ := NewCodec([]string{"old"}, true)
+	cookie, _ := old.Encode("session_id", "abc-123")
+
+	rotated, err := NewCodec([]string{"new", "old"}, true)
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	if value, err := rotated.Decode("session_id", cookie); err != nil || value != "abc-123" {
+		t.Errorf("expected old cookie to verify after rotation, got %q, %v", value, err)
+	}
+
+	// New cookies are signed with the new key only
+	fresh, _ := rotated.Encode("session_id", "abc-123")
+	if _, err := old.Decode("session_id", fresh); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected new cookie to fail with the old key, got %v", err)
+	}
+
+	retired, _ := NewCodec([]string{"new"}, true)
+	if _, err := retired.Decode("session_id", cookie); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected cookie of a dropped key to be rejected, got %v", err)
+	}
+}
+
+func TestNewCodec_NoKeys(t *testing.T) {
+	if _, err := NewCodec([]string{"", ""}, false); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("expected ErrNoKeys, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package sigv4
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	creds := Credentials{AccessKey: "access", SecretKey: "secret", Region: "us-east-1", Service: "s3"}
+	body := []byte("hello")
+
+	req, err := http.NewRequest(http.MethodPut, "http://localhost:9000/bucket/some%20key.png?x-id=PutObject", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	Sign(req, HashPayload(body), creds, time.Now())
+
+	if !strings.HasPrefix(req.Header.Get(HeaderAuth), Algorithm) {
+		t.Fatalf("expected authorization header, got %q", req.Header.Get(HeaderAuth))
+	}
+	if err := Verify(req, creds); err != nil {
+		t.Errorf("expected signature to verify: %v", err)
+	}
+}
+
+func TestVerify_WrongSecret(t *testing.T) {
+	creds := Credentials{AccessKey: "access", SecretKey: "secret", Region: "us-east-1", Service: "s3"}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:9000/bucket/key", nil)
+	Sign(req, HashPayload(nil), creds, time.Now())
+
+	creds.SecretKey = "other"
+	if err := Verify(req, creds); err == nil {
+		t.Error("expected verification to fail with a different secret")
+	}
+}
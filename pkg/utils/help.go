@@ -9,9 +9,11 @@ func PrintUsage() {
 
 	Usage:
 	1337b04rd [--port <N>]  
+	1337b04rd gc [--dry-run]
 	1337b04rd --help
 
 	Options:
 	--help       Show this screen.
-	--port N     Port number.`)
+	--port N     Port number.
+	--dry-run    With gc: list orphaned images without deleting them.`)
 }